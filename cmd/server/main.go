@@ -69,6 +69,7 @@ func main() {
 	port := flag.String("port", "8081", "服务器端口")
 	modelPath := flag.String("model", defaultModelPath, "GGUF 模型路径")
 	dbPath := flag.String("db", defaultDbPath, "SQLite 数据库路径")
+	ocrCmd := flag.String("ocr-cmd", "", "OCR 命令模板，{input} 替换为图片路径，结果从标准输出读取；默认使用 PATH 中的 tesseract")
 	flag.Parse()
 
 	// 解析路径
@@ -139,6 +140,7 @@ func main() {
 	var engine llm.Engine = llm.NewEngine()
 
 	// 初始化知识库
+	kb.SetOCRCommand(*ocrCmd)
 	kbase := kb.NewKnowledgeBase()
 
 	// 尝试初始化引擎。如果失败（例如模型路径错误或绑定错误），清晰记录日志
@@ -153,6 +155,14 @@ func main() {
 	// 将初始化后的引擎赋值给全局变量，供知识库使用
 	llm.CurrentEngine = engine
 
+	// 恢复上次退出时未完成的知识库处理任务
+	kbase.StartJobs()
+
+	// 监听知识库目录，文件变化后自动增量同步
+	if err := kbase.StartWatching(); err != nil {
+		log.Printf("启动知识库目录监听失败: %v", err)
+	}
+
 	// 处理退出信号：优雅关闭 HTTP + 取消 KB 任务 + 释放引擎资源
 	appCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
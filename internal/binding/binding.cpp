@@ -466,4 +466,16 @@ void llama_binding_free_embedding(float* embedding) {
     }
 }
 
+// 按当前模型的分词器统计 token 数（不含 BOS 等特殊 token），失败返回 -1
+int llama_binding_count_tokens(void* ctx, const char* text) {
+    if (!ctx || !text) {
+        return -1;
+    }
+    auto* bctx = (LlamaBindingContext*) ctx;
+    // 只读取词表，不触碰推理上下文，可与生成并发调用
+    const llama_vocab * vocab = llama_model_get_vocab(bctx->model);
+    std::vector<llama_token> tokens = common_tokenize(vocab, text, false, true);
+    return (int) tokens.size();
+}
+
 }
@@ -136,3 +136,15 @@ func (l *Llama) GetEmbedding(text string) ([]float32, error) {
 
 	return result, nil
 }
+
+// CountTokens 使用模型分词器统计文本的 token 数
+func (l *Llama) CountTokens(text string) (int, error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	n := int(C.llama_binding_count_tokens(l.ctx, cText))
+	if n < 0 {
+		return 0, fmt.Errorf("failed to tokenize text")
+	}
+	return n, nil
+}
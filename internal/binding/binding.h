@@ -12,6 +12,7 @@ char* llama_binding_chat(void* ctx, const char* messages_json, const char* stop_
 int llama_binding_chat_stream(void* ctx, const char* messages_json, const char* stop_tokens, int n_predict, float temp, float top_p, int top_k, float repeat_penalty, uintptr_t cb_handle);
 float* llama_binding_get_embedding(void* ctx, const char* text, int* out_dim);
 void llama_binding_free_embedding(float* embedding);
+int llama_binding_count_tokens(void* ctx, const char* text);
 void llama_binding_free_model(void* ctx);
 void llama_binding_free_result(char* result);
 
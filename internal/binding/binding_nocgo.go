@@ -29,5 +29,9 @@ func (l *Llama) GetEmbedding(text string) ([]float32, error) {
 	return nil, fmt.Errorf("CGO is disabled, Llama binding is unavailable")
 }
 
+func (l *Llama) CountTokens(text string) (int, error) {
+	return 0, fmt.Errorf("CGO is disabled, Llama binding is unavailable")
+}
+
 func (l *Llama) Close() {
 }
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const DefaultCollectionName = "Default"
+
+// KnowledgeBaseCollection 知识库集合：独立的目录、embedding 模型与分片设置
+type KnowledgeBaseCollection struct {
+	BaseModel
+	Name           string   `gorm:"uniqueIndex"`
+	Folders        []string `gorm:"serializer:json"`
+	EmbeddingModel string   // 写入向量时使用的模型，首次处理文件时记录
+	ChunkSize      int      // 按 token 计；0 表示按文件类型使用默认值
+	ChunkOverlap   int
+}
+
+// migrateCollections 将旧版单目录知识库迁移为默认集合
+func migrateCollections() error {
+	c, err := GetDefaultCollection()
+	if err != nil {
+		return err
+	}
+	return DB.Model(&KnowledgeBaseFile{}).Where("collection_id = 0 OR collection_id IS NULL").Update("collection_id", c.ID).Error
+}
+
+// GetDefaultCollection 获取默认集合，不存在时按旧的 KBFolderKey / KBEmbeddingModelKey 设置创建
+func GetDefaultCollection() (*KnowledgeBaseCollection, error) {
+	var c KnowledgeBaseCollection
+	err := DB.Where("name = ?", DefaultCollectionName).First(&c).Error
+	if err == nil {
+		return &c, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	c = KnowledgeBaseCollection{Name: DefaultCollectionName}
+	if folder, _ := GetSetting(KBFolderKey); strings.TrimSpace(folder) != "" {
+		c.Folders = []string{strings.TrimSpace(folder)}
+	}
+	if model, _ := GetSetting(KBEmbeddingModelKey); strings.TrimSpace(model) != "" {
+		c.EmbeddingModel = strings.TrimSpace(model)
+	}
+	if err := DB.Create(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func ListCollections() ([]KnowledgeBaseCollection, error) {
+	var cs []KnowledgeBaseCollection
+	err := DB.Order("id asc").Find(&cs).Error
+	return cs, err
+}
+
+func GetCollection(id uint) (*KnowledgeBaseCollection, error) {
+	var c KnowledgeBaseCollection
+	if err := DB.First(&c, id).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveCollection 创建或更新集合；同一目录不能属于多个集合（文件路径全局唯一）
+func SaveCollection(c *KnowledgeBaseCollection) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("collection name is required")
+	}
+	folders := make([]string, 0, len(c.Folders))
+	for _, f := range c.Folders {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			folders = append(folders, filepath.Clean(f))
+		}
+	}
+	c.Folders = folders
+
+	others, err := ListCollections()
+	if err != nil {
+		return err
+	}
+	for _, o := range others {
+		if o.ID == c.ID {
+			continue
+		}
+		for _, of := range o.Folders {
+			for _, f := range c.Folders {
+				if folderOverlaps(of, f) {
+					return fmt.Errorf("folder %s overlaps with collection %q", f, o.Name)
+				}
+			}
+		}
+	}
+	return DB.Save(c).Error
+}
+
+func folderOverlaps(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	sep := string(filepath.Separator)
+	return a == b || strings.HasPrefix(a, b+sep) || strings.HasPrefix(b, a+sep)
+}
+
+// ErrDefaultCollection 默认集合不能删除
+var ErrDefaultCollection = errors.New("default collection cannot be deleted")
+
+// DeleteCollection 删除集合及其文件记录和分片（不删除磁盘文件）
+func DeleteCollection(id uint) error {
+	c, err := GetCollection(id)
+	if err != nil {
+		return err
+	}
+	if c.Name == DefaultCollectionName {
+		return ErrDefaultCollection
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id IN (?)", tx.Model(&KnowledgeBaseFile{}).Select("id").Where("collection_id = ?", id)).Delete(&KnowledgeBaseChunk{}).Error; err != nil {
+			return err
+		}
+		if err := dropKBTables(tx, "file_id IN (?)", tx.Model(&KnowledgeBaseFile{}).Select("id").Where("collection_id = ?", id)); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id IN (?)", tx.Model(&KnowledgeBaseFile{}).Select("id").Where("collection_id = ?", id)).Delete(&KBJob{}).Error; err != nil {
+			return err
+		}
+		if err := deleteKBReembedJobs(tx, "collection_id = ?", id); err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", id).Delete(&KnowledgeBaseFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&KnowledgeBaseCollection{}, id).Error
+	})
+}
+
+// SetCollectionEmbeddingModel 记录集合的 embedding 模型
+func SetCollectionEmbeddingModel(id uint, model string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return nil
+	}
+	return DB.Model(&KnowledgeBaseCollection{}).Where("id = ?", id).Update("embedding_model", model).Error
+}
+
+// SetDefaultCollectionFolder 兼容旧的单目录设置：更新默认集合的目录
+func SetDefaultCollectionFolder(folder string) error {
+	c, err := GetDefaultCollection()
+	if err != nil {
+		return err
+	}
+	folder = strings.TrimSpace(folder)
+	if folder == "" {
+		c.Folders = nil
+	} else {
+		c.Folders = []string{folder}
+	}
+	return SaveCollection(c)
+}
+
+// ListKBFilesInCollection 列出集合下的文件记录
+func ListKBFilesInCollection(collectionID uint) ([]KnowledgeBaseFile, error) {
+	var files []KnowledgeBaseFile
+	err := DB.Where("collection_id = ?", collectionID).Find(&files).Error
+	return files, err
+}
+
+// ListKBFileIDsInCollections 列出若干集合下的文件 ID
+func ListKBFileIDsInCollections(collectionIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(collectionIDs) == 0 {
+		return ids, nil
+	}
+	err := DB.Model(&KnowledgeBaseFile{}).Where("collection_id IN ?", collectionIDs).Pluck("id", &ids).Error
+	return ids, err
+}
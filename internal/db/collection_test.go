@@ -0,0 +1,99 @@
+//go:build cgo
+
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveCollectionFolderOverlap(t *testing.T) {
+	openTestDB(t)
+	docs := filepath.Join(t.TempDir(), "docs")
+	a := KnowledgeBaseCollection{Name: "文档", Folders: []string{docs}}
+	if err := SaveCollection(&a); err != nil {
+		t.Fatal(err)
+	}
+	// 同一目录或其子目录、父目录不能属于其他集合
+	for _, folder := range []string{docs, docs + string(filepath.Separator), filepath.Join(docs, "sub"), filepath.Dir(docs)} {
+		c := KnowledgeBaseCollection{Name: "其他", Folders: []string{folder}}
+		if err := SaveCollection(&c); err == nil {
+			t.Errorf("expected folder %s to overlap with %s", folder, docs)
+		}
+	}
+	// 名称前缀相同的兄弟目录不算重叠；集合修改自身目录不与自己冲突
+	b := KnowledgeBaseCollection{Name: "其他", Folders: []string{docs + "2"}}
+	if err := SaveCollection(&b); err != nil {
+		t.Errorf("sibling folder rejected: %v", err)
+	}
+	a.Folders = append(a.Folders, filepath.Join(docs, "sub"))
+	if err := SaveCollection(&a); err != nil {
+		t.Errorf("updating a collection's own folders rejected: %v", err)
+	}
+}
+
+func TestDeleteCollection(t *testing.T) {
+	openTestDB(t)
+	c := KnowledgeBaseCollection{Name: "报表"}
+	if err := SaveCollection(&c); err != nil {
+		t.Fatal(err)
+	}
+	f, err := SaveKBFile(c.ID, "/data/sales.csv", 10, "sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveKBChunk(f.ID, "地区: 华东", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	table := TableData{Sheet: "sales.csv", Columns: []TableColumn{{Name: "地区", Type: ColumnText}}, Rows: [][]any{{"华东"}}}
+	if err := ReplaceKBTables(f.ID, []TableData{table}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnqueueKBJob(f.ID, JobStageExtract, 3); err != nil {
+		t.Fatal(err)
+	}
+	job, err := StartKBReembedJob(c.ID, "old.gguf", "new.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&KBStagedVector{ChunkID: 1, JobID: job.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteCollection(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	for name, model := range map[string]any{
+		"collections":    &KnowledgeBaseCollection{},
+		"files":          &KnowledgeBaseFile{},
+		"chunks":         &KnowledgeBaseChunk{},
+		"tables":         &KBTable{},
+		"jobs":           &KBJob{},
+		"re-embed jobs":  &KBReembedJob{},
+		"staged vectors": &KBStagedVector{},
+	} {
+		var n int64
+		q := DB.Model(model)
+		if name == "collections" {
+			q = q.Where("id = ?", c.ID)
+		}
+		if err := q.Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d %s left after deleting the collection", n, name)
+		}
+	}
+	if DB.Migrator().HasTable(KBTableName(f.ID, 1)) {
+		t.Errorf("materialized table %s was not dropped", KBTableName(f.ID, 1))
+	}
+
+	def, err := GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteCollection(def.ID); !errors.Is(err, ErrDefaultCollection) {
+		t.Errorf("deleting the default collection = %v, want ErrDefaultCollection", err)
+	}
+}
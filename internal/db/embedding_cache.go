@@ -0,0 +1,101 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// KBEmbeddingCache 持久化的 embedding 缓存，按（模型, 内容哈希）复用向量：
+// 重建知识库、重启或文件被 touch 后，内容未变的分片不再重新计算
+type KBEmbeddingCache struct {
+	Model  string `gorm:"primaryKey"`
+	Hash   string `gorm:"primaryKey"` // 分片内容的 SHA-256
+	Vector []byte
+	UsedAt time.Time `gorm:"index"` // 最近一次命中或写入的时间，淘汰时先删最久未用的
+}
+
+// ContentHash 分片内容的 SHA-256（十六进制），用作 embedding 缓存与暂存向量的内容标识
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// embeddingLookupBatch 单条 IN 查询的哈希个数，低于 SQLite 的参数上限
+const embeddingLookupBatch = 500
+
+// LookupEmbeddings 批量查询缓存的向量，命中的条目刷新使用时间。
+// tx 可为正在写入分片的事务，避免与其争用写锁
+func LookupEmbeddings(tx *gorm.DB, model string, hashes []string) (map[string][]byte, error) {
+	found := make(map[string][]byte)
+	if model == "" || len(hashes) == 0 {
+		return found, nil
+	}
+	now := time.Now()
+	for start := 0; start < len(hashes); start += embeddingLookupBatch {
+		batch := hashes[start:min(start+embeddingLookupBatch, len(hashes))]
+		var rows []KBEmbeddingCache
+		if err := tx.Where("model = ? AND hash IN ?", model, batch).Find(&rows).Error; err != nil {
+			return found, err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		hits := make([]string, len(rows))
+		for i, r := range rows {
+			found[r.Hash] = r.Vector
+			hits[i] = r.Hash
+		}
+		if err := tx.Model(&KBEmbeddingCache{}).Where("model = ? AND hash IN ?", model, hits).Update("used_at", now).Error; err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// SaveEmbeddings 写入（或覆盖）缓存的向量
+func SaveEmbeddings(tx *gorm.DB, model string, vectors map[string][]byte) error {
+	if model == "" || len(vectors) == 0 {
+		return nil
+	}
+	now := time.Now()
+	rows := make([]KBEmbeddingCache, 0, len(vectors))
+	for hash, v := range vectors {
+		if len(v) > 0 {
+			rows = append(rows, KBEmbeddingCache{Model: model, Hash: hash, Vector: v, UsedAt: now})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model"}, {Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"vector", "used_at"}),
+	}).CreateInBatches(rows, 200).Error
+}
+
+// EvictEmbeddingCache 条目数超过 maxEntries 时删除最久未使用的条目，返回删除的条数
+func EvictEmbeddingCache(maxEntries int) (int64, error) {
+	var count int64
+	if err := DB.Model(&KBEmbeddingCache{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count <= int64(maxEntries) {
+		return 0, nil
+	}
+	res := DB.Exec("DELETE FROM kb_embedding_caches WHERE rowid IN (SELECT rowid FROM kb_embedding_caches ORDER BY used_at ASC LIMIT ?)", count-int64(maxEntries))
+	return res.RowsAffected, res.Error
+}
+
+// EmbeddingCacheStats 缓存的条目数与向量占用的字节数
+func EmbeddingCacheStats() (entries int64, bytes int64, err error) {
+	var row struct {
+		Entries int64
+		Bytes   int64
+	}
+	err = DB.Model(&KBEmbeddingCache{}).Select("COUNT(*) AS entries, COALESCE(SUM(LENGTH(vector)), 0) AS bytes").Scan(&row).Error
+	return row.Entries, row.Bytes, err
+}
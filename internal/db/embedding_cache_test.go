@@ -0,0 +1,54 @@
+//go:build cgo
+
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmbeddingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	openTestDB(t)
+	const model = "m.gguf"
+	vectors := map[string][]byte{"a": {1, 0, 0, 0}, "b": {2, 0, 0, 0}, "c": {3, 0, 0, 0}}
+	if err := SaveEmbeddings(DB, model, vectors); err != nil {
+		t.Fatal(err)
+	}
+	// 写入顺序 a < b < c，a 最久未用
+	base := time.Now().Add(-time.Hour)
+	for i, hash := range []string{"a", "b", "c"} {
+		if err := DB.Model(&KBEmbeddingCache{}).Where("hash = ?", hash).Update("used_at", base.Add(time.Duration(i)*time.Minute)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 命中 a 刷新其使用时间，此后 b 成为最久未用
+	found, err := LookupEmbeddings(DB, model, []string{"a", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found["a"][0] != 1 {
+		t.Fatalf("lookup = %v, want only a", found)
+	}
+	var a KBEmbeddingCache
+	if err := DB.Where("hash = ?", "a").First(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !a.UsedAt.After(base.Add(2 * time.Minute)) {
+		t.Fatalf("used_at of a not refreshed: %v", a.UsedAt)
+	}
+
+	if n, err := EvictEmbeddingCache(3); err != nil || n != 0 {
+		t.Fatalf("evict under limit = %d, %v", n, err)
+	}
+	if n, err := EvictEmbeddingCache(1); err != nil || n != 2 {
+		t.Fatalf("evict = %d, %v; want 2", n, err)
+	}
+	var left []string
+	if err := DB.Model(&KBEmbeddingCache{}).Pluck("hash", &left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0] != "a" {
+		t.Fatalf("remaining = %v, want [a]", left)
+	}
+}
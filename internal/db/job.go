@@ -0,0 +1,202 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 文件处理阶段：extract 抽取并写入分片，embed 为没有向量的分片分批生成向量
+const (
+	JobStageExtract = "extract"
+	JobStageEmbed   = "embed"
+)
+
+// 任务状态
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// KBJob 知识库文件的处理任务（每个文件、每个阶段一条），持久化以便重启后继续并按退避策略重试
+type KBJob struct {
+	BaseModel
+	FileID      uint   `gorm:"index"`
+	Path        string // 文件路径（文件记录删除后仍可展示）
+	Stage       string
+	Status      string `gorm:"index"`
+	Attempts    int    // 已开始执行的次数
+	MaxAttempts int
+	NextRunAt   time.Time `gorm:"index"` // 排队中的任务最早可执行的时间（重试退避）
+	Error       string
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
+
+// activeJobStatuses 未结束的任务
+var activeJobStatuses = []string{JobQueued, JobRunning}
+
+// prunableJobStatuses 可以清理的已结束任务；失败的任务保留，便于查看原因并重试
+var prunableJobStatuses = []string{JobDone, JobCanceled}
+
+// EnqueueKBJob 为文件排队一个阶段任务；同一文件尚未开始的任务被新任务取代
+func EnqueueKBJob(fileID uint, stage string, maxAttempts int) (*KBJob, error) {
+	var f KnowledgeBaseFile
+	if err := DB.First(&f, fileID).Error; err != nil {
+		return nil, err
+	}
+	job := KBJob{FileID: fileID, Path: f.Path, Stage: stage, Status: JobQueued, MaxAttempts: maxAttempts, NextRunAt: time.Now()}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&KBJob{}).Where("file_id = ? AND status = ?", fileID, JobQueued).
+			Updates(map[string]any{"status": JobCanceled, "error": "superseded"}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimKBJob 取出一个到期的排队任务并标记为执行中（attempts 加一）；同一文件的任务不会同时执行。
+// 没有可执行的任务时返回 nil
+func ClaimKBJob() (*KBJob, error) {
+	for {
+		var job KBJob
+		err := DB.Where("status = ? AND next_run_at <= ?", JobQueued, time.Now()).
+			Where("file_id NOT IN (?)", DB.Model(&KBJob{}).Select("file_id").Where("status = ?", JobRunning)).
+			Order("next_run_at asc, id asc").Limit(1).Find(&job).Error
+		if err != nil || job.ID == 0 {
+			return nil, err
+		}
+		now := time.Now()
+		res := DB.Model(&KBJob{}).Where("id = ? AND status = ?", job.ID, JobQueued).Updates(map[string]any{
+			"status":     JobRunning,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"started_at": now,
+			"error":      "",
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			job.Status, job.Attempts, job.StartedAt, job.Error = JobRunning, job.Attempts+1, &now, ""
+			return &job, nil
+		}
+		// 被其他执行者抢先领取，继续找下一个
+	}
+}
+
+// FinishKBJob 记录执行中任务的结果：done/failed/canceled；status 为 queued 时表示等待 nextRunAt 后重试。
+// 任务已被取消或删除时不做修改
+func FinishKBJob(id uint, status, errMsg string, nextRunAt time.Time) error {
+	updates := map[string]any{"status": status, "error": errMsg}
+	if status == JobQueued {
+		updates["next_run_at"] = nextRunAt
+	} else {
+		updates["finished_at"] = time.Now()
+	}
+	return DB.Model(&KBJob{}).Where("id = ? AND status = ?", id, JobRunning).Updates(updates).Error
+}
+
+// RequeueRunningKBJobs 进程重启后，把上次中断时仍在执行的任务放回队列（不计入重试次数）
+func RequeueRunningKBJobs() (int64, error) {
+	res := DB.Model(&KBJob{}).Where("status = ?", JobRunning).Updates(map[string]any{
+		"status":      JobQueued,
+		"attempts":    gorm.Expr("MAX(attempts - 1, 0)"),
+		"next_run_at": time.Now(),
+	})
+	return res.RowsAffected, res.Error
+}
+
+// CancelKBJob 取消未结束的任务；任务已结束时 ok 为 false
+func CancelKBJob(id uint) (bool, error) {
+	res := DB.Model(&KBJob{}).Where("id = ? AND status IN ?", id, activeJobStatuses).
+		Updates(map[string]any{"status": JobCanceled, "error": "canceled", "finished_at": time.Now()})
+	return res.RowsAffected == 1, res.Error
+}
+
+// CancelQueuedKBJobs 取消所有排队中的任务（停止同步时），返回取消的条数
+func CancelQueuedKBJobs() (int64, error) {
+	res := DB.Model(&KBJob{}).Where("status = ?", JobQueued).
+		Updates(map[string]any{"status": JobCanceled, "error": "canceled", "finished_at": time.Now()})
+	return res.RowsAffected, res.Error
+}
+
+// RetryKBJob 把失败或已取消的任务重新排队并清零重试次数；任务仍在队列中或正在执行时 ok 为 false
+func RetryKBJob(id uint) (bool, error) {
+	res := DB.Model(&KBJob{}).Where("id = ? AND status IN ?", id, []string{JobFailed, JobCanceled}).Updates(map[string]any{
+		"status":      JobQueued,
+		"attempts":    0,
+		"next_run_at": time.Now(),
+		"error":       "",
+		"finished_at": nil,
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+func GetKBJob(id uint) (*KBJob, error) {
+	var job KBJob
+	if err := DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListKBJobs 按时间倒序列出任务；status 为空表示全部
+func ListKBJobs(status string, limit int) ([]KBJob, error) {
+	q := DB.Order("id desc").Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var jobs []KBJob
+	err := q.Find(&jobs).Error
+	return jobs, err
+}
+
+// LatestKBJobs 返回每个文件最近的一条任务
+func LatestKBJobs(fileIDs []uint) (map[uint]KBJob, error) {
+	latest := make(map[uint]KBJob, len(fileIDs))
+	for start := 0; start < len(fileIDs); start += embeddingLookupBatch {
+		batch := fileIDs[start:min(start+embeddingLookupBatch, len(fileIDs))]
+		var jobs []KBJob
+		err := DB.Where("id IN (?)", DB.Model(&KBJob{}).Select("MAX(id)").Where("file_id IN ?", batch).Group("file_id")).Find(&jobs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jobs {
+			latest[j.FileID] = j
+		}
+	}
+	return latest, nil
+}
+
+// HasActiveKBJob 文件是否有排队中或执行中的任务
+func HasActiveKBJob(fileID uint) (bool, error) {
+	var n int64
+	err := DB.Model(&KBJob{}).Where("file_id = ? AND status IN ?", fileID, activeJobStatuses).Count(&n).Error
+	return n > 0, err
+}
+
+// NextKBJobRunAt 最早到期的排队任务时间；没有排队任务时 ok 为 false
+func NextKBJobRunAt() (t time.Time, ok bool, err error) {
+	var job KBJob
+	err = DB.Where("status = ?", JobQueued).Order("next_run_at asc").Limit(1).Find(&job).Error
+	return job.NextRunAt, job.ID != 0, err
+}
+
+// PruneKBJobs 清理已完成或已取消的历史任务：结束时间早于 before 的，以及除最近 keep 条以外的。
+// 每个文件最近的一条任务始终保留，用于判断文件的处理状态。返回删除的条数
+func PruneKBJobs(before time.Time, keep int) (int64, error) {
+	latest := DB.Model(&KBJob{}).Select("MAX(id)").Group("file_id")
+	recent := DB.Model(&KBJob{}).Select("id").Where("status IN ?", prunableJobStatuses).Order("id desc").Limit(keep)
+	res := DB.Where("status IN ?", prunableJobStatuses).
+		Where("id NOT IN (?)", latest).
+		Where("COALESCE(finished_at, updated_at) < ? OR id NOT IN (?)", before, recent).
+		Delete(&KBJob{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,80 @@
+//go:build cgo
+
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// openTestDB 在临时目录中初始化数据库（go-sqlite3 需要 cgo）
+func openTestDB(t *testing.T) {
+	t.Helper()
+	InitDB(filepath.Join(t.TempDir(), "knowledge.db"))
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		DB = nil
+	})
+}
+
+func TestPruneKBJobs(t *testing.T) {
+	openTestDB(t)
+	a := KnowledgeBaseFile{Path: "/docs/a.md", CollectionID: 1}
+	b := KnowledgeBaseFile{Path: "/docs/b.md", CollectionID: 1}
+	if err := DB.Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&b).Error; err != nil {
+		t.Fatal(err)
+	}
+	old, now := time.Now().Add(-30*24*time.Hour), time.Now()
+	create := func(fileID uint, status string, finished time.Time) uint {
+		job := KBJob{FileID: fileID, Status: status, FinishedAt: &finished}
+		if err := DB.Create(&job).Error; err != nil {
+			t.Fatal(err)
+		}
+		return job.ID
+	}
+	ids := func() []uint {
+		var jobs []KBJob
+		if err := DB.Order("id").Find(&jobs).Error; err != nil {
+			t.Fatal(err)
+		}
+		var out []uint
+		for _, j := range jobs {
+			out = append(out, j.ID)
+		}
+		return out
+	}
+
+	for range 3 {
+		create(a.ID, JobDone, old)
+	}
+	aLatest := create(a.ID, JobCanceled, old)
+	bFailed := create(b.ID, JobFailed, old)
+	bLatest := create(b.ID, JobDone, old)
+
+	// 过期的已结束任务被清理；失败的任务与每个文件最近的一条保留
+	if _, err := PruneKBJobs(now.Add(-time.Hour), 100); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []uint{aLatest, bFailed, bLatest}; !slices.Equal(got, want) {
+		t.Fatalf("after age prune: jobs = %v, want %v", got, want)
+	}
+
+	// 未过期的任务超出保留条数时，只保留最近的几条
+	var recent []uint
+	for range 4 {
+		recent = append(recent, create(a.ID, JobDone, now))
+	}
+	if _, err := PruneKBJobs(now.Add(-time.Hour), 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []uint{bFailed, bLatest, recent[2], recent[3]}; !slices.Equal(got, want) {
+		t.Errorf("after count prune: jobs = %v, want %v", got, want)
+	}
+}
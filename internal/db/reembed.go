@@ -0,0 +1,213 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KBReembedJob 集合的重新生成向量任务：embedding 模型变化后在后台用新模型为集合的分片生成向量，
+// 新向量先写入暂存表，旧向量与集合记录的模型保持不变；全部完成后在一个事务中切换
+type KBReembedJob struct {
+	BaseModel
+	CollectionID uint `gorm:"index"`
+	FromModel    string
+	ToModel      string
+	Status       string `gorm:"index"` // queued/running/done/failed/canceled
+	Total        int    // 开始时需要重新生成向量的分片数
+	Done         int    // 已写入暂存表的分片数
+	Error        string
+	FinishedAt   *time.Time
+}
+
+// KBStagedVector 重新生成向量任务的暂存向量，切换时写回分片。
+// 分片被删除后 rowid 可能被重新导入的分片复用，因此记录生成向量时的内容哈希，切换时只写回内容未变的分片
+type KBStagedVector struct {
+	ChunkID uint   `gorm:"primaryKey;autoIncrement:false"`
+	JobID   uint   `gorm:"index"`
+	Hash    string // 生成向量时分片内容的 ContentHash
+	Vector  []byte
+	Dim     int
+}
+
+// chunksToReembed 集合中向量来自其他模型、也还没有暂存向量的分片。
+// 没有向量的分片（如导入时跳过向量的大表格）不在迁移范围内，切换后由后台补齐
+func chunksToReembed(tx *gorm.DB, job *KBReembedJob) *gorm.DB {
+	return tx.Model(&KnowledgeBaseChunk{}).
+		Where("file_id IN (?)", tx.Model(&KnowledgeBaseFile{}).Select("id").Where("collection_id = ?", job.CollectionID)).
+		Where("vector IS NOT NULL AND LENGTH(vector) > 0 AND embedding_model <> ?", job.ToModel).
+		Where("id NOT IN (?)", tx.Model(&KBStagedVector{}).Select("chunk_id").Where("job_id = ?", job.ID))
+}
+
+// ActiveKBReembedJob 集合未结束的重新生成向量任务；没有时返回 nil
+func ActiveKBReembedJob(collectionID uint) (*KBReembedJob, error) {
+	var job KBReembedJob
+	err := DB.Where("collection_id = ? AND status IN ?", collectionID, activeJobStatuses).Order("id desc").Limit(1).Find(&job).Error
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StartKBReembedJob 为集合排队迁移到 toModel 的任务；已有相同目标的未结束任务时直接返回该任务，
+// 目标不同的未结束任务被取消（暂存向量一并删除）
+func StartKBReembedJob(collectionID uint, fromModel, toModel string) (*KBReembedJob, error) {
+	if job, err := ActiveKBReembedJob(collectionID); err != nil || (job != nil && job.ToModel == toModel) {
+		return job, err
+	} else if job != nil {
+		if err := CancelKBReembedJob(job.ID, "superseded"); err != nil {
+			return nil, err
+		}
+	}
+	job := KBReembedJob{CollectionID: collectionID, FromModel: fromModel, ToModel: toModel, Status: JobQueued}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		var total int64
+		if err := chunksToReembed(tx, &job).Count(&total).Error; err != nil {
+			return err
+		}
+		job.Total = int(total)
+		return tx.Model(&job).Update("total", job.Total).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelKBReembedJob 取消未结束的任务并删除其暂存向量；集合继续使用原来的向量
+func CancelKBReembedJob(id uint, reason string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", id).Delete(&KBStagedVector{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&KBReembedJob{}).Where("id = ? AND status IN ?", id, activeJobStatuses).
+			Updates(map[string]any{"status": JobCanceled, "error": reason, "finished_at": time.Now()}).Error
+	})
+}
+
+// FailKBReembedJob 记录任务失败并删除暂存向量；集合继续使用原来的向量
+func FailKBReembedJob(id uint, msg string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", id).Delete(&KBStagedVector{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&KBReembedJob{}).Where("id = ?", id).
+			Updates(map[string]any{"status": JobFailed, "error": msg, "finished_at": time.Now()}).Error
+	})
+}
+
+// ListKBChunksToReembed 按 id 取任务还需要生成向量的分片
+func ListKBChunksToReembed(job *KBReembedJob, limit int) ([]KnowledgeBaseChunk, error) {
+	var chunks []KnowledgeBaseChunk
+	err := chunksToReembed(DB, job).Order("id asc").Limit(limit).Find(&chunks).Error
+	return chunks, err
+}
+
+// StageKBVectors 写入一批暂存向量并更新任务进度；hashes 为生成各向量时分片内容的 ContentHash
+func StageKBVectors(tx *gorm.DB, jobID uint, vectors map[uint][]byte, hashes map[uint]string) error {
+	for id, v := range vectors {
+		if err := tx.Save(&KBStagedVector{ChunkID: id, JobID: jobID, Hash: hashes[id], Vector: v, Dim: len(v) / 4}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&KBReembedJob{}).Where("id = ?", jobID).Updates(map[string]any{
+		"status": JobRunning,
+		"done":   gorm.Expr("done + ?", len(vectors)),
+	}).Error
+}
+
+// staleStagedVectors 任务中分片已删除或内容与暂存时不一致的暂存向量
+func staleStagedVectors(tx *gorm.DB, jobID uint) ([]uint, error) {
+	rows, err := tx.Raw(`SELECT s.chunk_id, s.hash, c.content FROM kb_staged_vectors s
+		LEFT JOIN knowledge_base_chunks c ON c.id = s.chunk_id
+		WHERE s.job_id = ?`, jobID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stale []uint
+	for rows.Next() {
+		var id uint
+		var hash string
+		var content *string
+		if err := rows.Scan(&id, &hash, &content); err != nil {
+			return nil, err
+		}
+		if content == nil || ContentHash(*content) != hash {
+			stale = append(stale, id)
+		}
+	}
+	return stale, rows.Err()
+}
+
+// CutoverKBReembedJob 在一个事务中切换到新模型：暂存向量写回分片并记录模型与维度，集合改为新模型，任务完成。
+// 仍有分片需要重新生成向量时不切换，返回 false；暂存后内容已变的分片丢弃其暂存向量，同样返回 false，
+// 这些分片重新进入待处理范围，由下一批用新内容生成向量
+func CutoverKBReembedJob(id uint) (bool, error) {
+	done := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var job KBReembedJob
+		if err := tx.First(&job, id).Error; err != nil {
+			return err
+		}
+		if job.Status != JobQueued && job.Status != JobRunning {
+			return fmt.Errorf("re-embed job %d is %s", id, job.Status)
+		}
+		stale, err := staleStagedVectors(tx, id)
+		if err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			for start := 0; start < len(stale); start += embeddingLookupBatch {
+				batch := stale[start:min(start+embeddingLookupBatch, len(stale))]
+				if err := tx.Where("job_id = ? AND chunk_id IN ?", id, batch).Delete(&KBStagedVector{}).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&job).Update("done", gorm.Expr("MAX(done - ?, 0)", len(stale))).Error
+		}
+		var remaining int64
+		if err := chunksToReembed(tx, &job).Count(&remaining).Error; err != nil || remaining > 0 {
+			return err
+		}
+
+		staged := tx.Model(&KBStagedVector{}).Select("chunk_id").Where("job_id = ?", id)
+		err = tx.Exec(`UPDATE knowledge_base_chunks SET
+			vector = (SELECT s.vector FROM kb_staged_vectors s WHERE s.chunk_id = knowledge_base_chunks.id),
+			embedding_dim = (SELECT s.dim FROM kb_staged_vectors s WHERE s.chunk_id = knowledge_base_chunks.id),
+			embedding_model = ?
+			WHERE id IN (?)`, job.ToModel, staged).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("job_id = ?", id).Delete(&KBStagedVector{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&KnowledgeBaseCollection{}).Where("id = ?", job.CollectionID).Update("embedding_model", job.ToModel).Error; err != nil {
+			return err
+		}
+		done = true
+		return tx.Model(&job).Updates(map[string]any{"status": JobDone, "error": "", "finished_at": time.Now()}).Error
+	})
+	return done, err
+}
+
+// ListKBReembedJobs 最近的重新生成向量任务，新的在前
+func ListKBReembedJobs(limit int) ([]KBReembedJob, error) {
+	var jobs []KBReembedJob
+	err := DB.Order("id desc").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// deleteKBReembedJobs 删除集合的重新生成向量任务与暂存向量（删除集合或重置知识库时调用）
+func deleteKBReembedJobs(tx *gorm.DB, query any, args ...any) error {
+	jobs := tx.Model(&KBReembedJob{}).Select("id").Where(query, args...)
+	if err := tx.Where("job_id IN (?)", jobs).Delete(&KBStagedVector{}).Error; err != nil {
+		return err
+	}
+	return tx.Where(query, args...).Delete(&KBReembedJob{}).Error
+}
@@ -0,0 +1,236 @@
+//go:build cgo
+
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// seedReembedCollection 创建使用 oldModel 的集合：三个带向量的分片和一个没有向量的分片
+func seedReembedCollection(t *testing.T) (KnowledgeBaseCollection, []uint) {
+	t.Helper()
+	c := KnowledgeBaseCollection{Name: "手册", EmbeddingModel: "old.gguf"}
+	if err := DB.Create(&c).Error; err != nil {
+		t.Fatal(err)
+	}
+	f := KnowledgeBaseFile{CollectionID: c.ID, Path: "/docs/guide.md"}
+	if err := DB.Create(&f).Error; err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for i := range 4 {
+		ch := KnowledgeBaseChunk{FileID: f.ID, Content: "chunk"}
+		if i < 3 {
+			ch.Vector, ch.EmbeddingModel, ch.EmbeddingDim = []byte{1, 2, 3, 4}, "old.gguf", 1
+		}
+		if err := DB.Create(&ch).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, ch.ID)
+	}
+	return c, ids
+}
+
+func stageVectors(t *testing.T, jobID uint, ids ...uint) {
+	t.Helper()
+	vectors := make(map[uint][]byte, len(ids))
+	hashes := make(map[uint]string, len(ids))
+	for _, id := range ids {
+		var ch KnowledgeBaseChunk
+		if err := DB.First(&ch, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		vectors[id] = []byte{9, 9, 9, 9, 9, 9, 9, 9}
+		hashes[id] = ContentHash(ch.Content)
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error { return StageKBVectors(tx, jobID, vectors, hashes) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chunkModels 返回各分片当前的向量模型
+func chunkModels(t *testing.T, ids []uint) []string {
+	t.Helper()
+	models := make([]string, len(ids))
+	for i, id := range ids {
+		var ch KnowledgeBaseChunk
+		if err := DB.First(&ch, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		models[i] = ch.EmbeddingModel
+	}
+	return models
+}
+
+func countStaged(t *testing.T, jobID uint) int64 {
+	t.Helper()
+	var n int64
+	if err := DB.Model(&KBStagedVector{}).Where("job_id = ?", jobID).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestStartKBReembedJob(t *testing.T) {
+	openTestDB(t)
+	c, ids := seedReembedCollection(t)
+
+	job, err := StartKBReembedJob(c.ID, "old.gguf", "new.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Total != 3 || job.Status != JobQueued {
+		t.Fatalf("job = %+v, want 3 queued chunks (chunks without vectors are left to backfill)", job)
+	}
+	// 相同目标的未结束任务直接复用
+	again, err := StartKBReembedJob(c.ID, "old.gguf", "new.gguf")
+	if err != nil || again.ID != job.ID {
+		t.Fatalf("expected the active job to be reused, got %+v, %v", again, err)
+	}
+
+	// 目标不同时取消旧任务并删除其暂存向量，集合与分片保持原样
+	stageVectors(t, job.ID, ids[0])
+	other, err := StartKBReembedJob(c.ID, "old.gguf", "other.gguf")
+	if err != nil || other.ID == job.ID || other.Total != 3 {
+		t.Fatalf("expected a new job, got %+v, %v", other, err)
+	}
+	old := getReembedJob(t, job.ID)
+	if old.Status != JobCanceled || countStaged(t, job.ID) != 0 {
+		t.Errorf("superseded job = %+v with %d staged vectors", old, countStaged(t, job.ID))
+	}
+	if got := chunkModels(t, ids[:3]); got[0] != "old.gguf" {
+		t.Errorf("chunk models changed before cutover: %v", got)
+	}
+}
+
+func TestCutoverKBReembedJob(t *testing.T) {
+	openTestDB(t)
+	c, ids := seedReembedCollection(t)
+	job, err := StartKBReembedJob(c.ID, "old.gguf", "new.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 还有分片没有暂存向量时不切换，集合与分片保持旧模型
+	stageVectors(t, job.ID, ids[0], ids[1])
+	if done, err := CutoverKBReembedJob(job.ID); err != nil || done {
+		t.Fatalf("partial cutover = %v, %v; want false", done, err)
+	}
+	if got := chunkModels(t, ids[:3]); got[0] != "old.gguf" || got[1] != "old.gguf" {
+		t.Errorf("chunk models changed before all vectors were staged: %v", got)
+	}
+
+	// 切换中途出错时整个事务回滚：分片、集合、任务与暂存向量都不变
+	stageVectors(t, job.ID, ids[2])
+	boom := errors.New("boom")
+	const hook = "test:fail_collection_update"
+	if err := DB.Callback().Update().Before("gorm:update").Register(hook, func(tx *gorm.DB) {
+		if tx.Statement.Table == "knowledge_base_collections" {
+			tx.AddError(boom)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = CutoverKBReembedJob(job.ID)
+	DB.Callback().Update().Remove(hook)
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if got := chunkModels(t, ids[:3]); got[0] != "old.gguf" || got[2] != "old.gguf" {
+		t.Errorf("chunk vectors were switched although the cutover failed: %v", got)
+	}
+	if n := countStaged(t, job.ID); n != 3 {
+		t.Errorf("staged vectors after failed cutover = %d, want 3", n)
+	}
+	if j := getReembedJob(t, job.ID); j.Status != JobRunning {
+		t.Errorf("job status after failed cutover = %s, want running", j.Status)
+	}
+
+	// 全部暂存后一次性切换
+	if done, err := CutoverKBReembedJob(job.ID); err != nil || !done {
+		t.Fatalf("cutover = %v, %v; want true", done, err)
+	}
+	for i, m := range chunkModels(t, ids) {
+		want := "new.gguf"
+		if i == 3 {
+			want = "" // 没有向量的分片不在迁移范围内
+		}
+		if m != want {
+			t.Errorf("chunk %d model = %q, want %q", i, m, want)
+		}
+	}
+	var ch KnowledgeBaseChunk
+	DB.First(&ch, ids[0])
+	if ch.EmbeddingDim != 2 || len(ch.Vector) != 8 {
+		t.Errorf("chunk vector = %v (dim %d), want the staged vector", ch.Vector, ch.EmbeddingDim)
+	}
+	var got KnowledgeBaseCollection
+	DB.First(&got, c.ID)
+	if got.EmbeddingModel != "new.gguf" || countStaged(t, job.ID) != 0 {
+		t.Errorf("collection model = %q, %d staged vectors left", got.EmbeddingModel, countStaged(t, job.ID))
+	}
+	if j := getReembedJob(t, job.ID); j.Status != JobDone {
+		t.Errorf("job status = %s, want done", j.Status)
+	}
+	if _, err := CutoverKBReembedJob(job.ID); err == nil {
+		t.Errorf("expected error when cutting over a finished job")
+	}
+}
+
+func TestCutoverDropsStaleStagedVectors(t *testing.T) {
+	openTestDB(t)
+	c, ids := seedReembedCollection(t)
+	job, err := StartKBReembedJob(c.ID, "old.gguf", "new.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageVectors(t, job.ID, ids[:3]...)
+
+	// 文件重新导入：分片被删除后 rowid 被内容不同的新分片复用
+	var old KnowledgeBaseChunk
+	if err := DB.First(&old, ids[2]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Delete(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	reused := KnowledgeBaseChunk{BaseModel: BaseModel{ID: ids[2]}, FileID: old.FileID, Content: "rewritten", Vector: []byte{1, 2, 3, 4}, EmbeddingModel: "old.gguf", EmbeddingDim: 1}
+	if err := DB.Create(&reused).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧内容的暂存向量被丢弃，不切换；该分片重新进入待处理范围
+	if done, err := CutoverKBReembedJob(job.ID); err != nil || done {
+		t.Fatalf("cutover with a stale vector = %v, %v; want false", done, err)
+	}
+	if n := countStaged(t, job.ID); n != 2 {
+		t.Errorf("staged vectors = %d, want 2", n)
+	}
+	if j := getReembedJob(t, job.ID); j.Done != 2 {
+		t.Errorf("job done = %d, want 2", j.Done)
+	}
+	pending, err := ListKBChunksToReembed(job, 10)
+	if err != nil || len(pending) != 1 || pending[0].Content != "rewritten" {
+		t.Fatalf("chunks to re-embed = %+v, %v; want the rewritten chunk", pending, err)
+	}
+
+	stageVectors(t, job.ID, ids[2])
+	if done, err := CutoverKBReembedJob(job.ID); err != nil || !done {
+		t.Fatalf("cutover = %v, %v; want true", done, err)
+	}
+	if got := chunkModels(t, ids[:3]); got[2] != "new.gguf" {
+		t.Errorf("chunk models after cutover = %v", got)
+	}
+}
+
+func getReembedJob(t *testing.T, id uint) KBReembedJob {
+	t.Helper()
+	var job KBReembedJob
+	if err := DB.First(&job, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
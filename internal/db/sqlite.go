@@ -2,6 +2,7 @@ package db
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"log"
 	"math"
@@ -22,7 +23,8 @@ type BaseModel struct {
 
 type Conversation struct {
 	BaseModel
-	Title string
+	Title         string
+	CollectionIDs []uint `gorm:"serializer:json"` // 检索范围，为空表示全部集合
 }
 
 type Message struct {
@@ -40,22 +42,71 @@ type Setting struct {
 
 type KnowledgeBaseFile struct {
 	BaseModel
-	Path     string `gorm:"uniqueIndex"`
-	Checksum string
-	Size     int64
-	Status   string // "pending", "processed", "error"
-}
+	CollectionID uint   `gorm:"index"`
+	Path         string `gorm:"uniqueIndex"`
+	Checksum     string
+	Size         int64
+	Status       string // "pending", "processed", "error"
+
+	// 最近一次处理的诊断信息
+	Error       string     // 失败原因，处理成功后清空
+	FailedStage string     // 失败的阶段：extract/chunk/embed/store
+	Warnings    []string   `gorm:"serializer:json"` // 抽取器跳过的内容等非致命问题
+	ChunkCount  int        // 分片数
+	VectorCount int        // 已生成向量的分片数
+	ExtractMs   int64      // extract 阶段（抽取、切分与写入分片）耗时，毫秒
+	EmbedMs     int64      // embed 阶段累计耗时，毫秒
+	ProcessedAt *time.Time // 最近一次处理完成的时间
+}
+
+// 文件处理失败的阶段
+const (
+	FileStageExtract = "extract"
+	FileStageChunk   = "chunk"
+	FileStageEmbed   = "embed"
+	FileStageStore   = "store"
+)
 
 type KnowledgeBaseChunk struct {
 	BaseModel
-	FileID  uint
+	FileID  uint `gorm:"index"`
 	Content string
 	Vector  []byte // 向量表示，用于语义搜索
+	// 生成 Vector 的 embedding 模型与维度；只有与查询向量的模型一致时才参与语义检索
+	EmbeddingModel string `gorm:"default:''"`
+	EmbeddingDim   int    `gorm:"default:0"`
+	ChunkMeta
+}
+
+// ChunkMeta 分片的结构化元数据（作为 KnowledgeBaseChunk 的列存储），与文件格式无关的字段为 0/空
+type ChunkMeta struct {
+	Ordinal    int    `json:"ordinal"` // 分片在文件中的序号，从 1 开始
+	PageStart  int    `json:"page_start,omitempty"`
+	PageEnd    int    `json:"page_end,omitempty"`
+	Slide      int    `json:"slide,omitempty"`
+	Sheet      string `json:"sheet,omitempty"`
+	RowStart   int    `json:"row_start,omitempty"`
+	RowEnd     int    `json:"row_end,omitempty"`
+	Heading    string `json:"heading,omitempty"` // 标题路径，如 "安装 > Linux"
+	Symbol     string `json:"symbol,omitempty"`  // 源代码符号
+	LineStart  int    `json:"line_start,omitempty"`
+	LineEnd    int    `json:"line_end,omitempty"`
+	CharStart  int    `json:"char_start"` // 在所属分段（页、幻灯片、章节等）文本中的字符偏移
+	CharEnd    int    `json:"char_end"`
+	TokenCount int    `json:"token_count"`
+	OCR        bool   `json:"ocr,omitempty"` // 文本来自 OCR 识别（扫描页、图片）
+
+	// 邮件分片的发件人与发送时间（UTC），可作为检索过滤条件
+	Sender string     `json:"sender,omitempty" gorm:"index"`
+	SentAt *time.Time `json:"sent_at,omitempty" gorm:"index"`
 }
 
 const SystemPromptKey = "system_prompt"
 const KBFolderKey = "kb_folder"
 const KBEmbeddingModelKey = "kb_embedding_model"
+const KBChunkSettingsKey = "kb_chunk_settings"
+const KBOCRSettingsKey = "kb_ocr"
+const KBScanSettingsKey = "kb_scan"
 const DefaultSystemPrompt = "你是一个中文的助手，你会根据用户的问题回答用户的问题。"
 
 var DB *gorm.DB
@@ -74,9 +125,18 @@ func InitDB(dbPath string) {
 		log.Fatal("failed to connect database:", err)
 	}
 
-	if err := DB.AutoMigrate(&Conversation{}, &Message{}, &Setting{}, &KnowledgeBaseFile{}, &KnowledgeBaseChunk{}); err != nil {
+	if err := DB.AutoMigrate(&Conversation{}, &Message{}, &Setting{}, &KnowledgeBaseCollection{}, &KnowledgeBaseFile{}, &KnowledgeBaseChunk{}, &KBTable{}, &KBEmbeddingCache{}, &KBJob{}, &KBReembedJob{}, &KBStagedVector{}); err != nil {
 		log.Fatal("failed to migrate database:", err)
 	}
+	if err := migrateCollections(); err != nil {
+		log.Fatal("failed to migrate knowledge base collections:", err)
+	}
+	if err := migrateChunkOrdinals(); err != nil {
+		log.Fatal("failed to migrate knowledge base chunks:", err)
+	}
+	if err := migrateChunkEmbeddingModels(); err != nil {
+		log.Fatal("failed to migrate knowledge base chunk embeddings:", err)
+	}
 
 	c, err := GetOrCreateDefaultConversation()
 	if err != nil {
@@ -149,6 +209,16 @@ func UpdateConversationTitle(conversationID uint, title string) error {
 	return DB.Model(&Conversation{}).Where("id = ?", conversationID).Update("title", title).Error
 }
 
+// UpdateConversationCollections 设置对话检索的知识库集合，传空表示全部
+func UpdateConversationCollections(conversationID uint, collectionIDs []uint) error {
+	c, err := GetConversation(conversationID)
+	if err != nil {
+		return err
+	}
+	c.CollectionIDs = collectionIDs
+	return DB.Model(c).Select("collection_ids").Updates(c).Error
+}
+
 func UpdateMessageContent(conversationID uint, messageID uint, content string) error {
 	content = strings.TrimSpace(content)
 	return DB.Model(&Message{}).
@@ -243,13 +313,187 @@ func SetKBEmbeddingModel(model string) error {
 	return SetSetting(KBEmbeddingModelKey, model)
 }
 
+// ChunkSetting 某类文件的分片参数（按 token 计）
+type ChunkSetting struct {
+	ChunkSize    int `json:"chunk_size"`
+	ChunkOverlap int `json:"chunk_overlap"`
+}
+
+// GetKBChunkSettings 读取按文件类型（抽取器名称）配置的分片参数
+func GetKBChunkSettings() (map[string]ChunkSetting, error) {
+	settings := map[string]ChunkSetting{}
+	value, err := GetSetting(KBChunkSettingsKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return settings, nil
+		}
+		return nil, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return settings, nil
+	}
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetKBChunkSettings 保存按文件类型配置的分片参数
+func SetKBChunkSettings(settings map[string]ChunkSetting) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return SetSetting(KBChunkSettingsKey, string(b))
+}
+
+// OCRSettings 扫描件与图片的 OCR 配置。Languages 为 tesseract 的语言参数（如 "chi_sim+eng"），
+// 只能选择已安装的语言包；为空时自动选择。OCR 命令本身只能通过启动参数 -ocr-cmd 指定
+type OCRSettings struct {
+	Disabled  bool   `json:"disabled"`
+	Languages string `json:"languages"`
+}
+
+// GetKBOCRSettings 读取 OCR 配置，未设置时返回零值（启用、自动探测）
+func GetKBOCRSettings() (OCRSettings, error) {
+	var settings OCRSettings
+	value, err := GetSetting(KBOCRSettingsKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return settings, nil
+		}
+		return settings, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return settings, nil
+	}
+	err = json.Unmarshal([]byte(value), &settings)
+	return settings, err
+}
+
+// ScanSettings 知识库目录的扫描规则。Ignore 为 gitignore 语法的规则（以 ! 开头表示重新纳入），
+// 与各目录根下的 .kbignore 合并，.kbignore 在后、优先级更高
+type ScanSettings struct {
+	Ignore []string `json:"ignore"`
+	// MaxFileSizeMB 按文件类型（抽取器名称，如 "pdf"、"excel"）限制文件大小，"*" 为其余类型的默认上限；缺省或 0 表示不限制
+	MaxFileSizeMB  map[string]int `json:"max_file_size_mb"`
+	IncludeHidden  bool           `json:"include_hidden"`  // 扫描以 . 开头的隐藏目录
+	FollowSymlinks bool           `json:"follow_symlinks"` // 跟随符号链接；默认跳过并在同步进度中报告
+}
+
+// GetKBScanSettings 读取扫描规则，未设置时返回零值（不额外忽略、不限大小、跳过隐藏目录与符号链接）
+func GetKBScanSettings() (ScanSettings, error) {
+	var settings ScanSettings
+	value, err := GetSetting(KBScanSettingsKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return settings, nil
+		}
+		return settings, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return settings, nil
+	}
+	err = json.Unmarshal([]byte(value), &settings)
+	return settings, err
+}
+
+// SetKBScanSettings 保存扫描规则
+func SetKBScanSettings(settings ScanSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return SetSetting(KBScanSettingsKey, string(b))
+}
+
+// SetKBOCRSettings 保存 OCR 配置
+func SetKBOCRSettings(settings OCRSettings) error {
+	settings.Languages = strings.TrimSpace(settings.Languages)
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return SetSetting(KBOCRSettingsKey, string(b))
+}
+
 func ListKBFiles() ([]KnowledgeBaseFile, error) {
 	var files []KnowledgeBaseFile
 	err := DB.Find(&files).Error
 	return files, err
 }
 
-func SaveKBFile(path string, size int64, checksum string) (*KnowledgeBaseFile, error) {
+func GetKBFile(id uint) (*KnowledgeBaseFile, error) {
+	var f KnowledgeBaseFile
+	if err := DB.First(&f, id).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// FindKBFileByName 按文件名（不含目录）查找已索引的文件，同名时返回最早加入的一个；
+// 只用于只知道文件名的场景（上传后的预览），引用链接按文件 ID 定位
+func FindKBFileByName(name string) (*KnowledgeBaseFile, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(name)
+	var candidates []KnowledgeBaseFile
+	err := DB.Where(`path LIKE ? ESCAPE '\' OR path LIKE ? ESCAPE '\'`, "%/"+escaped, `%\`+escaped).
+		Order("id asc").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range candidates {
+		if filepath.Base(f.Path) == name {
+			return &f, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func GetKBFileByPath(path string) (*KnowledgeBaseFile, error) {
+	var f KnowledgeBaseFile
+	if err := DB.Where("path = ?", path).First(&f).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// migrateChunkOrdinals 为旧版本写入的分片补上序号（按写入顺序）；其他元数据在文件重新处理时填充
+func migrateChunkOrdinals() error {
+	return DB.Exec(`UPDATE knowledge_base_chunks SET ordinal = (
+		SELECT COUNT(*) FROM knowledge_base_chunks c
+		WHERE c.file_id = knowledge_base_chunks.file_id AND c.id <= knowledge_base_chunks.id
+	) WHERE ordinal = 0 OR ordinal IS NULL`).Error
+}
+
+// migrateChunkEmbeddingModels 为旧版本写入的向量补记模型（取所在集合记录的模型）与维度
+func migrateChunkEmbeddingModels() error {
+	return DB.Exec(`UPDATE knowledge_base_chunks SET
+		embedding_model = COALESCE((
+			SELECT c.embedding_model FROM knowledge_base_files f
+			JOIN knowledge_base_collections c ON c.id = f.collection_id
+			WHERE f.id = knowledge_base_chunks.file_id
+		), ''),
+		embedding_dim = LENGTH(vector) / 4
+		WHERE (embedding_model IS NULL OR embedding_model = '') AND vector IS NOT NULL AND LENGTH(vector) > 0`).Error
+}
+
+// GetKBFilesByIDs 按 ID 批量获取文件记录
+func GetKBFilesByIDs(ids []uint) (map[uint]KnowledgeBaseFile, error) {
+	files := make(map[uint]KnowledgeBaseFile, len(ids))
+	if len(ids) == 0 {
+		return files, nil
+	}
+	var list []KnowledgeBaseFile
+	if err := DB.Where("id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		files[f.ID] = f
+	}
+	return files, nil
+}
+
+func SaveKBFile(collectionID uint, path string, size int64, checksum string) (*KnowledgeBaseFile, error) {
 	var f KnowledgeBaseFile
 
 	// 先尝试查找记录
@@ -259,10 +503,11 @@ func SaveKBFile(path string, size int64, checksum string) (*KnowledgeBaseFile, e
 		if err == gorm.ErrRecordNotFound {
 			// 记录不存在，创建新记录
 			f = KnowledgeBaseFile{
-				Path:     path,
-				Size:     size,
-				Checksum: checksum,
-				Status:   "pending",
+				CollectionID: collectionID,
+				Path:         path,
+				Size:         size,
+				Checksum:     checksum,
+				Status:       "pending",
 			}
 			err = DB.Create(&f).Error
 			if err != nil {
@@ -273,8 +518,9 @@ func SaveKBFile(path string, size int64, checksum string) (*KnowledgeBaseFile, e
 			return nil, err
 		}
 	} else {
-		// 记录存在，检查是否需要更新
-		if f.Size != size || f.Checksum != checksum {
+		// 记录存在，检查是否需要更新（目录被划到其它集合时，按新集合的设置重新处理）
+		if f.Size != size || f.Checksum != checksum || f.CollectionID != collectionID {
+			f.CollectionID = collectionID
 			f.Size = size
 			f.Checksum = checksum
 			f.Status = "pending"
@@ -296,10 +542,137 @@ func DeleteKBChunks(fileID uint) error {
 	return DB.Where("file_id = ?", fileID).Delete(&KnowledgeBaseChunk{}).Error
 }
 
+// RenameKBFile 更新文件记录的路径（内容未变，仅移动/改名），已有分片保持关联
+func RenameKBFile(fileID uint, path string) error {
+	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Update("path", path).Error
+}
+
+// PurgeKBFiles 删除文件记录及其分片，但不删除磁盘上的文件（用于同步时清理已不存在的文件）
+func PurgeKBFiles(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id IN ?", ids).Delete(&KnowledgeBaseChunk{}).Error; err != nil {
+			return err
+		}
+		if err := dropKBTables(tx, "file_id IN ?", ids); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id IN ?", ids).Delete(&KBJob{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&KnowledgeBaseFile{}).Error
+	})
+}
+
+// withoutVector 分片没有 model 生成的向量（没有向量，或向量来自其他模型）
+const withoutVector = "(vector IS NULL OR LENGTH(vector) = 0 OR embedding_model <> ?)"
+
+// ListKBChunksWithoutVector 按序号取文件中尚未生成 model 向量的分片
+func ListKBChunksWithoutVector(fileID uint, model string, limit int) ([]KnowledgeBaseChunk, error) {
+	var chunks []KnowledgeBaseChunk
+	err := DB.Where("file_id = ?", fileID).Where(withoutVector, model).Order("ordinal asc, id asc").Limit(limit).Find(&chunks).Error
+	return chunks, err
+}
+
+// CountKBChunks 文件的分片总数与其中尚未生成 model 向量的分片数
+func CountKBChunks(fileID uint, model string) (total, missing int64, err error) {
+	if err = DB.Model(&KnowledgeBaseChunk{}).Where("file_id = ?", fileID).Count(&total).Error; err != nil {
+		return
+	}
+	err = DB.Model(&KnowledgeBaseChunk{}).Where("file_id = ?", fileID).Where(withoutVector, model).Count(&missing).Error
+	return
+}
+
+// backfillFiles 需要后台补齐向量的文件：已处理完成、没有未结束的任务，且所在集合的 embedding 模型
+// 与 model 一致或尚未记录（模型不一致的集合由重新生成向量任务整体迁移）
+func backfillFiles(model string) *gorm.DB {
+	return DB.Model(&KnowledgeBaseFile{}).
+		Where("status = ?", "processed").
+		Where("id NOT IN (?)", DB.Model(&KBJob{}).Select("file_id").Where("status IN ?", activeJobStatuses)).
+		Where("collection_id IN (?)", DB.Model(&KnowledgeBaseCollection{}).Select("id").Where("(embedding_model = '' OR embedding_model = ?)", model))
+}
+
+// ListKBFilesWithoutVector 需要后台补齐向量（仍有分片没有 model 向量）的文件，按 id 排序
+func ListKBFilesWithoutVector(model string) ([]KnowledgeBaseFile, error) {
+	var files []KnowledgeBaseFile
+	err := backfillFiles(model).
+		Where("id IN (?)", DB.Model(&KnowledgeBaseChunk{}).Select("file_id").Where(withoutVector, model)).
+		Order("id asc").Find(&files).Error
+	return files, err
+}
+
+// CountKBChunksWithoutVector 需要后台补齐向量的分片数
+func CountKBChunksWithoutVector(model string) (int64, error) {
+	var n int64
+	err := DB.Model(&KnowledgeBaseChunk{}).
+		Where(withoutVector, model).
+		Where("file_id IN (?)", backfillFiles(model).Select("id")).
+		Count(&n).Error
+	return n, err
+}
+
+// SaveKBChunkVectors 写入一批分片的向量，并记录生成向量的模型与维度
+func SaveKBChunkVectors(tx *gorm.DB, model string, vectors map[uint][]byte) error {
+	for id, v := range vectors {
+		err := tx.Model(&KnowledgeBaseChunk{}).Where("id = ?", id).
+			Updates(map[string]any{"vector": v, "embedding_model": model, "embedding_dim": len(v) / 4}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func UpdateKBFileStatus(fileID uint, status string) error {
 	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Update("status", status).Error
 }
 
+// RecordKBFileExtract 记录 extract 阶段的结果，并清空上次的错误与 embed 耗时
+func RecordKBFileExtract(fileID uint, chunks, vectors int, warnings []string, elapsed time.Duration) error {
+	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Select("chunk_count", "vector_count", "warnings", "extract_ms", "embed_ms", "error", "failed_stage").
+		Updates(KnowledgeBaseFile{ChunkCount: chunks, VectorCount: vectors, Warnings: warnings, ExtractMs: elapsed.Milliseconds()}).Error
+}
+
+// RecordKBFileEmbed 累加 embed 阶段耗时并按分片重新统计已有向量的数量（中途失败时也记录已完成的部分）
+func RecordKBFileEmbed(fileID uint, elapsed time.Duration) error {
+	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Updates(map[string]any{
+		"embed_ms":     gorm.Expr("embed_ms + ?", elapsed.Milliseconds()),
+		"vector_count": DB.Model(&KnowledgeBaseChunk{}).Select("COUNT(*)").Where("file_id = ? AND vector IS NOT NULL AND LENGTH(vector) > 0", fileID),
+	}).Error
+}
+
+// RecordKBFileError 记录处理失败的原因与阶段；final 为 true 时文件标记为 error，否则仍为待处理（等待重试）
+func RecordKBFileError(fileID uint, stage, msg string, final bool) error {
+	updates := map[string]any{"error": msg, "failed_stage": stage}
+	if final {
+		updates["status"] = "error"
+	}
+	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Updates(updates).Error
+}
+
+// MarkKBFileProcessed 文件处理完成：清空错误并记录完成时间
+func MarkKBFileProcessed(fileID uint) error {
+	return DB.Model(&KnowledgeBaseFile{}).Where("id = ?", fileID).Updates(map[string]any{
+		"status":       "processed",
+		"error":        "",
+		"failed_stage": "",
+		"processed_at": time.Now(),
+	}).Error
+}
+
+// ListFailedKBFiles 处理失败的文件；不指定集合时返回全部
+func ListFailedKBFiles(collectionIDs []uint) ([]KnowledgeBaseFile, error) {
+	q := DB.Where("status = ?", "error")
+	if len(collectionIDs) > 0 {
+		q = q.Where("collection_id IN ?", collectionIDs)
+	}
+	var files []KnowledgeBaseFile
+	err := q.Find(&files).Error
+	return files, err
+}
+
 // ChunkWithSimilarity 带相似度的chunk
 type ChunkWithSimilarity struct {
 	KnowledgeBaseChunk
@@ -345,8 +718,20 @@ func GetAllKBChunks() ([]KnowledgeBaseChunk, error) {
 	return chunks, err
 }
 
-// SearchKBChunks 使用传统文本搜索查找知识库分片
-func SearchKBChunks(query string, limit int) ([]KnowledgeBaseChunk, error) {
+// ChunkFilter 分片检索的过滤条件，零值字段不参与过滤
+type ChunkFilter struct {
+	CollectionIDs []uint
+	Sender        string    // 发件人姓名或地址的一部分
+	After, Before time.Time // 邮件发送时间范围 [After, Before)
+}
+
+// SearchKBChunks 使用传统文本搜索查找知识库分片；collectionIDs 为空表示搜索全部集合
+func SearchKBChunks(query string, limit int, collectionIDs []uint) ([]KnowledgeBaseChunk, error) {
+	return SearchKBChunksFiltered(query, limit, ChunkFilter{CollectionIDs: collectionIDs})
+}
+
+// SearchKBChunksFiltered 同 SearchKBChunks，附加发件人、时间等过滤条件
+func SearchKBChunksFiltered(query string, limit int, filter ChunkFilter) ([]KnowledgeBaseChunk, error) {
 	if limit <= 0 {
 		limit = 5
 	}
@@ -370,13 +755,33 @@ func SearchKBChunks(query string, limit int) ([]KnowledgeBaseChunk, error) {
 		return nil, nil
 	}
 
-	// 构造多关键词查询
-	tx := DB.Model(&KnowledgeBaseChunk{})
+	// 构造多关键词查询（OR 条件单独成组，避免与集合过滤混在一起）
+	var cond *gorm.DB
 	for _, word := range words {
 		if len(word) < 2 && !isChinese(word) { // 忽略过短的英文单词，但保留单个中文字（如果是中文环境）
 			continue
 		}
-		tx = tx.Or("content LIKE ?", "%"+word+"%")
+		if cond == nil {
+			cond = DB.Where("content LIKE ?", "%"+word+"%")
+		} else {
+			cond = cond.Or("content LIKE ?", "%"+word+"%")
+		}
+	}
+	tx := DB.Model(&KnowledgeBaseChunk{})
+	if cond != nil {
+		tx = tx.Where(cond)
+	}
+	if len(filter.CollectionIDs) > 0 {
+		tx = tx.Where("file_id IN (?)", DB.Model(&KnowledgeBaseFile{}).Select("id").Where("collection_id IN ?", filter.CollectionIDs))
+	}
+	if filter.Sender != "" {
+		tx = tx.Where("sender LIKE ?", "%"+filter.Sender+"%")
+	}
+	if !filter.After.IsZero() {
+		tx = tx.Where("sent_at >= ?", filter.After.UTC())
+	}
+	if !filter.Before.IsZero() {
+		tx = tx.Where("sent_at < ?", filter.Before.UTC())
 	}
 
 	err := tx.Limit(limit).Find(&chunks).Error
@@ -425,10 +830,25 @@ func ResetKnowledgeBase() error {
 	if err := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&KnowledgeBaseChunk{}).Error; err != nil {
 		return err
 	}
+	// 删除表格文件物化的 SQLite 表
+	if err := dropKBTables(DB, "1 = 1"); err != nil {
+		return err
+	}
+	// 删除所有的处理任务与重新生成向量任务
+	if err := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&KBJob{}).Error; err != nil {
+		return err
+	}
+	if err := deleteKBReembedJobs(DB, "1 = 1"); err != nil {
+		return err
+	}
 	// 删除所有的知识库文件记录
 	if err := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&KnowledgeBaseFile{}).Error; err != nil {
 		return err
 	}
+	// 重建后按当前模型重新记录 embedding 模型
+	if err := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(&KnowledgeBaseCollection{}).Update("embedding_model", "").Error; err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -442,6 +862,12 @@ func DeleteKBFile(id uint) error {
 	if err := DeleteKBChunks(id); err != nil {
 		return err
 	}
+	if err := DeleteKBTables(id); err != nil {
+		return err
+	}
+	if err := DB.Where("file_id = ?", id).Delete(&KBJob{}).Error; err != nil {
+		return err
+	}
 
 	// 2. Delete Record
 	if err := DB.Delete(&f).Error; err != nil {
@@ -471,6 +897,12 @@ func DeleteKBFiles(ids []uint) error {
 		if err := tx.Where("file_id IN ?", ids).Delete(&KnowledgeBaseChunk{}).Error; err != nil {
 			return err
 		}
+		if err := dropKBTables(tx, "file_id IN ?", ids); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id IN ?", ids).Delete(&KBJob{}).Error; err != nil {
+			return err
+		}
 
 		// 2. Delete Records
 		if err := tx.Where("id IN ?", ids).Delete(&KnowledgeBaseFile{}).Error; err != nil {
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 表格列在登记表中的类型；DATE 以 "2006-01-02[ 15:04:05]" 文本存储，可直接比较或用 strftime 处理
+const (
+	ColumnInteger = "INTEGER"
+	ColumnReal    = "REAL"
+	ColumnText    = "TEXT"
+	ColumnDate    = "DATE"
+)
+
+// KBTable 表格文件（xlsx/csv 等）中一个工作表物化出的 SQLite 表，供问答时生成 SQL 查询
+type KBTable struct {
+	BaseModel
+	FileID   uint          `gorm:"index"`
+	Sheet    string        // 工作表名；CSV 为文件名
+	Name     string        `gorm:"uniqueIndex"` // SQLite 表名，如 kb_table_12_1
+	Columns  []TableColumn `gorm:"serializer:json"`
+	RowCount int
+}
+
+// TableColumn 物化表的列：Name 即 SQL 列名（取自表头，已去重），Type 为 ColumnInteger 等
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableData 待物化的工作表，Rows 中的值为 int64、float64、string 或 nil，与 Columns 一一对应
+type TableData struct {
+	Sheet   string
+	Columns []TableColumn
+	Rows    [][]any
+}
+
+// KBTableName 文件第 n 个工作表（从 1 开始）对应的表名
+func KBTableName(fileID uint, n int) string {
+	return fmt.Sprintf("kb_table_%d_%d", fileID, n)
+}
+
+// QuoteIdent 按 SQLite 规则给标识符加双引号
+func QuoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// sqlType 列在建表语句中的类型；DATE 按文本存储，避免 NUMERIC 亲和性改写取值
+func sqlType(t string) string {
+	if t == ColumnDate {
+		return ColumnText
+	}
+	return t
+}
+
+// ReplaceKBTables 重建文件的物化表：删除旧表后按 tables 建表、写入数据并登记
+func ReplaceKBTables(fileID uint, tables []TableData) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := dropKBTables(tx, "file_id = ?", fileID); err != nil {
+			return err
+		}
+		for i, t := range tables {
+			if len(t.Columns) == 0 {
+				continue
+			}
+			name := KBTableName(fileID, i+1)
+			cols := make([]string, len(t.Columns))
+			for j, c := range t.Columns {
+				cols[j] = QuoteIdent(c.Name) + " " + sqlType(c.Type)
+			}
+			if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", QuoteIdent(name), strings.Join(cols, ", "))).Error; err != nil {
+				return fmt.Errorf("create table for sheet %s: %w", t.Sheet, err)
+			}
+			if err := insertTableRows(tx, name, len(t.Columns), t.Rows); err != nil {
+				return fmt.Errorf("insert rows for sheet %s: %w", t.Sheet, err)
+			}
+			record := KBTable{FileID: fileID, Sheet: t.Sheet, Name: name, Columns: t.Columns, RowCount: len(t.Rows)}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertTableRows 多行 INSERT 批量写入；每条语句的参数个数不超过 SQLite 的默认上限
+func insertTableRows(tx *gorm.DB, name string, width int, rows [][]any) error {
+	const maxParams = 900
+	perStmt := max(1, maxParams/width)
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", width), ", ") + ")"
+	for start := 0; start < len(rows); start += perStmt {
+		batch := rows[start:min(start+perStmt, len(rows))]
+		values := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*width)
+		for i, row := range batch {
+			values[i] = placeholder
+			args = append(args, row...)
+		}
+		stmt := fmt.Sprintf("INSERT INTO %s VALUES %s", QuoteIdent(name), strings.Join(values, ", "))
+		if err := tx.Exec(stmt, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropKBTables 删除满足条件的物化表及其登记
+func dropKBTables(tx *gorm.DB, query any, args ...any) error {
+	var tables []KBTable
+	if err := tx.Where(query, args...).Find(&tables).Error; err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := tx.Exec("DROP TABLE IF EXISTS " + QuoteIdent(t.Name)).Error; err != nil {
+			return err
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	return tx.Where(query, args...).Delete(&KBTable{}).Error
+}
+
+// DeleteKBTables 删除文件的物化表（文件不再是表格或抽取失败时）
+func DeleteKBTables(fileID uint) error {
+	return dropKBTables(DB, "file_id = ?", fileID)
+}
+
+// ListKBTables 列出已处理文件的物化表；collectionIDs 为空表示全部集合
+func ListKBTables(collectionIDs []uint) ([]KBTable, error) {
+	files := DB.Model(&KnowledgeBaseFile{}).Select("id").Where("status = ?", "processed")
+	if len(collectionIDs) > 0 {
+		files = files.Where("collection_id IN ?", collectionIDs)
+	}
+	var tables []KBTable
+	err := DB.Where("file_id IN (?)", files).Order("file_id asc, id asc").Find(&tables).Error
+	return tables, err
+}
+
+// ListTableNames 列出数据库中所有的表与视图名（用于校验生成的 SQL 只访问允许的表）
+func ListTableNames() ([]string, error) {
+	var names []string
+	err := DB.Raw("SELECT name FROM sqlite_master WHERE type IN ('table', 'view')").Scan(&names).Error
+	return names, err
+}
+
+// QueryReadOnly 在只读连接上执行一条 SELECT，最多返回 maxRows 行，超出时 truncated 为 true。
+// 连接在执行期间开启 query_only，即使语句校验有遗漏也无法写入
+func QueryReadOnly(ctx context.Context, query string, maxRows int) (columns []string, rows [][]string, truncated bool, err error) {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return nil, nil, false, err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+	}()
+
+	rs, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (%s) LIMIT %d", query, maxRows+1))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rs.Close()
+	if columns, err = rs.Columns(); err != nil {
+		return nil, nil, false, err
+	}
+	for rs.Next() {
+		if len(rows) == maxRows {
+			truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, nil, false, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = formatSQLValue(v)
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, truncated, rs.Err()
+}
+
+func formatSQLValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(v)
+}
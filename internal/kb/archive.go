@@ -0,0 +1,299 @@
+package kb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 压缩包内的文件作为独立文档索引，路径形如 "/docs/bundle.zip!/manual/install.pdf"
+const archiveSep = "!/"
+
+// 解压保护：条目数、单个条目与总计的解压后大小、压缩比（防 zip bomb）
+const (
+	maxArchiveEntries   = 10000
+	maxArchiveEntrySize = 200 << 20
+	maxArchiveTotalSize = 2 << 30
+	maxCompressionRatio = 200
+)
+
+var (
+	errArchiveTooLarge = errors.New("archive exceeds size limits (possible zip bomb)")
+	archiveEntryPath   = regexp.MustCompile(`(?i)\.(zip|tar|tgz|tar\.gz)!/`)
+)
+
+// archiveEntry 压缩包中可索引的文件
+type archiveEntry struct {
+	name string // 包内路径，使用 "/" 分隔
+	size int64  // 解压后大小
+}
+
+// isArchive 判断是否为支持展开的压缩包（.zip、.tar、.tar.gz、.tgz）
+func isArchive(p string) bool {
+	name := strings.ToLower(p)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArchivePath 拆分压缩包内文件的虚拟路径，返回压缩包路径与包内路径
+func splitArchivePath(p string) (archive, entry string, ok bool) {
+	loc := archiveEntryPath.FindStringIndex(p)
+	if loc == nil {
+		return "", "", false
+	}
+	sep := loc[1] - len(archiveSep)
+	return p[:sep], p[loc[1]:], true
+}
+
+// IsArchiveEntry 判断路径是否指向压缩包内的文件
+func IsArchiveEntry(p string) bool {
+	_, _, ok := splitArchivePath(p)
+	return ok
+}
+
+// archiveEntryName 规范化包内路径；绝对路径与 ".." 越界（zip slip）的条目返回空串
+func archiveEntryName(name string) string {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	return name
+}
+
+// isIndexableEntry 包内文件的过滤规则与目录扫描一致；不展开嵌套的压缩包
+func isIndexableEntry(name string) bool {
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".~") || isLockFile(name) || isArchive(name) || inIgnoredDir(name) {
+		return false
+	}
+	ext := path.Ext(name)
+	if !isSupportedExt(ext) {
+		return false
+	}
+	if isCodeExt(ext) {
+		for _, dir := range strings.Split(path.Dir(name), "/") {
+			if dependencyDirs[dir] {
+				return false
+			}
+		}
+		for _, suffix := range generatedSuffixes {
+			if strings.HasSuffix(strings.ToLower(base), suffix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// listArchive 列出压缩包中可索引的文件，超出解压保护限制时返回 errArchiveTooLarge
+func listArchive(p string) ([]archiveEntry, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		entries []archiveEntry
+		total   int64
+		count   int
+	)
+	add := func(name string, size int64) error {
+		count++
+		total += size
+		if count > maxArchiveEntries || size > maxArchiveEntrySize || total > maxArchiveTotalSize ||
+			(total > 1<<20 && total/max(info.Size(), 1) > maxCompressionRatio) {
+			return errArchiveTooLarge
+		}
+		if name = archiveEntryName(name); name != "" && isIndexableEntry(name) {
+			entries = append(entries, archiveEntry{name: name, size: size})
+		}
+		return nil
+	}
+
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if err := add(f.Name, int64(f.UncompressedSize64)); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	err = walkTar(p, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+		if hdr.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		return false, add(hdr.Name, hdr.Size)
+	})
+	return entries, err
+}
+
+// walkTar 顺序遍历 tar / tar.gz；fn 返回 true 时停止
+func walkTar(p string, fn func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if name := strings.ToLower(p); strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		// 跳过条目数据同样需要解压，整体限制解压量
+		r = io.LimitReader(gz, maxArchiveTotalSize+1)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stop, err := fn(hdr, tr)
+		if err != nil || stop {
+			return err
+		}
+	}
+}
+
+// readArchiveEntry 读取压缩包内的文件，实际解压量超过限制时报错（不信任条目头中的大小）
+func readArchiveEntry(archive, entry string) ([]byte, error) {
+	readLimited := func(r io.Reader) ([]byte, error) {
+		b, err := io.ReadAll(io.LimitReader(r, maxArchiveEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxArchiveEntrySize {
+			return nil, errArchiveTooLarge
+		}
+		return b, nil
+	}
+
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || archiveEntryName(f.Name) != entry {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return readLimited(rc)
+		}
+		return nil, fmt.Errorf("%s not found in %s: %w", entry, filepath.Base(archive), os.ErrNotExist)
+	}
+
+	var data []byte
+	found := false
+	err := walkTar(archive, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Typeflag != tar.TypeReg || archiveEntryName(hdr.Name) != entry {
+			return false, nil
+		}
+		found = true
+		b, err := readLimited(r)
+		data = b
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in %s: %w", entry, filepath.Base(archive), os.ErrNotExist)
+	}
+	return data, nil
+}
+
+// ReadArchiveEntry 读取虚拟路径指向的压缩包内文件
+func ReadArchiveEntry(p string) ([]byte, error) {
+	archive, entry, ok := splitArchivePath(p)
+	if !ok {
+		return nil, fmt.Errorf("not an archive entry: %s", p)
+	}
+	return readArchiveEntry(archive, entry)
+}
+
+// LocalFile 返回可直接打开的本地路径：压缩包内的文件解压到临时目录（保留原文件名以便按扩展名识别），
+// 用完后调用 cleanup 删除；普通文件原样返回
+func LocalFile(p string) (local string, cleanup func(), err error) {
+	archive, entry, ok := splitArchivePath(p)
+	if !ok {
+		return p, func() {}, nil
+	}
+	data, err := readArchiveEntry(archive, entry)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "kb-archive-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+	local = filepath.Join(dir, path.Base(entry))
+	if err := os.WriteFile(local, data, 0o600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return local, cleanup, nil
+}
+
+// FileExists 判断知识库文件是否存在；压缩包内的文件检查压缩包本身
+func FileExists(p string) bool {
+	if archive, _, ok := splitArchivePath(p); ok {
+		p = archive
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// scanArchive 把压缩包展开为包内可索引文件；checksum 由压缩包 checksum 与包内路径组成，
+// 压缩包变化时包内文件全部重新处理
+func scanArchive(p string) ([]scannedFile, error) {
+	entries, err := listArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := calculateMD5(p)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]scannedFile, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, scannedFile{
+			path:     p + archiveSep + e.name,
+			size:     e.size,
+			checksum: checksum + archiveSep + e.name,
+		})
+	}
+	return files, nil
+}
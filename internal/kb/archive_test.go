@@ -0,0 +1,79 @@
+package kb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEntries(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"docs/guide.md":        "# 安装\n\n解压后运行 setup。",
+		"docs/logo.bin":        "not indexable",
+		"__MACOSX/docs/._x.md": "resource fork",
+		"../escape.txt":        "zip slip",
+	}
+
+	zipPath := filepath.Join(dir, "bundle.zip")
+	zf, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	zf.Close()
+
+	tgzPath := filepath.Join(dir, "bundle.tar.gz")
+	tf, err := os.Create(tgzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(tf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	tf.Close()
+
+	for _, archive := range []string{zipPath, tgzPath} {
+		scanned, err := scanArchive(archive)
+		if err != nil {
+			t.Fatalf("scanArchive(%s): %v", archive, err)
+		}
+		if len(scanned) != 1 || scanned[0].path != archive+"!/docs/guide.md" || !strings.HasSuffix(scanned[0].checksum, "!/docs/guide.md") {
+			t.Fatalf("unexpected entries for %s: %+v", archive, scanned)
+		}
+		segs, reg, err := extractSegments(scanned[0].path)
+		if err != nil || reg.Name != "markdown" || len(segs) != 1 || segs[0].Meta.Heading != "安装" {
+			t.Errorf("extract %s: reg=%v segs=%+v err=%v", scanned[0].path, reg, segs, err)
+		}
+	}
+
+	// 高压缩比的条目视为 zip bomb
+	bombPath := filepath.Join(dir, "bomb.zip")
+	bf, _ := os.Create(bombPath)
+	bw := zip.NewWriter(bf)
+	w, _ := bw.Create("zeros.txt")
+	w.Write(make([]byte, 8<<20))
+	bw.Close()
+	bf.Close()
+	if _, err := listArchive(bombPath); !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("expected errArchiveTooLarge, got %v", err)
+	}
+}
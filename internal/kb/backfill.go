@@ -0,0 +1,179 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"knowledge/internal/db"
+	"knowledge/internal/llm"
+)
+
+const (
+	// backfillBatchSize 后台补齐向量时每批生成并提交的分片数（批次小，让出引擎时丢弃的工作少）
+	backfillBatchSize = 16
+	// backfillIdleDelay 最近一次交互请求结束后至少空闲这么久才开始补齐
+	backfillIdleDelay = 3 * time.Second
+	// backfillPoll 检查是否有需要补齐的分片、引擎是否空闲的间隔
+	backfillPoll = 5 * time.Second
+	// backfillMaxFailures 同一文件补齐连续失败的次数上限，达到后本次运行期间不再尝试
+	backfillMaxFailures = 3
+)
+
+// 后台补齐向量的状态
+const (
+	BackfillIdle    = "idle"    // 没有需要补齐的分片
+	BackfillWaiting = "waiting" // 引擎正被对话、同步或处理任务使用，等待空闲
+	BackfillRunning = "running"
+)
+
+// errBackfillYield 补齐过程中引擎变忙，暂停并让出引擎
+var errBackfillYield = errors.New("backfill yielded")
+
+// BackfillProgress 后台补齐向量的进度：导入时跳过向量的分片（如大表格）在引擎空闲时逐步生成向量
+type BackfillProgress struct {
+	Status      string `json:"status"`
+	Remaining   int64  `json:"remaining"` // 仍缺少向量的分片数
+	Embedded    int    `json:"embedded"`  // 本次启动以来补齐的分片数
+	CurrentFile string `json:"current_file,omitempty"`
+	Error       string `json:"error,omitempty"` // 最近一次失败的原因
+}
+
+// updateBackfill 修改后台补齐进度
+func (kb *KnowledgeBase) updateBackfill(fn func(p *BackfillProgress)) {
+	kb.progressMu.Lock()
+	defer kb.progressMu.Unlock()
+	fn(&kb.backfill)
+}
+
+// engineBusy 引擎是否正被交互请求、同步流程或处理任务使用（同步暂停或知识库关闭时同样视为忙）
+func (kb *KnowledgeBase) engineBusy() bool {
+	if kb.paused.Load() || kb.jobsClosing() || !llm.InteractiveIdle(backfillIdleDelay) {
+		return true
+	}
+	kb.syncMu.Lock()
+	syncing := kb.isSyncing
+	kb.syncMu.Unlock()
+	if syncing {
+		return true
+	}
+	kb.jobsMu.Lock()
+	defer kb.jobsMu.Unlock()
+	return len(kb.runningJobs) > 0
+}
+
+func (kb *KnowledgeBase) backfillLoop() {
+	timer := time.NewTimer(backfillPoll)
+	defer timer.Stop()
+	for {
+		select {
+		case <-kb.jobsDone:
+			return
+		case <-timer.C:
+		}
+		// 先迁移模型不一致的集合，切换后再补齐其中没有向量的分片
+		kb.runReembed()
+		kb.runBackfill()
+		timer.Reset(backfillPoll)
+	}
+}
+
+// runBackfill 在引擎空闲时逐个文件补齐向量，直到没有剩余分片、引擎变忙或补齐失败
+func (kb *KnowledgeBase) runBackfill() {
+	model := currentEmbeddingModel()
+	if model == "" {
+		kb.updateBackfill(func(p *BackfillProgress) { p.Status, p.Remaining, p.CurrentFile = BackfillIdle, 0, "" })
+		return
+	}
+	if kb.backfillFailures == nil {
+		kb.backfillFailures = make(map[uint]int)
+	}
+
+	for {
+		remaining, err := db.CountKBChunksWithoutVector(model)
+		if err != nil {
+			fmt.Printf("[KB] Failed to count chunks without vector: %v\n", err)
+			return
+		}
+		status := BackfillWaiting
+		if remaining == 0 {
+			status = BackfillIdle
+		}
+		kb.updateBackfill(func(p *BackfillProgress) { p.Status, p.Remaining, p.CurrentFile = status, remaining, "" })
+		if remaining == 0 || kb.engineBusy() {
+			return
+		}
+
+		files, err := db.ListKBFilesWithoutVector(model)
+		if err != nil {
+			fmt.Printf("[KB] Failed to list files without vector: %v\n", err)
+			return
+		}
+		var f *db.KnowledgeBaseFile
+		for i := range files {
+			if kb.backfillFailures[files[i].ID] < backfillMaxFailures {
+				f = &files[i]
+				break
+			}
+		}
+		if f == nil {
+			// 剩余的文件都已多次失败，等下次重启（或文件重新处理）后再尝试
+			kb.updateBackfill(func(p *BackfillProgress) { p.Status = BackfillIdle })
+			return
+		}
+
+		kb.updateBackfill(func(p *BackfillProgress) { p.Status, p.CurrentFile = BackfillRunning, f.Path })
+		err = kb.backfillFile(*f, model)
+		switch {
+		case errors.Is(err, errBackfillYield), errors.Is(err, errEmbeddingModelChanged):
+			kb.updateBackfill(func(p *BackfillProgress) { p.Status, p.CurrentFile = BackfillWaiting, "" })
+			return
+		case err != nil:
+			kb.backfillFailures[f.ID]++
+			fmt.Printf("[KB] Failed to backfill vectors for %s: %v\n", f.Path, err)
+			kb.updateBackfill(func(p *BackfillProgress) {
+				p.CurrentFile, p.Error = "", fmt.Sprintf("%s: %v", filepath.Base(f.Path), err)
+			})
+			return
+		}
+		delete(kb.backfillFailures, f.ID)
+		kb.updateBackfill(func(p *BackfillProgress) { p.Error = "" })
+	}
+}
+
+// backfillFile 为文件中缺少向量的分片分批生成向量；每个分片计算前检查引擎是否空闲，变忙时提交已完成的部分并让出
+func (kb *KnowledgeBase) backfillFile(f db.KnowledgeBaseFile, model string) error {
+	if collection, err := db.GetCollection(f.CollectionID); err == nil && collection.EmbeddingModel == "" {
+		_ = db.SetCollectionEmbeddingModel(collection.ID, model)
+	}
+
+	start := time.Now()
+	defer func() {
+		if err := db.RecordKBFileEmbed(f.ID, time.Since(start)); err != nil {
+			fmt.Printf("[KB] Failed to record embed stats for %s: %v\n", f.Path, err)
+		}
+	}()
+	for {
+		chunks, err := db.ListKBChunksWithoutVector(f.ID, model, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		n, err := embedChunks(chunks, model, saveChunkVectors(model), func(int) error {
+			if kb.engineBusy() {
+				return errBackfillYield
+			}
+			return nil
+		})
+		kb.updateBackfill(func(p *BackfillProgress) {
+			p.Embedded += n
+			p.Remaining = max(p.Remaining-int64(n), 0)
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package kb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// cfbMagic OLE2 复合文档（旧版 Office 二进制格式、加密的 OOXML）的文件头
+var cfbMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// errPasswordProtected 文件设置了打开密码，无法抽取内容
+var errPasswordProtected = errors.New("file is password-protected; remove the password and sync again")
+
+// hasFileMagic 判断文件是否以指定字节开头
+func hasFileMagic(path string, magic []byte) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, magic)
+}
+
+// readCFBStreams 读取复合文档根目录下指定名称的流；
+// 加密的 OOXML（docx/xlsx/pptx 设置打开密码后同样是复合文档）返回 errPasswordProtected
+func readCFBStreams(path string, names ...string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := mscfb.New(f)
+	if err != nil {
+		return nil, fmt.Errorf("read compound file: %w", err)
+	}
+
+	want := make(map[string]bool, len(names))
+	for _, name := range names {
+		want[name] = true
+	}
+	streams := make(map[string][]byte, len(names))
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if len(entry.Path) > 0 {
+			continue
+		}
+		if entry.Name == "EncryptedPackage" || entry.Name == "EncryptionInfo" {
+			return nil, errPasswordProtected
+		}
+		if !want[entry.Name] {
+			continue
+		}
+		b := make([]byte, entry.Size)
+		if _, err := io.ReadFull(entry, b); err != nil {
+			return nil, fmt.Errorf("read stream %s: %w", entry.Name, err)
+		}
+		streams[entry.Name] = b
+	}
+	return streams, nil
+}
@@ -0,0 +1,156 @@
+package kb
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+// writeCFB 生成只含根目录流的最小复合文档（版本 3，512 字节扇区）。
+// 流不足 4096 字节时补零，全部存放在普通扇区中，不需要 mini stream
+func writeCFB(t *testing.T, p string, streams map[string][]byte) {
+	t.Helper()
+	const (
+		sectorSize = 512
+		freeSect   = 0xFFFFFFFF
+		endOfChain = 0xFFFFFFFE
+		fatSect    = 0xFFFFFFFD
+		noStream   = 0xFFFFFFFF
+	)
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// 扇区 0 为 FAT，之后是目录扇区，再之后依次是各个流
+	fat := []uint32{fatSect}
+	dirSectors := (len(names) + 1 + 3) / 4
+	firstDir := uint32(len(fat))
+	for i := 0; i < dirSectors; i++ {
+		next := uint32(endOfChain)
+		if i < dirSectors-1 {
+			next = uint32(len(fat) + 1)
+		}
+		fat = append(fat, next)
+	}
+	var data []byte
+	starts := make([]uint32, len(names))
+	sizes := make([]int, len(names))
+	for i, name := range names {
+		b := streams[name]
+		if len(b) < 4096 {
+			b = append(slices.Clone(b), make([]byte, 4096-len(b))...)
+		}
+		sizes[i] = len(b)
+		starts[i] = uint32(len(fat))
+		n := (len(b) + sectorSize - 1) / sectorSize
+		for j := 0; j < n; j++ {
+			next := uint32(endOfChain)
+			if j < n-1 {
+				next = uint32(len(fat) + 1)
+			}
+			fat = append(fat, next)
+		}
+		data = append(data, b...)
+		if pad := len(data) % sectorSize; pad != 0 {
+			data = append(data, make([]byte, sectorSize-pad)...)
+		}
+	}
+	if len(fat) > sectorSize/4 {
+		t.Fatalf("test compound file too large")
+	}
+
+	header := make([]byte, sectorSize)
+	copy(header, cfbMagic)
+	le := binary.LittleEndian
+	le.PutUint16(header[24:], 0x003E)
+	le.PutUint16(header[26:], 3)
+	le.PutUint16(header[28:], 0xFFFE)
+	le.PutUint16(header[30:], 9)
+	le.PutUint16(header[32:], 6)
+	le.PutUint32(header[44:], 1)
+	le.PutUint32(header[48:], firstDir)
+	le.PutUint32(header[56:], 4096)
+	le.PutUint32(header[60:], endOfChain)
+	le.PutUint32(header[68:], endOfChain)
+	le.PutUint32(header[76:], 0)
+	for i := 1; i < 109; i++ {
+		le.PutUint32(header[76+i*4:], freeSect)
+	}
+
+	fatSector := make([]byte, sectorSize)
+	for i := range sectorSize / 4 {
+		v := uint32(freeSect)
+		if i < len(fat) {
+			v = fat[i]
+		}
+		le.PutUint32(fatSector[i*4:], v)
+	}
+
+	dir := make([]byte, dirSectors*sectorSize)
+	entry := func(i int, name string, typ byte, child, right, start uint32, size int) {
+		e := dir[i*128 : (i+1)*128]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			le.PutUint16(e[j*2:], c)
+		}
+		le.PutUint16(e[64:], uint16((len(u)+1)*2))
+		e[66], e[67] = typ, 1
+		le.PutUint32(e[68:], noStream)
+		le.PutUint32(e[72:], right)
+		le.PutUint32(e[76:], child)
+		le.PutUint32(e[116:], start)
+		le.PutUint32(e[120:], uint32(size))
+	}
+	child := uint32(noStream)
+	if len(names) > 0 {
+		child = 1
+	}
+	entry(0, "Root Entry", 5, child, noStream, endOfChain, 0)
+	for i, name := range names {
+		right := uint32(noStream)
+		if i < len(names)-1 {
+			right = uint32(i + 2)
+		}
+		entry(i+1, name, 2, noStream, right, starts[i], sizes[i])
+	}
+	for i := len(names) + 1; i < dirSectors*4; i++ {
+		e := dir[i*128:]
+		le.PutUint32(e[68:], noStream)
+		le.PutUint32(e[72:], noStream)
+		le.PutUint32(e[76:], noStream)
+	}
+
+	out := slices.Concat(header, fatSector, dir, data)
+	if err := os.WriteFile(p, out, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCFBStreams(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "plain.bin")
+	writeCFB(t, p, map[string][]byte{"Workbook": []byte("biff"), "Other": []byte("x")})
+	streams, err := readCFBStreams(p, "Workbook")
+	if err != nil {
+		t.Fatalf("readCFBStreams failed: %v", err)
+	}
+	if len(streams) != 1 || string(streams["Workbook"][:4]) != "biff" {
+		t.Errorf("expected only the requested stream, got %d streams", len(streams))
+	}
+
+	// 设置了打开密码的 OOXML 是含 EncryptedPackage 的复合文档
+	encrypted := filepath.Join(dir, "secret.docx")
+	writeCFB(t, encrypted, map[string][]byte{"EncryptionInfo": {4, 0, 4, 0}, "EncryptedPackage": []byte("cipher")})
+	if _, err := readCFBStreams(encrypted); !errors.Is(err, errPasswordProtected) {
+		t.Errorf("expected errPasswordProtected, got %v", err)
+	}
+	if _, _, _, err := extractDocument(encrypted); !errors.Is(err, errPasswordProtected) {
+		t.Errorf("expected extractDocument to report password protection, got %v", err)
+	}
+}
@@ -0,0 +1,424 @@
+package kb
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeChunkSize 源代码分片上限（rune）：超过的函数按行切开，小的相邻声明合并
+const codeChunkSize = 1500
+
+// codeMergeSize 小于该长度的相邻声明会合并到同一分片
+const codeMergeSize = 300
+
+// codeLanguage 语言的符号识别规则：匹配到的行视为一个声明的开始
+type codeLanguage struct {
+	// maxIndent 声明行允许的最大缩进（按空格计，tab 记为 4），用于识别类中的方法
+	maxIndent int
+	// patterns 符号名取命名分组 name（没有时取第一个分组）；
+	// kind 为空时取命名分组 kind，仍没有时取符号名前的关键字
+	patterns []codePattern
+	// comment 行首注释/注解前缀，紧挨声明的这些行并入该声明
+	comment []string
+}
+
+type codePattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+func codeRe(kind, expr string) codePattern {
+	return codePattern{kind: kind, re: regexp.MustCompile(expr)}
+}
+
+var (
+	cStyleComments = []string{"//", "/*", "*", "@", "#["}
+	hashComments   = []string{"#"}
+
+	// 控制语句看起来像方法调用/定义，需要排除
+	codeKeywords = map[string]bool{
+		"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+		"else": true, "do": true, "try": true, "new": true, "sizeof": true, "foreach": true,
+		"using": true, "lock": true, "synchronized": true, "elif": true, "with": true,
+	}
+
+	jsPatterns = []codePattern{
+		codeRe("function", `^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+([\w$]+)`),
+		codeRe("class", `^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([\w$]+)`),
+		codeRe("interface", `^(?:export\s+)?(?:declare\s+)?interface\s+([\w$]+)`),
+		codeRe("type", `^(?:export\s+)?(?:declare\s+)?type\s+([\w$]+)\s*(?:<[^=]*>)?\s*=`),
+		codeRe("enum", `^(?:export\s+)?(?:const\s+)?enum\s+([\w$]+)`),
+		codeRe("const", `^(?:export\s+)?(?:const|let|var)\s+([\w$]+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function|\([^)]*\)\s*(?::[^=]+)?=>|[\w$]+\s*=>)`),
+		codeRe("method", `^(?:(?:public|private|protected|static|readonly|async|override|get|set)\s+)*([\w$]+)\s*(?:<[^>]*>)?\([^;]*\)\s*(?::\s*[^{;]+)?\{\s*$`),
+	}
+	jvmPatterns = []codePattern{
+		codeRe("", `^(?:(?:public|private|protected|internal|static|final|abstract|sealed|data|open|partial|export)\s+)*(?:class|interface|enum|record|struct|object|trait)\s+(\w+)`),
+		codeRe("fun", `^(?:(?:public|private|protected|internal|override|suspend|inline|open)\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)`),
+		codeRe("method", `^(?:(?:public|private|protected|internal|static|final|abstract|synchronized|native|override|virtual|async|unsafe|extern|default)\s+)*(?:<[^>]*>\s+)?[\w<>\[\]?,.]+(?:\s*<[^>]*>)?\s+(\w+)\s*\([^;]*$`),
+	}
+	cPatterns = []codePattern{
+		codeRe("", `^(?:typedef\s+)?(?:struct|class|enum|union|namespace)\s+(\w+)\s*(?:[:{]|$)`),
+		codeRe("function", `^[\w\s\*&:<>,]*?[\w\*&>]\s+\**&?((?:\w+::)*~?\w+)\s*\([^;]*$`),
+	}
+
+	codeLanguages = map[string]*codeLanguage{
+		".go":    {maxIndent: 0, comment: []string{"//"}, patterns: []codePattern{codeRe("func", `^func\s+(?:\([^)]*\)\s*)?(\w+)`), codeRe("", `^(type|const|var)\s+(?P<name>\w+)`)}}, // 优先使用 go/ast 精确解析，语法错误时按规则兜底
+		".py":    {maxIndent: 4, comment: []string{"#", "@"}, patterns: []codePattern{codeRe("class", `^class\s+(\w+)`), codeRe("def", `^(?:async\s+)?def\s+(\w+)`)}},
+		".js":    {maxIndent: 4, comment: cStyleComments, patterns: jsPatterns},
+		".jsx":   {maxIndent: 4, comment: cStyleComments, patterns: jsPatterns},
+		".mjs":   {maxIndent: 4, comment: cStyleComments, patterns: jsPatterns},
+		".ts":    {maxIndent: 4, comment: cStyleComments, patterns: jsPatterns},
+		".tsx":   {maxIndent: 4, comment: cStyleComments, patterns: jsPatterns},
+		".java":  {maxIndent: 4, comment: cStyleComments, patterns: jvmPatterns},
+		".kt":    {maxIndent: 4, comment: cStyleComments, patterns: jvmPatterns},
+		".scala": {maxIndent: 4, comment: cStyleComments, patterns: append([]codePattern{codeRe("def", `^(?:(?:private|protected|override|final|implicit)\s+)*def\s+(\w+)`)}, jvmPatterns...)},
+		".cs":    {maxIndent: 8, comment: append([]string{"["}, cStyleComments...), patterns: jvmPatterns},
+		".swift": {maxIndent: 4, comment: cStyleComments, patterns: []codePattern{codeRe("", `^(?:(?:public|private|internal|open|final|fileprivate)\s+)*(?:class|struct|enum|protocol|extension)\s+(\w+)`), codeRe("func", `^(?:(?:public|private|internal|open|override|static|final|fileprivate|@\w+)\s+)*func\s+(\w+)`)}},
+		".c":     {maxIndent: 0, comment: cStyleComments, patterns: cPatterns},
+		".h":     {maxIndent: 0, comment: cStyleComments, patterns: cPatterns},
+		".cc":    {maxIndent: 4, comment: cStyleComments, patterns: cPatterns},
+		".cpp":   {maxIndent: 4, comment: cStyleComments, patterns: cPatterns},
+		".hpp":   {maxIndent: 4, comment: cStyleComments, patterns: cPatterns},
+		".rs":    {maxIndent: 4, comment: append([]string{"///"}, cStyleComments...), patterns: []codePattern{codeRe("fn", `^(?:pub(?:\([\w:]+\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"\w+"\s+)?fn\s+(\w+)`), codeRe("", `^(?:pub(?:\([\w:]+\))?\s+)?(?:struct|enum|trait|mod|union)\s+(\w+)`), codeRe("impl", `^(?:unsafe\s+)?impl(?:<[^>]*>)?\s+([\w:<>, ]+?)\s*(?:\{|where|$)`)}},
+		".rb":    {maxIndent: 2, comment: hashComments, patterns: []codePattern{codeRe("", `^(?:class|module)\s+([\w:]+)`), codeRe("def", `^def\s+([\w.?!=]+)`)}},
+		".php":   {maxIndent: 4, comment: append([]string{"#"}, cStyleComments...), patterns: []codePattern{codeRe("", `^(?:(?:abstract|final)\s+)?(?:class|interface|trait|enum)\s+(\w+)`), codeRe("function", `^(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?(\w+)`)}},
+		".lua":   {maxIndent: 0, comment: []string{"--"}, patterns: []codePattern{codeRe("function", `^(?:local\s+)?function\s+([\w.:]+)`)}},
+		".sh":    {maxIndent: 0, comment: hashComments, patterns: []codePattern{codeRe("function", `^(?:function\s+)?([\w-]+)\s*\(\)\s*\{?`)}},
+		".sql": {maxIndent: 0, comment: []string{"--", "/*", "*"}, patterns: []codePattern{
+			codeRe("", `(?i)^(?:create|alter)\s+(?:or\s+replace\s+)?(?:(?:temporary|temp|unique|materialized)\s+)*(?P<kind>table|view|function|procedure|index|trigger|type|sequence|schema)\s+(?:if\s+not\s+exists\s+)?(?P<name>[\w."\x60\[\]]+)`),
+			codeRe("statement", `(?i)^(select|insert|update|delete|with|drop|grant)\b`),
+		}},
+	}
+)
+
+func init() {
+	exts := make([]string, 0, len(codeLanguages))
+	for ext := range codeLanguages {
+		exts = append(exts, ext)
+	}
+	RegisterExtractor(Registration{
+		Name:       "code",
+		Exts:       exts,
+		Extractor:  ExtractorFunc(extractCode),
+		ChunkSize:  codeChunkSize,
+		Chunked:    true,
+		RawPreview: true,
+	})
+}
+
+// isCodeExt 判断扩展名是否为源代码
+func isCodeExt(ext string) bool {
+	_, ok := codeLanguages[strings.ToLower(ext)]
+	return ok
+}
+
+// codeSpan 一个声明覆盖的行范围（从 1 开始，含首尾）
+type codeSpan struct {
+	symbol     string
+	start, end int
+}
+
+// extractCode 按函数/类型等声明边界切分源代码，分片带仓库内路径、符号名与行号
+func extractCode(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src := strings.ReplaceAll(string(b), "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+	ext := strings.ToLower(filepath.Ext(path))
+
+	var spans []codeSpan
+	if ext == ".go" {
+		spans = goSpans(path, b)
+	}
+	if spans == nil {
+		spans = regexSpans(lines, codeLanguages[ext])
+	}
+	spans = mergeSmallSpans(splitLargeSpans(spans, lines), lines)
+
+	rel := repoRelativePath(path)
+	segments := make([]Segment, 0, len(spans))
+	for _, sp := range spans {
+		text := strings.Join(lines[sp.start-1:sp.end], "\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		segments = append(segments, Segment{
+			Text: text,
+			Meta: SegmentMeta{File: rel, Symbol: sp.symbol, LineStart: sp.start, LineEnd: sp.end},
+		})
+	}
+	return segments, nil
+}
+
+// goSpans 用 go/ast 获取顶层声明（含文档注释）的精确行范围；解析失败返回 nil
+func goSpans(path string, src []byte) []codeSpan {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var spans []codeSpan
+	for _, decl := range f.Decls {
+		start, end := line(decl.Pos()), line(decl.End())
+		var symbol string
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = line(d.Doc.Pos())
+			}
+			symbol = "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol = "func (" + goTypeName(d.Recv.List[0].Type) + ") " + d.Name.Name
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = line(d.Doc.Pos())
+			}
+			var names []string
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						names = append(names, n.Name)
+					}
+				}
+			}
+			symbol = d.Tok.String()
+			if len(names) > 0 {
+				symbol += " " + strings.Join(names, ", ")
+			}
+		}
+		spans = append(spans, codeSpan{symbol: symbol, start: start, end: end})
+	}
+
+	// 文件头（package 子句与之前的注释）
+	first := line(f.End()) + 1
+	if len(spans) > 0 {
+		first = spans[0].start
+	}
+	if first > 1 {
+		spans = append([]codeSpan{{symbol: "package " + f.Name.Name, start: 1, end: first - 1}}, spans...)
+	}
+	return fillGaps(spans, line(f.End()))
+}
+
+func goTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + goTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		return goTypeName(t.X)
+	case *ast.IndexListExpr:
+		return goTypeName(t.X)
+	case *ast.SelectorExpr:
+		return goTypeName(t.X) + "." + t.Sel.Name
+	}
+	return "?"
+}
+
+// fillGaps 让相邻声明首尾相接（声明之间的注释、空行并入后一个声明），保证不丢行
+func fillGaps(spans []codeSpan, lastLine int) []codeSpan {
+	for i := range spans {
+		if i+1 < len(spans) {
+			spans[i].end = max(spans[i].end, spans[i+1].start-1)
+		} else {
+			spans[i].end = max(spans[i].end, lastLine)
+		}
+	}
+	return spans
+}
+
+// regexSpans 按语言规则识别声明行，声明从匹配行（连同其上紧挨的注释/注解）开始，到下一个声明之前结束
+func regexSpans(lines []string, lang *codeLanguage) []codeSpan {
+	if lang == nil || len(lang.patterns) == 0 {
+		return []codeSpan{{start: 1, end: len(lines)}}
+	}
+
+	var spans []codeSpan
+	for i, raw := range lines {
+		if codeIndent(raw) > lang.maxIndent {
+			continue
+		}
+		trimmed := strings.TrimSpace(raw)
+		symbol := matchSymbol(trimmed, lang.patterns)
+		if symbol == "" {
+			continue
+		}
+		start := i
+		for start > 0 && hasAnyPrefix(strings.TrimSpace(lines[start-1]), lang.comment) {
+			start--
+		}
+		if len(spans) > 0 && start+1 <= spans[len(spans)-1].start {
+			continue // 多行签名或注释已归入上一个声明
+		}
+		spans = append(spans, codeSpan{symbol: symbol, start: start + 1})
+	}
+
+	if len(spans) == 0 || spans[0].start > 1 {
+		spans = append([]codeSpan{{start: 1}}, spans...)
+	}
+	for i := range spans {
+		spans[i].end = spans[i].start
+	}
+	return fillGaps(spans, len(lines))
+}
+
+func matchSymbol(line string, patterns []codePattern) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || codeKeywords[strings.TrimRight(fields[0], "(")] {
+		return ""
+	}
+	for _, p := range patterns {
+		m := p.re.FindStringSubmatch(line)
+		if m == nil || len(m) < 2 {
+			continue
+		}
+		nameIdx := 1
+		if i := p.re.SubexpIndex("name"); i > 0 {
+			nameIdx = i
+		}
+		name := strings.TrimSpace(m[nameIdx])
+		if name == "" || codeKeywords[name] {
+			continue
+		}
+
+		kind := p.kind
+		if kind == "statement" {
+			// SQL 独立语句只记录语句类型
+			return strings.ToUpper(name)
+		}
+		if i := p.re.SubexpIndex("kind"); kind == "" && i > 0 {
+			kind = strings.ToLower(m[i])
+		}
+		if kind == "" {
+			// 取符号名之前的最后一个关键字，如 "public class Foo" -> "class"
+			for _, f := range fields {
+				if strings.HasPrefix(f, name) {
+					break
+				}
+				kind = f
+			}
+		}
+		if kind == "" {
+			return name
+		}
+		return kind + " " + name
+	}
+	return ""
+}
+
+func codeIndent(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return 0 // 空行
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	if s == "" {
+		return false
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func spanRunes(sp codeSpan, lines []string) int {
+	n := 0
+	for _, l := range lines[sp.start-1 : sp.end] {
+		n += utf8.RuneCountInString(l) + 1
+	}
+	return n
+}
+
+// splitLargeSpans 超长声明按行切成不超过 codeChunkSize 的若干段，行号保持准确
+func splitLargeSpans(spans []codeSpan, lines []string) []codeSpan {
+	var out []codeSpan
+	for _, sp := range spans {
+		if spanRunes(sp, lines) <= codeChunkSize {
+			out = append(out, sp)
+			continue
+		}
+		start, size := sp.start, 0
+		for ln := sp.start; ln <= sp.end; ln++ {
+			n := utf8.RuneCountInString(lines[ln-1]) + 1
+			if size > 0 && size+n > codeChunkSize {
+				out = append(out, codeSpan{symbol: sp.symbol, start: start, end: ln - 1})
+				start, size = ln, 0
+			}
+			size += n
+		}
+		out = append(out, codeSpan{symbol: sp.symbol, start: start, end: sp.end})
+	}
+	return out
+}
+
+// mergeSmallSpans 合并相邻的小声明（如连续的常量、短函数），减少碎片分片
+func mergeSmallSpans(spans []codeSpan, lines []string) []codeSpan {
+	var out []codeSpan
+	for _, sp := range spans {
+		if len(out) > 0 {
+			prev := &out[len(out)-1]
+			prevSize, size := spanRunes(*prev, lines), spanRunes(sp, lines)
+			if (prevSize < codeMergeSize || size < codeMergeSize) && prevSize+size <= codeChunkSize && prev.end+1 == sp.start {
+				prev.end = sp.end
+				switch {
+				case prev.symbol == "":
+					prev.symbol = sp.symbol
+				case sp.symbol != "" && len(prev.symbol) < 120 && !strings.HasSuffix(prev.symbol, sp.symbol):
+					prev.symbol += ", " + sp.symbol
+				}
+				continue
+			}
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+// repoRelativePath 返回相对于所在仓库根目录（含 .git 的最近上级目录）的路径；找不到仓库时返回文件名
+func repoRelativePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	for dir := filepath.Dir(abs); ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				return filepath.ToSlash(rel)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return filepath.Base(path)
+}
@@ -0,0 +1,186 @@
+package kb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:      "csv",
+		Exts:      []string{".csv", ".tsv"},
+		MIMETypes: []string{"text/csv", "text/tab-separated-values"},
+		Extractor: ExtractorFunc(extractCsv),
+		Records:   true,
+		Tables:    csvSheet,
+	})
+}
+
+// csvDelimiters 候选分隔符，按常见程度排列（得分相同时取靠前的）
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// extractCsv 与 Excel 相同的行级语义编码：首行为表头，每行编码为“列名: 值”，
+// 多行合并为大小受限的分段。自动识别编码（UTF-8/UTF-16/GBK）与分隔符
+func extractCsv(path string) ([]Segment, error) {
+	r, err := openCsv(path)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := newRecordEncoder(path, "CSV")
+	if err != nil {
+		return nil, err
+	}
+	enc.encodeSheet(filepath.Base(path), csvRows(r))
+	return enc.chunks, nil
+}
+
+// csvSheet CSV 作为以文件名命名的单个工作表
+func csvSheet(path string, sheet SheetFunc) error {
+	r, err := openCsv(path)
+	if err != nil {
+		return err
+	}
+	sheet(filepath.Base(path), csvRows(r))
+	return nil
+}
+
+// openCsv 识别编码与分隔符后返回宽松模式的 csv.Reader（允许各行列数不同、不规范的引号）
+func openCsv(path string) (*csv.Reader, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := decodeText(raw)
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = detectDelimiter(text)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r, nil
+}
+
+// csvRows 逐行读取，行号为记录在文件中的起始行（从 1 开始，空行也计数，与用表格软件打开时一致）；
+// 无法解析的行跳过
+func csvRows(r *csv.Reader) iter.Seq2[int, []string] {
+	return func(yield func(int, []string) bool) {
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			line, _ := r.FieldPos(0)
+			if !yield(line, row) {
+				return
+			}
+		}
+	}
+}
+
+// decodeText 按 BOM 或内容识别文本编码并转为 UTF-8：UTF-8（可带 BOM）、UTF-16 LE/BE，
+// 其余不是合法 UTF-8 的内容按 GB18030（兼容 GBK/GB2312）解码
+func decodeText(b []byte) string {
+	var dec *encoding.Decoder
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		dec = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		dec = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+	default:
+		if order, ok := guessUTF16(b); ok {
+			dec = unicode.UTF16(order, unicode.IgnoreBOM).NewDecoder()
+		} else if utf8.Valid(b) {
+			return string(b)
+		} else {
+			dec = simplifiedchinese.GB18030.NewDecoder()
+		}
+	}
+	out, err := dec.Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(out)
+}
+
+// guessUTF16 识别不带 BOM 的 UTF-16：ASCII 为主的文本每两个字节中有一个是 0
+func guessUTF16(b []byte) (unicode.Endianness, bool) {
+	n := min(len(b), 1024) &^ 1
+	if n < 4 {
+		return unicode.LittleEndian, false
+	}
+	var even, odd int
+	for i := 0; i < n; i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	half := n / 2
+	switch {
+	case odd*10 > half*3 && even*10 < half:
+		return unicode.LittleEndian, true
+	case even*10 > half*3 && odd*10 < half:
+		return unicode.BigEndian, true
+	}
+	return unicode.LittleEndian, false
+}
+
+// detectDelimiter 取前若干行中每行出现次数一致且最多的候选分隔符（忽略引号内的字符），默认逗号
+func detectDelimiter(text string) rune {
+	sample := strings.SplitN(text, "\n", 21)
+	if len(sample) > 20 {
+		sample = sample[:20]
+	}
+	var lines []string
+	for _, line := range sample {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	best, bestScore := ',', 0
+	for _, d := range csvDelimiters {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			counts[countOutsideQuotes(line, d)]++
+		}
+		// 得分：最常见的非零列数出现的行数 × 分隔符个数
+		score := 0
+		for n, freq := range counts {
+			if n > 0 && freq*n > score && freq*2 >= len(lines) {
+				score = freq * n
+			}
+		}
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
+
+func countOutsideQuotes(line string, d rune) int {
+	n, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
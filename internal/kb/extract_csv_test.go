@@ -0,0 +1,46 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestExtractCsvRecords(t *testing.T) {
+	dir := t.TempDir()
+	src := "学号;姓名;成绩\nCHN2024-01-122;张三;88\n\nCHN2024-01-123;李四;95\n"
+
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(strings.ReplaceAll(src, ";", "\t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"gbk.csv":    gbk,
+		"utf16.tsv":  utf16,
+		"quoted.csv": "学号,姓名,成绩\nCHN2024-01-122,\"张, 三\",88\n\nCHN2024-01-123,李四,95\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		segs, err := extractCsv(path)
+		if err != nil {
+			t.Fatalf("extractCsv(%s): %v", name, err)
+		}
+		if len(segs) != 1 || segs[0].Meta.RowStart != 2 || segs[0].Meta.RowEnd != 4 {
+			t.Fatalf("%s: expected one chunk for rows 2-4, got %+v", name, segs)
+		}
+		want := "工作表: " + name + "；行: 4；学号: CHN2024-01-123；姓名: 李四；成绩: 95；"
+		if !strings.Contains(segs[0].Text, want) {
+			t.Errorf("%s: missing %q in:\n%s", name, want, segs[0].Text)
+		}
+	}
+}
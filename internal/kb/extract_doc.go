@@ -0,0 +1,211 @@
+package kb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "doc",
+		Exts:         []string{".doc"},
+		MIMETypes:    []string{"application/msword"},
+		Extractor:    ExtractorFunc(extractDoc),
+		ChunkSize:    480,
+		ChunkOverlap: 80,
+	})
+}
+
+// extractDoc 读取 Word 97-2003 文档正文（按片段表 Clx 拼接文本，只取主文档部分）
+func extractDoc(path string) ([]Segment, error) {
+	streams, err := readCFBStreams(path, "WordDocument", "0Table", "1Table")
+	if err != nil {
+		return nil, err
+	}
+	wordDoc, ok := streams["WordDocument"]
+	if !ok {
+		return nil, fmt.Errorf("not a word document (no WordDocument stream)")
+	}
+	text, err := parseWord97(wordDoc, streams)
+	if err != nil {
+		return nil, err
+	}
+	return []Segment{{Text: text}}, nil
+}
+
+var errDocTruncated = errors.New("doc: file is truncated or corrupt")
+
+// parseWord97 解析 FIB，定位表流中的 Clx 片段表并按字符位置还原主文档文本（[MS-DOC] 2.4.1）
+func parseWord97(wordDoc []byte, streams map[string][]byte) (string, error) {
+	if len(wordDoc) < 154 || binary.LittleEndian.Uint16(wordDoc) != 0xA5EC {
+		return "", fmt.Errorf("doc: invalid file header")
+	}
+	if nFib := binary.LittleEndian.Uint16(wordDoc[2:]); nFib < 101 {
+		return "", fmt.Errorf("word 6.0/95 documents are not supported; save as .docx and sync again")
+	}
+	flags := binary.LittleEndian.Uint16(wordDoc[10:])
+	if flags&0x0100 != 0 || flags&0x8000 != 0 {
+		// fEncrypted / fObfuscated
+		return "", fmt.Errorf("doc: %w", errPasswordProtected)
+	}
+	tableName := "0Table"
+	if flags&0x0200 != 0 {
+		tableName = "1Table"
+	}
+	table, ok := streams[tableName]
+	if !ok {
+		return "", fmt.Errorf("doc: table stream %s not found", tableName)
+	}
+
+	// FibBase(32) csw(2) fibRgW(csw*2) cslw(2) fibRgLw(cslw*4) cbRgFcLcb(2) fibRgFcLcb
+	pos := 32
+	csw := int(binary.LittleEndian.Uint16(wordDoc[pos:]))
+	pos += 2 + csw*2
+	if pos+2 > len(wordDoc) {
+		return "", errDocTruncated
+	}
+	cslw := int(binary.LittleEndian.Uint16(wordDoc[pos:]))
+	rgLw := pos + 2
+	pos = rgLw + cslw*4
+	if cslw < 4 || pos+2 > len(wordDoc) {
+		return "", errDocTruncated
+	}
+	ccpText := int(binary.LittleEndian.Uint32(wordDoc[rgLw+12:]))
+	rgFcLcb := pos + 2
+	// fcClx/lcbClx 是 FibRgFcLcb97 中的第 34 对
+	clxAt := rgFcLcb + 33*8
+	if clxAt+8 > len(wordDoc) {
+		return "", errDocTruncated
+	}
+	fcClx := int(binary.LittleEndian.Uint32(wordDoc[clxAt:]))
+	lcbClx := int(binary.LittleEndian.Uint32(wordDoc[clxAt+4:]))
+	if lcbClx == 0 || fcClx+lcbClx > len(table) {
+		return "", errDocTruncated
+	}
+	clx := table[fcClx : fcClx+lcbClx]
+
+	// 跳过 Prc（clxt=0x01），找到 Pcdt（clxt=0x02）
+	for len(clx) > 0 && clx[0] == 0x01 {
+		if len(clx) < 3 {
+			return "", errDocTruncated
+		}
+		clx = clx[3+int(binary.LittleEndian.Uint16(clx[1:])):]
+	}
+	if len(clx) < 5 || clx[0] != 0x02 {
+		return "", fmt.Errorf("doc: piece table not found")
+	}
+	lcb := int(binary.LittleEndian.Uint32(clx[1:]))
+	plc := clx[5:]
+	if lcb > len(plc) || lcb < 4 {
+		return "", errDocTruncated
+	}
+	plc = plc[:lcb]
+
+	// PlcPcd：(n+1) 个 CP + n 个 8 字节 Pcd
+	n := (lcb - 4) / 12
+	var sb strings.Builder
+	decoder := charmap.Windows1252.NewDecoder()
+	for i := 0; i < n; i++ {
+		cpStart := int(binary.LittleEndian.Uint32(plc[i*4:]))
+		cpEnd := int(binary.LittleEndian.Uint32(plc[(i+1)*4:]))
+		if cpStart >= ccpText {
+			break
+		}
+		cpEnd = min(cpEnd, ccpText)
+		count := cpEnd - cpStart
+		if count <= 0 {
+			continue
+		}
+
+		pcd := plc[(n+1)*4+i*8:]
+		fc := binary.LittleEndian.Uint32(pcd[2:])
+		if fc&0x40000000 != 0 {
+			// 压缩存储：单字节 cp1252
+			off := int(fc&0x3FFFFFFF) / 2
+			if off+count > len(wordDoc) {
+				return "", errDocTruncated
+			}
+			s, err := decoder.Bytes(wordDoc[off : off+count])
+			if err != nil {
+				return "", fmt.Errorf("doc: %w", err)
+			}
+			sb.Write(s)
+			continue
+		}
+		off := int(fc)
+		if off+count*2 > len(wordDoc) {
+			return "", errDocTruncated
+		}
+		u := make([]uint16, count)
+		for j := range u {
+			u[j] = binary.LittleEndian.Uint16(wordDoc[off+j*2:])
+		}
+		sb.WriteString(string(utf16.Decode(u)))
+	}
+	return cleanWordText(sb.String()), nil
+}
+
+// cleanWordText 处理 Word 特殊字符：段落/单元格标记转换为换行与制表符，
+// 域代码只保留结果部分，去掉对象锚点等控制字符
+func cleanWordText(s string) string {
+	var (
+		sb         strings.Builder
+		fieldDepth int
+		inCode     []bool // 每层域当前是否处于代码部分
+		lastCell   bool
+	)
+	for _, r := range s {
+		switch r {
+		case 0x13: // 域开始
+			fieldDepth++
+			inCode = append(inCode, true)
+			continue
+		case 0x14: // 域分隔符：之后为域结果
+			if fieldDepth > 0 {
+				inCode[fieldDepth-1] = false
+			}
+			continue
+		case 0x15: // 域结束
+			if fieldDepth > 0 {
+				fieldDepth--
+				inCode = inCode[:fieldDepth]
+			}
+			continue
+		}
+		if fieldDepth > 0 && inCode[fieldDepth-1] {
+			continue
+		}
+
+		switch r {
+		case 0x07: // 单元格结束；连续两个表示行结束
+			if lastCell {
+				sb.WriteString("\n")
+				lastCell = false
+				continue
+			}
+			sb.WriteString("\t")
+			lastCell = true
+			continue
+		case '\r', 0x0B, 0x0C, 0x0E:
+			sb.WriteString("\n")
+		case 0x1E:
+			sb.WriteString("-")
+		case 0xA0:
+			sb.WriteString(" ")
+		case 0x01, 0x02, 0x05, 0x08, 0x1F:
+			// 对象锚点、脚注引用、可选连字符
+		default:
+			if r < 0x20 && r != '\t' {
+				continue
+			}
+			sb.WriteRune(r)
+		}
+		lastCell = false
+	}
+	return collapseBlankLines(sb.String())
+}
@@ -0,0 +1,91 @@
+package kb
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// buildTestWordDocument 拼装 Word 97 的 WordDocument 流与 1Table 表流：
+// 片段表中一段 cp1252 压缩文本、一段 UTF-16 文本（含域代码与表格），以及主文档之外的脚注片段
+func buildTestWordDocument(flags uint16) (wordDoc, table []byte) {
+	const textAt, unicodeAt = 1024, 1200
+	compressed := []byte("Caf\xe9 menu\r")
+	unicode := "\x13HYPERLINK \"http://x\"\x14链接\x15\ra\x07b\x07\x07\r"
+	footnote := "脚注"
+	ccpText := len(compressed) + len([]rune(unicode))
+
+	wordDoc = make([]byte, 2048)
+	le := binary.LittleEndian
+	le.PutUint16(wordDoc[0:], 0xA5EC)
+	le.PutUint16(wordDoc[2:], 193)
+	le.PutUint16(wordDoc[10:], flags|0x0200) // fWhichTblStm：使用 1Table
+	pos := 32
+	le.PutUint16(wordDoc[pos:], 14) // csw
+	pos += 2 + 14*2
+	le.PutUint16(wordDoc[pos:], 22) // cslw
+	rgLw := pos + 2
+	le.PutUint32(wordDoc[rgLw+12:], uint32(ccpText))
+	pos = rgLw + 22*4
+	le.PutUint16(wordDoc[pos:], 93) // cbRgFcLcb
+	clxAt := pos + 2 + 33*8
+
+	copy(wordDoc[textAt:], compressed)
+	text16 := utf16le(unicode + footnote)
+	copy(wordDoc[unicodeAt:], text16)
+
+	// Clx：一个 Prc（应被跳过）加 Pcdt
+	cps := []uint32{0, uint32(len(compressed)), uint32(ccpText), uint32(ccpText + len([]rune(footnote)))}
+	fcs := []uint32{textAt*2 | 0x40000000, unicodeAt, uint32(unicodeAt + len(utf16le(unicode)))}
+	var plc []byte
+	for _, cp := range cps {
+		plc = le.AppendUint32(plc, cp)
+	}
+	for _, fc := range fcs {
+		plc = append(plc, 0, 0)
+		plc = le.AppendUint32(plc, fc)
+		plc = append(plc, 0, 0)
+	}
+	table = slices.Concat([]byte{0x01}, u16(2), []byte{0, 0}, []byte{0x02}, le.AppendUint32(nil, uint32(len(plc))), plc)
+	le.PutUint32(wordDoc[clxAt:], 0)
+	le.PutUint32(wordDoc[clxAt+4:], uint32(len(table)))
+	return wordDoc, table
+}
+
+func TestExtractDoc(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "menu.doc")
+	wordDoc, table := buildTestWordDocument(0)
+	writeCFB(t, p, map[string][]byte{"WordDocument": wordDoc, "1Table": table})
+
+	segments, err := extractDoc(p)
+	if err != nil {
+		t.Fatalf("extractDoc failed: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("expected one segment, got %+v", segments)
+	}
+	// 压缩片段按 cp1252 解码；域只保留结果；单元格标记转换为制表符；主文档之外的脚注不包含
+	text := segments[0].Text
+	if !strings.HasPrefix(text, "Café menu\n链接\na\tb") {
+		t.Errorf("unexpected text %q", text)
+	}
+	if strings.Contains(text, "HYPERLINK") || strings.Contains(text, "脚注") {
+		t.Errorf("expected field code and footnote to be excluded, got %q", text)
+	}
+
+	// 加密文档与缺少表流的文档
+	wordDoc, table = buildTestWordDocument(0x0100)
+	writeCFB(t, p, map[string][]byte{"WordDocument": wordDoc, "1Table": table})
+	if _, err := extractDoc(p); !errors.Is(err, errPasswordProtected) {
+		t.Errorf("expected errPasswordProtected, got %v", err)
+	}
+	wordDoc, _ = buildTestWordDocument(0)
+	writeCFB(t, p, map[string][]byte{"WordDocument": wordDoc})
+	if _, err := extractDoc(p); err == nil || !strings.Contains(err.Error(), "1Table") {
+		t.Errorf("expected missing table stream error, got %v", err)
+	}
+}
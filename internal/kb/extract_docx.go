@@ -0,0 +1,26 @@
+package kb
+
+import (
+	"github.com/lu4p/cat"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:      "docx",
+		Exts:      []string{".docx"},
+		MIMETypes: []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		Extractor: ExtractorFunc(func(path string) ([]Segment, error) {
+			text, err := extractTextFromDocx(path)
+			if err != nil {
+				return nil, err
+			}
+			return []Segment{{Text: text}}, nil
+		}),
+		ChunkSize:    480,
+		ChunkOverlap: 80,
+	})
+}
+
+func extractTextFromDocx(path string) (string, error) {
+	return cat.File(path)
+}
@@ -0,0 +1,349 @@
+package kb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "email",
+		Exts:         []string{".eml", ".mbox"},
+		MIMETypes:    []string{"application/mbox"},
+		Extractor:    ExtractorFunc(extractEmail),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+}
+
+// maxEmailDepth 附件中嵌套邮件的最大递归深度
+const maxEmailDepth = 4
+
+var (
+	// 回复引用的开头："On ... wrote:"、"在 ... 写道："、Outlook 的原始邮件分隔线
+	emailReplyHeader = regexp.MustCompile(`(?i)^(on\s.+\swrote:|在.+写道[：:]|-{2,}\s*(original message|原始邮件)\s*-{2,}|_{10,})\s*$`)
+	emailWordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+	emailAddrParser  = &mail.AddressParser{WordDecoder: emailWordDecoder}
+)
+
+// extractEmail 解析单封邮件（.eml）或邮箱归档（.mbox），每封邮件一个分段，
+// 记录主题、发件人与发送时间；正文去掉回复引用，可解析的附件经同一套抽取器递归抽取
+func extractEmail(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var warnings Warnings
+	if !bytes.HasPrefix(b, []byte("From ")) {
+		segments, err := parseEmail(b, 0, &warnings)
+		if err != nil {
+			return nil, err
+		}
+		return segments, warnings.err()
+	}
+
+	var segments []Segment
+	for i, raw := range splitMbox(b) {
+		segs, err := parseEmail(raw, 0, &warnings)
+		if err != nil {
+			warnings.warnf("Failed to parse message %d of %s: %v", i+1, filepath.Base(path), err)
+			continue
+		}
+		segments = append(segments, segs...)
+	}
+	return segments, warnings.err()
+}
+
+// splitMbox 按 "From " 分隔行拆分 mbox，并还原正文中被转义的 ">From "
+func splitMbox(b []byte) [][]byte {
+	var (
+		msgs [][]byte
+		cur  bytes.Buffer
+		prev = true // 上一行是否为空行；文件首行视为空行之后
+	)
+	flush := func() {
+		if len(bytes.TrimSpace(cur.Bytes())) > 0 {
+			msgs = append(msgs, bytes.Clone(cur.Bytes()))
+		}
+		cur.Reset()
+	}
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if prev && bytes.HasPrefix(line, []byte("From ")) {
+			flush()
+			prev = false
+			continue
+		}
+		prev = len(bytes.TrimRight(line, "\r\n")) == 0
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			line = line[1:]
+		}
+		cur.Write(line)
+	}
+	flush()
+	return msgs
+}
+
+// parseEmail 解析一封邮件：正文作为一个分段，附件的分段随后；无法解析的附件记入 warnings
+func parseEmail(raw []byte, depth int, warnings *Warnings) ([]Segment, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse email: %w", err)
+	}
+	h := msg.Header
+	meta := SegmentMeta{Heading: decodeEmailHeader(h.Get("Subject"))}
+	if from, err := emailAddrParser.ParseList(h.Get("From")); err == nil && len(from) > 0 {
+		meta.Sender = formatAddress(from[0])
+	} else {
+		meta.Sender = decodeEmailHeader(h.Get("From"))
+	}
+	if date, err := h.Date(); err == nil {
+		meta.SentAt = date
+	}
+
+	p := &emailParts{depth: depth, warnings: warnings}
+	if err := p.walk(textproto.MIMEHeader(h), msg.Body); err != nil {
+		return nil, err
+	}
+
+	// 发件人、主题与时间已在位置标签中，正文只补充收件人
+	var sb strings.Builder
+	for _, f := range []struct{ key, label string }{{"To", "收件人"}, {"Cc", "抄送"}} {
+		if v := formatAddressList(h.Get(f.key)); v != "" {
+			fmt.Fprintf(&sb, "%s: %s\n", f.label, v)
+		}
+	}
+	body := stripQuotedReply(p.body())
+	if body != "" {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(body)
+	}
+
+	segments := []Segment{{Text: sb.String(), Meta: meta}}
+	for _, att := range p.attachments {
+		for _, s := range att {
+			// 附件沿用所在邮件的发件人与时间；附带的邮件保留自己的
+			if s.Meta.Sender == "" {
+				s.Meta.Sender, s.Meta.SentAt = meta.Sender, meta.SentAt
+			}
+			s.Meta.Heading = joinHeading(meta.Heading, s.Meta.Heading)
+			segments = append(segments, s)
+		}
+	}
+	return segments, nil
+}
+
+// emailParts 遍历 MIME 结构时收集的正文与附件
+type emailParts struct {
+	depth       int
+	warnings    *Warnings
+	plain       []string
+	html        []string
+	attachments [][]Segment
+}
+
+func (p *emailParts) body() string {
+	if len(p.plain) > 0 {
+		return strings.TrimSpace(strings.Join(p.plain, "\n\n"))
+	}
+	return strings.TrimSpace(strings.Join(p.html, "\n\n"))
+}
+
+func (p *emailParts) walk(header textproto.MIMEHeader, r io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read email part: %w", err)
+			}
+			if err := p.walk(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("decode email part: %w", err)
+	}
+
+	filename := emailPartFilename(header)
+	switch {
+	case mediaType == "message/rfc822":
+		if p.depth >= maxEmailDepth {
+			return nil
+		}
+		segs, err := parseEmail(data, p.depth+1, p.warnings)
+		if err != nil {
+			p.warnings.warnf("Failed to parse attached email: %v", err)
+			return nil
+		}
+		p.attachments = append(p.attachments, segs)
+	case filename != "":
+		p.extractAttachment(filename, data)
+	case mediaType == "text/plain":
+		p.plain = append(p.plain, decodeCharset(data, params["charset"]))
+	case mediaType == "text/html":
+		if segs, err := extractHTML(data, header.Get("Content-Type")); err == nil {
+			p.html = append(p.html, renderSegments(segs))
+		}
+	}
+	return nil
+}
+
+// extractAttachment 把附件写入临时文件后交给对应的抽取器；不支持的类型直接忽略
+func (p *emailParts) extractAttachment(filename string, data []byte) {
+	name := filepath.Base(filepath.Clean("/" + filename))
+	if _, ok := extractorForExt(strings.ToLower(filepath.Ext(name))); !ok {
+		return
+	}
+	dir, err := os.MkdirTemp("", "kb-email-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, name)
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return
+	}
+	segs, _, warnings, err := extractDocument(tmp)
+	if err != nil {
+		p.warnings.warnf("Failed to extract attachment %s: %v", name, err)
+		return
+	}
+	for _, w := range warnings {
+		*p.warnings = append(*p.warnings, "附件 "+name+": "+w)
+	}
+	for i := range segs {
+		if segs[i].Meta.File == "" {
+			segs[i].Meta.File = name
+		}
+		// 附件分段的标题路径以附件名开头，便于在引用中区分
+		segs[i].Meta.Heading = joinHeading("附件 "+name, segs[i].Meta.Heading)
+	}
+	p.attachments = append(p.attachments, segs)
+}
+
+// emailPartFilename 返回附件文件名（Content-Disposition 或 Content-Type 的 name 参数），正文部分返回空串
+func emailPartFilename(header textproto.MIMEHeader) string {
+	disposition, params, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := params["filename"]
+	if name == "" {
+		_, ctParams, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		name = ctParams["name"]
+	}
+	if name == "" && disposition == "attachment" {
+		name = "attachment"
+	}
+	return decodeEmailHeader(name)
+}
+
+// stripQuotedReply 去掉回复中引用的原文（">" 开头的行、"On ... wrote:" 之后的内容）与签名
+func stripQuotedReply(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	var out []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if emailReplyHeader.MatchString(trimmed) || line == "-- " {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(collapseBlankLines(strings.Join(out, "\n")))
+}
+
+// decodeCharset 按 charset 参数把正文转为 UTF-8（常见 GBK/GB2312 邮件），无法识别时原样返回
+func decodeCharset(data []byte, label string) string {
+	if label == "" {
+		return string(data)
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return string(data)
+	}
+	return string(b)
+}
+
+// decodeEmailHeader 解码 RFC 2047 编码的邮件头（如 =?GBK?B?...?=）
+func decodeEmailHeader(s string) string {
+	if decoded, err := emailWordDecoder.DecodeHeader(s); err == nil {
+		s = decoded
+	}
+	return strings.TrimSpace(s)
+}
+
+// formatAddress 格式化为 "姓名 <地址>"，没有姓名时只保留地址
+func formatAddress(a *mail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.Name + " <" + a.Address + ">"
+}
+
+func formatAddressList(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	list, err := emailAddrParser.ParseList(s)
+	if err != nil {
+		return decodeEmailHeader(s)
+	}
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = formatAddress(a)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// joinHeading 拼接标题路径，忽略空的部分
+func joinHeading(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, " > ")
+}
+
+// emailDate 邮件时间在位置标签中的显示格式
+func emailDate(t time.Time) string {
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,72 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractEmail(t *testing.T) {
+	dir := t.TempDir()
+	eml := "From: =?UTF-8?B?5byg5LiJ?= <zhangsan@example.com>\r\n" +
+		"To: team@example.com\r\n" +
+		"Subject: =?UTF-8?B?5ZGo5Lya57qq6KaB?=\r\n" +
+		"Date: Fri, 01 Mar 2024 10:00:00 +0800\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"决定下周发布 2.0。\r\n\r\n" +
+		"On Thu, Feb 29, 2024 at 9:00 AM Li Si <lisi@example.com> wrote:\r\n" +
+		"> 要不要推迟发布？\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+		"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"5Y+R5biD5riF5Y2V\r\n" +
+		"--b1--\r\n"
+	path := filepath.Join(dir, "decision.eml")
+	if err := os.WriteFile(path, []byte(eml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	segs, err := extractEmail(path)
+	if err != nil {
+		t.Fatalf("extractEmail: %v", err)
+	}
+	if len(segs) != 2 {
+		t.Fatalf("expected body and attachment segments, got %+v", segs)
+	}
+	body := segs[0]
+	if body.Meta.Heading != "周会纪要" || body.Meta.Sender != "张三 <zhangsan@example.com>" || body.Meta.SentAt.IsZero() {
+		t.Errorf("unexpected email meta: %+v", body.Meta)
+	}
+	if !strings.Contains(body.Text, "收件人: team@example.com") || !strings.Contains(body.Text, "决定下周发布") || strings.Contains(body.Text, "推迟") {
+		t.Errorf("unexpected email body: %q", body.Text)
+	}
+	if want := "周会纪要 · 张三 <zhangsan@example.com> · 2024-03-01 10:00"; body.Meta.Label() != want {
+		t.Errorf("Label() = %q, want %q", body.Meta.Label(), want)
+	}
+	if att := segs[1]; att.Text != "发布清单" || att.Meta.Heading != "周会纪要 > 附件 notes.txt" || att.Meta.Sender != body.Meta.Sender {
+		t.Errorf("unexpected attachment segment: %+v", att)
+	}
+
+	mbox := "From alice@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: alice@example.com\nSubject: first\n\nhello\n>From the archive\n\n" +
+		"From bob@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: bob@example.com\nSubject: second\n\nworld\n"
+	path = filepath.Join(dir, "archive.mbox")
+	if err := os.WriteFile(path, []byte(mbox), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	segs, err = extractEmail(path)
+	if err != nil {
+		t.Fatalf("extractEmail mbox: %v", err)
+	}
+	if len(segs) != 2 || segs[0].Meta.Sender != "alice@example.com" || segs[1].Meta.Heading != "second" {
+		t.Fatalf("unexpected mbox segments: %+v", segs)
+	}
+	if segs[0].Text != "hello\nFrom the archive" {
+		t.Errorf("expected unescaped From line, got %q", segs[0].Text)
+	}
+}
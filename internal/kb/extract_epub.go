@@ -0,0 +1,140 @@
+package kb
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "epub",
+		Exts:         []string{".epub"},
+		MIMETypes:    []string{"application/epub+zip"},
+		Extractor:    ExtractorFunc(extractEpub),
+		ChunkSize:    480,
+		ChunkOverlap: 80,
+	})
+}
+
+// epubPackage OPF 包文件中与正文顺序相关的部分
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEpub 按 spine 阅读顺序抽取各章节 XHTML，章节内仍按标题切分
+func extractEpub(p string) ([]Segment, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	// encryption.xml 也可能只用于字体混淆，只有正文被加密时才视为 DRM 保护
+	encrypted := make(map[string]bool)
+	if f := files["META-INF/encryption.xml"]; f != nil {
+		var doc struct {
+			Data []struct {
+				Ref struct {
+					URI string `xml:"URI,attr"`
+				} `xml:"CipherData>CipherReference"`
+			} `xml:"EncryptedData"`
+		}
+		if err := decodeZipXML(f, &doc); err == nil {
+			for _, d := range doc.Data {
+				encrypted[d.Ref.URI] = true
+			}
+		}
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := decodeZipXML(files["META-INF/container.xml"], &container); err != nil {
+		return nil, fmt.Errorf("read epub container: %w", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("epub container has no rootfile")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := decodeZipXML(files[opfPath], &pkg); err != nil {
+		return nil, fmt.Errorf("read epub package: %w", err)
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	var segments []Segment
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok || ref.Linear == "no" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		f := files[path.Join(path.Dir(opfPath), href)]
+		if f == nil {
+			continue
+		}
+		if encrypted[f.Name] {
+			return nil, fmt.Errorf("epub is DRM-protected and cannot be indexed")
+		}
+		b, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		chapter, err := extractHTML(b, "")
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f.Name, err)
+		}
+		segments = append(segments, chapter...)
+	}
+	return segments, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	if f == nil {
+		return fmt.Errorf("file not found")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
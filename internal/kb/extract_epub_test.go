@@ -0,0 +1,58 @@
+package kb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractEpub(t *testing.T) {
+	chapter := func(title, body string) string {
+		return `<html xmlns="http://www.w3.org/1999/xhtml"><body><h1>` + title + `</h1><p>` + body + `</p></body></html>`
+	}
+	files := map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles>` +
+			`<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf"><manifest>` +
+			`<item id="c1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>` +
+			`<item id="c2" href="text/ch%202.xhtml" media-type="application/xhtml+xml"/>` +
+			`<item id="toc" href="toc.xhtml" media-type="application/xhtml+xml"/>` +
+			`<item id="css" href="style.css" media-type="text/css"/>` +
+			`</manifest><spine><itemref idref="c2"/><itemref idref="toc" linear="no"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/text/ch1.xhtml":  chapter("第一章", "起点"),
+		"OEBPS/text/ch 2.xhtml": chapter("第二章", "终点"),
+		"OEBPS/toc.xhtml":       chapter("目录", "第一章 第二章"),
+	}
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "book.epub")
+	writeZip(t, p, files)
+	segments, err := extractEpub(p)
+	if err != nil {
+		t.Fatalf("extractEpub failed: %v", err)
+	}
+	// 按 spine 顺序，跳过 linear="no" 的目录页；href 中的转义字符被还原
+	if len(segments) != 2 || segments[0].Meta.Heading != "第二章" || segments[1].Meta.Heading != "第一章" {
+		t.Fatalf("expected chapters in spine order, got %+v", segments)
+	}
+	if !strings.Contains(segments[1].Text, "起点") {
+		t.Errorf("expected chapter body, got %q", segments[1].Text)
+	}
+
+	// 只有字体被混淆时仍可索引；正文被加密时报错
+	encryption := func(uri string) string {
+		return `<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">` +
+			`<enc:EncryptedData><enc:CipherData><enc:CipherReference URI="` + uri + `"/></enc:CipherData></enc:EncryptedData></encryption>`
+	}
+	files["META-INF/encryption.xml"] = encryption("OEBPS/fonts/font.otf")
+	writeZip(t, p, files)
+	if _, err := extractEpub(p); err != nil {
+		t.Errorf("expected font obfuscation to be ignored, got %v", err)
+	}
+	files["META-INF/encryption.xml"] = encryption("OEBPS/text/ch1.xhtml")
+	writeZip(t, p, files)
+	if _, err := extractEpub(p); err == nil || !strings.Contains(err.Error(), "DRM") {
+		t.Errorf("expected DRM error, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package kb
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name: "excel",
+		Exts: []string{".xlsx", ".xls"},
+		MIMETypes: []string{
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			"application/vnd.ms-excel",
+		},
+		Extractor: ExtractorFunc(extractIndexChunksFromXlsx),
+		Records:   true,
+		Tables:    workbookSheets,
+	})
+}
+
+// workbookSheets 依次回调 Excel 的各个工作表
+func workbookSheets(path string, sheet SheetFunc) error {
+	wb, err := OpenWorkbook(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = wb.Close()
+	}()
+	for _, name := range wb.SheetNames() {
+		sheet(name, wb.Rows(name))
+	}
+	return nil
+}
+
+// extractIndexChunksFromXlsx 按行级语义编码抽取 Excel 各工作表（xlsx 与旧版 xls）
+func extractIndexChunksFromXlsx(path string) ([]Segment, error) {
+	wb, err := OpenWorkbook(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = wb.Close()
+	}()
+
+	enc, err := newRecordEncoder(path, "Excel")
+	if err != nil {
+		return nil, err
+	}
+	for _, sheet := range wb.SheetNames() {
+		enc.encodeSheet(sheet, wb.Rows(sheet))
+	}
+	return enc.chunks, nil
+}
+
+// recordEncoder 行级语义编码：每行编码为“工作表 + 行号 + 列名:值”，
+// 多行合并为大小受限的分段（记录不会被截断），更适合按编号/成绩查询。
+// Excel、ODS 等表格格式共用同一编码，保证检索行为一致。
+type recordEncoder struct {
+	path             string
+	source           string
+	maxProcessRows   int
+	targetChunkChars int
+	chunks           []Segment
+}
+
+func newRecordEncoder(path, source string) (*recordEncoder, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	fileSize := fileInfo.Size()
+
+	// 最大处理行数：文件大小每增加1MB，增加1000行，最大不超过200000行
+	maxProcessRows := int(fileSize/(1024*1024)) * 1000
+	if maxProcessRows < 1000 {
+		maxProcessRows = 1000
+	}
+	if maxProcessRows > 200000 {
+		maxProcessRows = 200000
+	}
+
+	// chunk 越小需要算的 embedding 越多，会显著拖慢大文件导入。
+	// 对大文件提高 chunk 字符数上限，减少 embedding 次数，但仍保证“按行/按记录”可检索。
+	targetChunkChars := 5000
+	if maxProcessRows >= 20000 || fileSize >= 20*1024*1024 {
+		targetChunkChars = 12000
+	} else if maxProcessRows >= 10000 || fileSize >= 10*1024*1024 {
+		targetChunkChars = 8000
+	}
+
+	return &recordEncoder{
+		path:             path,
+		source:           source,
+		maxProcessRows:   maxProcessRows,
+		targetChunkChars: targetChunkChars,
+	}, nil
+}
+
+// encodeSheet 编码一个工作表：表头按 sheetHeader 确定（跳过开头的空行与标题行），其后每行一条记录
+func (e *recordEncoder) encodeSheet(sheet string, rows iter.Seq2[int, []string]) {
+	var (
+		found    sheetHeader
+		headers  []string
+		firstRow = 0
+		lastRow  = 0
+		sb       strings.Builder
+	)
+	var line strings.Builder
+
+	flush := func() {
+		s := strings.TrimSpace(sb.String())
+		if s != "" {
+			e.chunks = append(e.chunks, Segment{
+				Text: s,
+				Meta: SegmentMeta{Sheet: sheet, RowStart: firstRow, RowEnd: lastRow},
+			})
+		}
+		sb.Reset()
+	}
+
+	for rowNum, cells := range rows {
+		if rowNum > e.maxProcessRows {
+			break
+		}
+		if !found.next(cells) {
+			continue
+		}
+		if headers == nil {
+			// 表头行
+			headers = make([]string, len(found.header))
+			for i := range found.header {
+				headers[i] = strings.TrimSpace(found.header[i])
+				if headers[i] == "" {
+					headers[i] = fmt.Sprintf("列%d", i+1)
+				}
+			}
+		}
+
+		// 跳过空行
+		empty := true
+		for _, c := range cells {
+			if strings.TrimSpace(c) != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+
+		// 行级语义编码：工作表 + 行号 + 列名:值
+		line.Reset()
+		line.WriteString("工作表: ")
+		line.WriteString(sheet)
+		line.WriteString("；行: ")
+		line.WriteString(strconv.Itoa(rowNum))
+		line.WriteString("；")
+
+		limit := len(cells)
+		if len(headers) < limit {
+			limit = len(headers)
+		}
+		for i := 0; i < limit; i++ {
+			v := strings.TrimSpace(cells[i])
+			if v == "" {
+				continue
+			}
+			line.WriteString(headers[i])
+			line.WriteString(": ")
+			line.WriteString(v)
+			line.WriteString("；")
+		}
+
+		record := strings.TrimSpace(line.String())
+		if record == "" {
+			continue
+		}
+
+		// 控制 chunk 大小，保证记录不被截断
+		if sb.Len() > 0 && sb.Len()+len(record)+1 > e.targetChunkChars {
+			flush()
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("数据来源: ")
+			sb.WriteString(e.source)
+			sb.WriteString("；文件: ")
+			sb.WriteString(filepath.Base(e.path))
+			sb.WriteString("\n")
+			firstRow = rowNum
+		}
+		sb.WriteString(record)
+		sb.WriteString("\n")
+		lastRow = rowNum
+	}
+
+	flush()
+}
+
+// encodeRecords 编码非表格的结构化记录（JSON、YAML）：每条记录展开为多行 "路径: 值"，
+// 记录之间空一行，多条记录合并为大小受限的分段；RowStart/RowEnd 为记录序号
+func (e *recordEncoder) encodeRecords(records []jsonRecord) []Segment {
+	var (
+		sb                strings.Builder
+		firstRec, lastRec int
+	)
+	flush := func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			e.chunks = append(e.chunks, Segment{
+				Text: s,
+				Meta: SegmentMeta{RowStart: firstRec, RowEnd: lastRec},
+			})
+		}
+		sb.Reset()
+	}
+	for i, rec := range records {
+		n := i + 1
+		if n > e.maxProcessRows {
+			break
+		}
+		record := encodeRecord(n, rec)
+		if record == "" {
+			continue
+		}
+		// 控制 chunk 大小，保证记录不被截断
+		if sb.Len() > 0 && sb.Len()+len(record)+2 > e.targetChunkChars {
+			flush()
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("数据来源: ")
+			sb.WriteString(e.source)
+			sb.WriteString("；文件: ")
+			sb.WriteString(filepath.Base(e.path))
+			sb.WriteString("\n")
+			firstRec = n
+		}
+		sb.WriteString("\n")
+		sb.WriteString(record)
+		sb.WriteString("\n")
+		lastRec = n
+	}
+	flush()
+	return e.chunks
+}
@@ -0,0 +1,490 @@
+package kb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "html",
+		Exts:         []string{".html", ".htm", ".xhtml"},
+		MIMETypes:    []string{"text/html", "application/xhtml+xml"},
+		Extractor:    ExtractorFunc(extractHTMLFile),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+	RegisterExtractor(Registration{
+		Name:         "mhtml",
+		Exts:         []string{".mhtml", ".mht"},
+		MIMETypes:    []string{"multipart/related", "message/rfc822"},
+		Extractor:    ExtractorFunc(extractMHTMLFile),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+}
+
+// extractHTMLFile 读取 HTML 文件并按章节输出清洗后的文本
+func extractHTMLFile(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return extractHTML(b, "")
+}
+
+// extractMHTMLFile 从另存为的网页归档（MHTML）中取出主 HTML 部分再清洗
+func extractMHTMLFile(path string) ([]Segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("parse mhtml: %w", err)
+	}
+	body, contentType, err := findHTMLPart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("no html part found in %s", filepath.Base(path))
+	}
+	return extractHTML(body, contentType)
+}
+
+// findHTMLPart 递归查找第一个 text/html 部分，返回解码后的内容及其 Content-Type
+func findHTMLPart(header textproto.MIMEHeader, r io.Reader) ([]byte, string, error) {
+	contentType := header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil, "", nil
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("read mhtml part: %w", err)
+			}
+			body, ct, err := findHTMLPart(part.Header, part)
+			if err != nil || body != nil {
+				return body, ct, err
+			}
+		}
+	}
+
+	if mediaType != "text/html" {
+		return nil, "", nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode html part: %w", err)
+	}
+	return body, contentType, nil
+}
+
+// newlineStripper 去掉 base64 正文中的换行
+type newlineStripper struct{ r io.Reader }
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
+
+// extractHTML 解析 HTML（自动识别编码），剔除脚本、导航等样板内容，
+// 按标题切分为章节，标题/列表/表格转成类 Markdown 文本
+func extractHTML(b []byte, contentType string) ([]Segment, error) {
+	r, err := charset.NewReader(bytes.NewReader(b), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("detect html charset: %w", err)
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+
+	root := findMainContent(doc)
+	if root == nil {
+		root = doc
+	}
+
+	w := &htmlWriter{}
+	w.walk(root)
+	w.flushSection()
+	return w.sections, nil
+}
+
+// isMainContent 节点是否为正文容器（<main>/<article>/role=main/Confluence 正文）
+func isMainContent(n *html.Node) bool {
+	return n.Type == html.ElementNode &&
+		(n.DataAtom == atom.Main || n.DataAtom == atom.Article || attr(n, "role") == "main" || attr(n, "id") == "main-content")
+}
+
+// inMainContent 节点是否位于正文容器之内
+func inMainContent(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if isMainContent(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPageForm 表单是否包住了页面正文：包含正文容器，或包含 <body> 中至少一半的文本
+func isPageForm(form *html.Node) bool {
+	var body *html.Node
+	for p := form.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.DataAtom == atom.Body {
+			body = p
+		}
+	}
+	if findMainContent(form) != nil {
+		return true
+	}
+	if body == nil {
+		return false
+	}
+	n := rawTextLen(form)
+	return n > 0 && n*2 >= rawTextLen(body)
+}
+
+// rawTextLen 节点下非空白文本的字符数（不含脚本与样式）
+func rawTextLen(n *html.Node) int {
+	switch {
+	case n.Type == html.TextNode:
+		return len(strings.Join(strings.Fields(n.Data), ""))
+	case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+		return 0
+	}
+	total := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		total += rawTextLen(c)
+	}
+	return total
+}
+
+// findMainContent 优先使用 <main>/<article>/Confluence 正文容器，找不到时返回 nil
+func findMainContent(n *html.Node) *html.Node {
+	var found *html.Node
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if found != nil {
+			return
+		}
+		if isMainContent(n) {
+			found = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// isBoilerplate 判断节点是否为脚本、导航、页眉页脚等非正文内容。
+// <header> 只在正文容器之外时剔除（<article> 内的 header 通常是标题）；
+// <form> 包住整个页面正文时（ASP.NET/SharePoint 页面）保留
+func isBoilerplate(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Iframe,
+		atom.Nav, atom.Footer, atom.Aside, atom.Button, atom.Select, atom.Head:
+		return true
+	case atom.Header:
+		return !inMainContent(n)
+	case atom.Form:
+		return !inMainContent(n) && !isPageForm(n)
+	}
+	switch attr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "search":
+		return true
+	}
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlWriter 把 DOM 渲染为类 Markdown 文本，遇到标题时开启新章节
+type htmlWriter struct {
+	sections []Segment
+	heading  string
+	buf      strings.Builder
+	listDeep int
+}
+
+func (w *htmlWriter) flushSection() {
+	text := collapseBlankLines(w.buf.String())
+	if text != "" {
+		w.sections = append(w.sections, Segment{Text: text, Meta: SegmentMeta{Heading: w.heading}})
+	}
+	w.buf.Reset()
+}
+
+func (w *htmlWriter) block() {
+	w.buf.WriteString("\n\n")
+}
+
+func (w *htmlWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.buf.WriteString(collapseSpaces(n.Data))
+		return
+	case html.ElementNode:
+		if isBoilerplate(n) {
+			return
+		}
+	case html.DocumentNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		title := strings.TrimSpace(collapseSpaces(nodeText(n)))
+		if title == "" {
+			return
+		}
+		w.flushSection()
+		w.heading = title
+		level := int(n.Data[1] - '0')
+		w.buf.WriteString(strings.Repeat("#", level) + " " + title)
+		w.block()
+		return
+	case atom.Br:
+		w.buf.WriteString("\n")
+		return
+	case atom.Hr:
+		w.block()
+		return
+	case atom.Pre:
+		w.block()
+		w.buf.WriteString("```\n" + strings.Trim(nodeText(n), "\n") + "\n```")
+		w.block()
+		return
+	case atom.Table:
+		w.block()
+		w.buf.WriteString(renderHTMLTable(n))
+		w.block()
+		return
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			w.buf.WriteString("[图片: " + alt + "]")
+		}
+		return
+	case atom.Ul, atom.Ol:
+		w.listDeep++
+		index := 0
+		if w.listDeep == 1 {
+			w.buf.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.Li {
+				index++
+				marker := "- "
+				if n.DataAtom == atom.Ol {
+					marker = fmt.Sprintf("%d. ", index)
+				}
+				w.buf.WriteString("\n" + strings.Repeat("  ", w.listDeep-1) + marker)
+				for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+					w.walk(cc)
+				}
+				continue
+			}
+			w.walk(c)
+		}
+		w.listDeep--
+		if w.listDeep == 0 {
+			w.block()
+		}
+		return
+	}
+
+	blockLevel := isBlockElement(n)
+	if blockLevel && w.listDeep == 0 {
+		w.block()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if blockLevel && w.listDeep == 0 {
+		w.block()
+	}
+}
+
+func isBlockElement(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.Section, atom.Blockquote, atom.Dl, atom.Dt, atom.Dd,
+		atom.Figure, atom.Figcaption, atom.Main, atom.Article, atom.Body:
+		return true
+	}
+	return false
+}
+
+// renderHTMLTable 把 HTML 表格渲染为 Markdown 表格，首行作为表头
+func renderHTMLTable(table *html.Node) string {
+	var rows [][]string
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Table && n != table {
+			return // 嵌套表格作为单元格文本处理
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Tr {
+			var row []string
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+					cell := strings.TrimSpace(collapseSpaces(nodeText(c)))
+					row = append(row, strings.ReplaceAll(cell, "|", "\\|"))
+				}
+			}
+			if len(row) > 0 {
+				rows = append(rows, row)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(table)
+	return markdownTable(rows)
+}
+
+// nodeText 返回节点下的全部文本（跳过样板节点）
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			return
+		}
+		if n.Type == html.ElementNode {
+			if isBoilerplate(n) {
+				return
+			}
+			if n.DataAtom == atom.Br {
+				sb.WriteString("\n")
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return sb.String()
+}
+
+// collapseSpaces 把连续空白折叠为一个空格
+func collapseSpaces(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ' ' {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// collapseBlankLines 去掉行首尾空白并合并多余空行（代码块与列表缩进保留）
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank, fenced := false, false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+		}
+		if fenced {
+			blank = false
+			out = append(out, line)
+			continue
+		}
+		line = strings.TrimRight(line, " ")
+		if !strings.HasPrefix(strings.TrimLeft(line, " "), "- ") && !isOrderedItem(line) {
+			line = strings.TrimLeft(line, " ")
+		}
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+func isOrderedItem(line string) bool {
+	t := strings.TrimLeft(line, " ")
+	i := 0
+	for i < len(t) && t[i] >= '0' && t[i] <= '9' {
+		i++
+	}
+	return i > 0 && strings.HasPrefix(t[i:], ". ")
+}
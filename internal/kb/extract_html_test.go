@@ -0,0 +1,66 @@
+package kb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractHTML(t *testing.T) {
+	page := `<html><head><script>var x = 1</script></head><body>
+<nav><a href="/">首页</a></nav>
+<main><h1>指南</h1><p>简介</p>
+<h2>数据</h2><table><tr><th>名称</th><th>值</th></tr><tr><td>a</td><td>1</td></tr></table></main>
+<footer>版权所有</footer></body></html>`
+
+	segments, err := extractHTML([]byte(page), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatalf("extractHTML failed: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 sections, got %d: %+v", len(segments), segments)
+	}
+	if segments[1].Meta.Heading != "数据" {
+		t.Errorf("expected heading 数据, got %q", segments[1].Meta.Heading)
+	}
+	if !strings.Contains(segments[1].Text, "| a | 1 |") {
+		t.Errorf("expected markdown table, got %q", segments[1].Text)
+	}
+	text := renderSegments(segments)
+	for _, noise := range []string{"var x", "首页", "版权所有"} {
+		if strings.Contains(text, noise) {
+			t.Errorf("expected boilerplate %q to be stripped, got %q", noise, text)
+		}
+	}
+}
+
+func TestExtractHTMLFormAndHeader(t *testing.T) {
+	// ASP.NET/SharePoint 页面：整个正文包在 <form> 中，页面上另有搜索表单
+	page := `<html><body><form id="aspnetForm" method="post">
+<header><a href="/">门户首页</a></header>
+<form class="search"><input name="q"></form>
+<div class="content"><h1>报销流程</h1><p>提交报销单后由部门经理审批，财务在五个工作日内付款。</p></div>
+</form></body></html>`
+
+	segments, err := extractHTML([]byte(page), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatalf("extractHTML failed: %v", err)
+	}
+	text := renderSegments(segments)
+	if !strings.Contains(text, "报销流程") || !strings.Contains(text, "五个工作日") {
+		t.Errorf("expected form-wrapped body to be kept, got %q", text)
+	}
+	if strings.Contains(text, "门户首页") {
+		t.Errorf("expected page header to be stripped, got %q", text)
+	}
+
+	// <article> 内的 <header> 保存标题
+	page = `<html><body><header>站点导航</header>
+<article><header><h1>季度总结</h1></header><p>营收增长。</p></article></body></html>`
+	segments, err = extractHTML([]byte(page), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatalf("extractHTML failed: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Meta.Heading != "季度总结" || strings.Contains(renderSegments(segments), "站点导航") {
+		t.Errorf("expected article header title to be kept, got %+v", segments)
+	}
+}
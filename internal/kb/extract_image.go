@@ -0,0 +1,23 @@
+package kb
+
+import "path/filepath"
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "image",
+		Exts:         []string{".png", ".jpg", ".jpeg", ".tif", ".tiff", ".bmp", ".webp"},
+		MIMETypes:    []string{"image/png", "image/jpeg", "image/tiff", "image/bmp", "image/webp"},
+		Extractor:    ExtractorFunc(extractImage),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+}
+
+// extractImage 通过 OCR 识别图片中的文字；OCR 不可用时返回错误，文件标记为处理失败而不是静默地没有内容
+func extractImage(path string) ([]Segment, error) {
+	text, err := ocrImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return []Segment{{Text: text, Meta: SegmentMeta{File: filepath.Base(path), OCR: true}}}, nil
+}
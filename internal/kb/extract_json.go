@@ -0,0 +1,361 @@
+package kb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:      "json",
+		Exts:      []string{".json", ".jsonl", ".ndjson"},
+		MIMETypes: []string{"application/json", "application/x-ndjson"},
+		Extractor: ExtractorFunc(extractJSON),
+		Records:   true,
+	})
+	RegisterExtractor(Registration{
+		Name:      "yaml",
+		Exts:      []string{".yaml", ".yml"},
+		MIMETypes: []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		Extractor: ExtractorFunc(extractYAML),
+		Records:   true,
+	})
+}
+
+// jsonField/jsonObject 保持键顺序的对象；解析结果中的值为 jsonObject、[]any、string、json.Number、bool 或 nil
+type jsonField struct {
+	key string
+	val any
+}
+
+type jsonObject []jsonField
+
+// jsonRecord 一条记录；prefix 为记录所在的外层字段名（如 {"tickets": [...]} 中的 tickets）
+type jsonRecord struct {
+	prefix string
+	val    any
+}
+
+// idKeys 视为记录编号的字段名（小写）；另外 xxx_id、xxxId 形式的字段也算
+var idKeys = map[string]bool{
+	"id": true, "uuid": true, "key": true, "code": true, "number": true, "no": true, "sn": true,
+	"编号": true, "工号": true, "学号": true, "单号": true, "工单号": true,
+}
+
+// extractJSON 抽取 JSON / JSON Lines：数组中的每个对象（JSONL 的每一行）是一条记录，
+// 展开为 "路径: 值" 行后按大小合并为分段，记录不会被截断
+func extractJSON(path string) ([]Segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	enc, err := newRecordEncoder(path, "JSON")
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".jsonl" || ext == ".ndjson" {
+		records, warnings := jsonLinesRecords(f, filepath.Base(path))
+		return enc.encodeRecords(records), warnings.err()
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("parse json: %w", err)
+	}
+	// 拼接的多个 JSON 值（没有用 .jsonl 扩展名的 JSON Lines）
+	values := []any{v}
+	for dec.More() {
+		if v, err = decodeJSONValue(dec); err != nil {
+			return nil, fmt.Errorf("parse json: %w", err)
+		}
+		values = append(values, v)
+	}
+	return enc.encodeRecords(splitRecords(values)), nil
+}
+
+// extractYAML 抽取 YAML（支持 --- 分隔的多文档），记录的划分与 JSON 相同
+func extractYAML(path string) ([]Segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	enc, err := newRecordEncoder(path, "YAML")
+	if err != nil {
+		return nil, err
+	}
+	var values []any
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("parse yaml: %w", err)
+		}
+		values = append(values, yamlValue(&doc))
+	}
+	return enc.encodeRecords(splitRecords(values)), nil
+}
+
+// jsonLinesRecords 逐行解析 JSON Lines，无法解析的行记为警告后跳过
+func jsonLinesRecords(r io.Reader, name string) ([]jsonRecord, Warnings) {
+	var (
+		records  []jsonRecord
+		warnings Warnings
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		v, err := decodeJSONValue(dec)
+		if err != nil {
+			warnings.warnf("Skipping invalid JSON line %d of %s: %v", n, name, err)
+			continue
+		}
+		records = append(records, jsonRecord{val: v})
+	}
+	return records, warnings
+}
+
+// splitRecords 确定记录：顶层数组的每个元素是一条记录；顶层对象中值为对象数组的字段展开为多条记录
+// （如 {"tickets": [...]}，记录路径带字段名前缀），其余字段合为一条记录
+func splitRecords(values []any) []jsonRecord {
+	var records []jsonRecord
+	for _, v := range values {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				records = append(records, jsonRecord{val: item})
+			}
+		case jsonObject:
+			var rest jsonObject
+			for _, f := range v {
+				if arr, ok := f.val.([]any); ok && isObjectArray(arr) {
+					for _, item := range arr {
+						records = append(records, jsonRecord{prefix: f.key, val: item})
+					}
+					continue
+				}
+				rest = append(rest, f)
+			}
+			if len(rest) > 0 {
+				records = append(records, jsonRecord{val: rest})
+			}
+		case nil:
+		default:
+			records = append(records, jsonRecord{val: v})
+		}
+	}
+	return records
+}
+
+func isObjectArray(arr []any) bool {
+	if len(arr) == 0 {
+		return false
+	}
+	for _, item := range arr {
+		if _, ok := item.(jsonObject); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeRecord 把一条记录展开为 "路径: 值" 行；编号字段提前并汇总到首行，便于按编号检索
+func encodeRecord(ordinal int, rec jsonRecord) string {
+	var ids, lines, idLines []string
+	flattenValue("", rec.val, func(path, value string) {
+		full := path
+		if rec.prefix != "" {
+			full = strings.TrimSuffix(rec.prefix+"."+path, ".")
+		}
+		line := full + ": " + value
+		if full == "" {
+			line = value
+		}
+		if isIDField(path) {
+			ids = append(ids, value)
+			idLines = append(idLines, line)
+			return
+		}
+		lines = append(lines, line)
+	})
+	if len(lines)+len(idLines) == 0 {
+		return ""
+	}
+	header := fmt.Sprintf("记录: %d", ordinal)
+	if len(ids) > 0 {
+		header += "；编号: " + strings.Join(ids, ", ")
+	}
+	return header + "\n" + strings.Join(append(idLines, lines...), "\n")
+}
+
+// flattenValue 深度优先展开嵌套结构；标量数组合并为一行，空值跳过
+func flattenValue(path string, v any, emit func(path, value string)) {
+	switch v := v.(type) {
+	case jsonObject:
+		for _, f := range v {
+			p := f.key
+			if path != "" {
+				p = path + "." + f.key
+			}
+			flattenValue(p, f.val, emit)
+		}
+	case []any:
+		if scalars, ok := scalarList(v); ok {
+			if len(scalars) > 0 {
+				emit(path, strings.Join(scalars, ", "))
+			}
+			return
+		}
+		for i, item := range v {
+			flattenValue(fmt.Sprintf("%s[%d]", path, i), item, emit)
+		}
+	case nil:
+	default:
+		if s := strings.TrimSpace(scalarString(v)); s != "" {
+			emit(path, s)
+		}
+	}
+}
+
+func scalarList(arr []any) ([]string, bool) {
+	out := make([]string, 0, len(arr))
+	for _, item := range arr {
+		switch item.(type) {
+		case jsonObject, []any:
+			return nil, false
+		case nil:
+			continue
+		}
+		if s := strings.TrimSpace(scalarString(item)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, true
+}
+
+func scalarString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprint(v)
+}
+
+// isIDField 判断记录的顶层字段是否为编号：id、key、编号，或 ticket_id、ticketId 等
+func isIDField(name string) bool {
+	if name == "" || strings.ContainsAny(name, ".[") {
+		return false
+	}
+	lower := strings.ToLower(name)
+	if idKeys[lower] {
+		return true
+	}
+	return strings.HasSuffix(lower, "_id") || strings.HasSuffix(lower, "-id") ||
+		(len(name) > 2 && (strings.HasSuffix(name, "Id") || strings.HasSuffix(name, "ID")))
+}
+
+// decodeJSONValue 按 token 解析一个 JSON 值，保留对象键的顺序
+func decodeJSONValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			var obj jsonObject
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				val, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, jsonField{key: fmt.Sprint(keyTok), val: val})
+			}
+			_, err := dec.Token() // '}'
+			return obj, err
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				val, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, val)
+			}
+			_, err := dec.Token() // ']'
+			return arr, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	}
+	return tok, nil
+}
+
+// yamlValue 把 YAML 节点转换为与 JSON 解析结果相同的结构，保留键顺序
+func yamlValue(n *yaml.Node) any {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return yamlValue(n.Content[0])
+	case yaml.MappingNode:
+		obj := make(jsonObject, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			obj = append(obj, jsonField{key: n.Content[i].Value, val: yamlValue(n.Content[i+1])})
+		}
+		return obj
+	case yaml.SequenceNode:
+		arr := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			arr = append(arr, yamlValue(c))
+		}
+		return arr
+	case yaml.AliasNode:
+		if n.Alias != nil {
+			return yamlValue(n.Alias)
+		}
+		return nil
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil
+		}
+		return n.Value
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSONRecords(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := write("tickets.json", `{"exported": "2024-03-01", "tickets": [
+		{"title": "打印机故障", "ticket_id": "INC-1024", "assignee": {"name": "张三", "id": 7}, "tags": ["hw", "office"]},
+		{"title": "VPN 无法连接", "ticket_id": "INC-1025", "history": [{"status": "open"}, {"status": "closed"}]}
+	]}`)
+	segs, err := extractJSON(path)
+	if err != nil {
+		t.Fatalf("extractJSON: %v", err)
+	}
+	if len(segs) != 1 || segs[0].Meta.RowStart != 1 || segs[0].Meta.RowEnd != 3 {
+		t.Fatalf("expected one chunk with records 1-3, got %+v", segs)
+	}
+	text := segs[0].Text
+	for _, want := range []string{
+		"数据来源: JSON；文件: tickets.json",
+		"记录: 1；编号: INC-1024\ntickets.ticket_id: INC-1024\ntickets.title: 打印机故障\ntickets.assignee.name: 张三\ntickets.assignee.id: 7\ntickets.tags: hw, office",
+		"tickets.history[1].status: closed",
+		"记录: 3\nexported: 2024-03-01",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+
+	path = write("events.jsonl", "{\"id\": \"E1\", \"msg\": \"a\"}\nnot json\n\n{\"id\": \"E2\", \"msg\": \"b\"}\n")
+	// 无法解析的行跳过并作为警告返回，不视为失败
+	segs, _, warnings, err := extractDocument(path)
+	if err != nil {
+		t.Fatalf("extractJSON jsonl: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "line 2 of events.jsonl") {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	if len(segs) != 1 || !strings.Contains(segs[0].Text, "记录: 2；编号: E2\nid: E2\nmsg: b") {
+		t.Errorf("unexpected jsonl chunks: %+v", segs)
+	}
+
+	path = write("cmdb.yaml", "name: web-01\nip: 10.0.0.1\n---\nname: db-01\nasset_id: CI0012345\nroles: [mysql, backup]\n")
+	if segs, err = extractYAML(path); err != nil {
+		t.Fatalf("extractYAML: %v", err)
+	}
+	if len(segs) != 1 || !strings.Contains(segs[0].Text, "记录: 2；编号: CI0012345\nasset_id: CI0012345\nname: db-01\nroles: mysql, backup") {
+		t.Errorf("unexpected yaml chunks: %+v", segs)
+	}
+}
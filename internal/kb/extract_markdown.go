@@ -0,0 +1,180 @@
+package kb
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "markdown",
+		Exts:         []string{".md", ".markdown"},
+		MIMETypes:    []string{"text/markdown"},
+		Extractor:    ExtractorFunc(extractMarkdown),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+		// 预览由前端渲染 Markdown 原文
+		RawPreview: true,
+	})
+}
+
+var (
+	mdATXHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdSetextLine = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdFenceOpen  = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	mdTableDelim = regexp.MustCompile(`^ {0,3}\|? *:?-+:? *(\| *:?-+:? *)*\|? *$`)
+)
+
+// mdBlock Markdown 块级元素
+type mdBlock struct {
+	text  string
+	level int // >0 表示标题级别
+	title string
+}
+
+// extractMarkdown 按章节切分 Markdown，标题行转为章节的标题路径（如 "安装 > Linux > 故障排查"），
+// 作为位置标签加在每个分片前；章节内的切分由 textSplitter 完成，围栏代码块与表格不会被拆开
+func extractMarkdown(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return markdownSections(string(b)), nil
+}
+
+func markdownSections(src string) []Segment {
+	var (
+		sections []Segment
+		titles   []string
+		levels   []int
+		blocks   []string
+		hasBody  bool
+	)
+	flush := func() {
+		// 只有标题没有正文的章节不单独成段，标题已体现在子章节的路径中
+		if hasBody {
+			sections = append(sections, Segment{
+				Text: strings.Join(blocks, "\n\n"),
+				Meta: SegmentMeta{Heading: strings.Join(titles, " > ")},
+			})
+		}
+		blocks, hasBody = nil, false
+	}
+
+	for _, blk := range parseMarkdownBlocks(src) {
+		if blk.level == 0 {
+			blocks = append(blocks, blk.text)
+			hasBody = true
+			continue
+		}
+		flush()
+		for len(levels) > 0 && levels[len(levels)-1] >= blk.level {
+			levels, titles = levels[:len(levels)-1], titles[:len(titles)-1]
+		}
+		levels, titles = append(levels, blk.level), append(titles, blk.title)
+	}
+	flush()
+	return sections
+}
+
+// parseMarkdownBlocks 把 Markdown 拆成标题、围栏代码块、表格与段落
+func parseMarkdownBlocks(src string) []mdBlock {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var (
+		blocks []mdBlock
+		para   []string
+	)
+	flushPara := func() {
+		if text := strings.TrimSpace(strings.Join(para, "\n")); text != "" {
+			blocks = append(blocks, mdBlock{text: text})
+		}
+		para = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// YAML front matter
+		if i == 0 && strings.TrimSpace(line) == "---" {
+			if end := mdFrontMatterEnd(lines); end > 0 {
+				blocks = append(blocks, mdBlock{text: strings.Join(lines[:end+1], "\n")})
+				i = end
+				continue
+			}
+		}
+
+		if m := mdFenceOpen.FindStringSubmatch(line); m != nil {
+			flushPara()
+			end := len(lines) - 1 // 未闭合的代码块延续到文末
+			for j := i + 1; j < len(lines); j++ {
+				if mdIsFenceClose(lines[j], m[1]) {
+					end = j
+					break
+				}
+			}
+			blocks = append(blocks, mdBlock{text: strings.Join(lines[i:end+1], "\n")})
+			i = end
+			continue
+		}
+
+		if m := mdATXHeading.FindStringSubmatch(line); m != nil {
+			flushPara()
+			blocks = append(blocks, mdBlock{text: strings.TrimSpace(line), level: len(m[1]), title: strings.TrimSpace(m[2])})
+			continue
+		}
+
+		if strings.Contains(line, "|") && i+1 < len(lines) && strings.Contains(lines[i+1], "-") && mdTableDelim.MatchString(lines[i+1]) {
+			flushPara()
+			end := i + 1
+			for end+1 < len(lines) && strings.TrimSpace(lines[end+1]) != "" && strings.Contains(lines[end+1], "|") {
+				end++
+			}
+			blocks = append(blocks, mdBlock{text: strings.Join(lines[i:end+1], "\n")})
+			i = end
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flushPara()
+			continue
+		}
+
+		// Setext 标题：段落下方的 === / ---
+		if len(para) > 0 {
+			if m := mdSetextLine.FindStringSubmatch(line); m != nil {
+				title := strings.TrimSpace(strings.Join(para, " "))
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				blocks = append(blocks, mdBlock{text: strings.Repeat("#", level) + " " + title, level: level, title: title})
+				para = nil
+				continue
+			}
+		}
+		para = append(para, line)
+	}
+	flushPara()
+	return blocks
+}
+
+// mdFrontMatterEnd 返回 front matter 结束行（--- 或 ...），没有时返回 0
+func mdFrontMatterEnd(lines []string) int {
+	for j := 1; j < len(lines); j++ {
+		if s := strings.TrimSpace(lines[j]); s == "---" || s == "..." {
+			return j
+		}
+	}
+	return 0
+}
+
+// mdIsFenceClose 判断是否为与开头相同字符、长度不短于开头的闭合围栏
+func mdIsFenceClose(line, open string) bool {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 {
+		return false
+	}
+	s = strings.TrimRight(s, " \t")
+	return len(s) >= len(open) && strings.Trim(s, open[:1]) == ""
+}
@@ -0,0 +1,357 @@
+package kb
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "odt",
+		Exts:         []string{".odt"},
+		MIMETypes:    []string{"application/vnd.oasis.opendocument.text"},
+		Extractor:    ExtractorFunc(extractOdt),
+		ChunkSize:    480,
+		ChunkOverlap: 80,
+	})
+	RegisterExtractor(Registration{
+		Name:      "ods",
+		Exts:      []string{".ods"},
+		MIMETypes: []string{"application/vnd.oasis.opendocument.spreadsheet"},
+		Extractor: ExtractorFunc(extractOds),
+		Records:   true,
+		Tables:    odsSheets,
+	})
+}
+
+// odfMaxRepeat 限制 ODS 中重复行/列的展开数量（空白区域常被写成上百万次重复）
+const odfMaxRepeat = 1000
+
+// openODFContent 打开 OpenDocument 包中的 content.xml
+func openODFContent(path string) (*zip.ReadCloser, io.ReadCloser, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, nil, err
+			}
+			return zr, rc, nil
+		}
+	}
+	zr.Close()
+	return nil, nil, fmt.Errorf("content.xml not found (encrypted or not an OpenDocument file)")
+}
+
+func odfAttr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func odfRepeat(se xml.StartElement, local string) int {
+	n, err := strconv.Atoi(odfAttr(se, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// extractOdt 抽取 ODT 文本：标题转为 Markdown 标题并按标题切分章节，保留列表与表格
+func extractOdt(path string) ([]Segment, error) {
+	zr, rc, err := openODFContent(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	defer rc.Close()
+
+	var (
+		sections  []Segment
+		heading   string
+		body      strings.Builder
+		para      strings.Builder
+		paraLevel int // >0 表示当前段落为标题
+		listDepth int
+		inItem    bool
+		tableRows [][]string
+		row       []string
+		cell      strings.Builder
+		tableDeep int
+		depth     int // 段落嵌套深度（注释、脚注内部的段落并入外层）
+	)
+	flushSection := func() {
+		if text := collapseBlankLines(body.String()); text != "" {
+			sections = append(sections, Segment{Text: text, Meta: SegmentMeta{Heading: heading}})
+		}
+		body.Reset()
+	}
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse odt: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "h", "p":
+				depth++
+				if depth == 1 {
+					para.Reset()
+					paraLevel = 0
+					if t.Name.Local == "h" {
+						paraLevel = odfRepeat(t, "outline-level")
+					}
+				}
+			case "s":
+				para.WriteString(strings.Repeat(" ", odfRepeat(t, "c")))
+			case "tab":
+				para.WriteString("\t")
+			case "line-break":
+				para.WriteString("\n")
+			case "list":
+				listDepth++
+			case "list-item":
+				inItem = true
+			case "table":
+				tableDeep++
+				if tableDeep == 1 {
+					tableRows = nil
+				}
+			case "table-row":
+				row = nil
+			case "table-cell", "covered-table-cell":
+				cell.Reset()
+			case "note", "annotation":
+				// 脚注/批注不进入正文
+				if err := dec.Skip(); err != nil {
+					return nil, fmt.Errorf("parse odt: %w", err)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "h", "p":
+				depth--
+				if depth > 0 {
+					continue
+				}
+				text := strings.TrimSpace(para.String())
+				if text == "" {
+					continue
+				}
+				switch {
+				case tableDeep > 0:
+					if cell.Len() > 0 {
+						cell.WriteString(" ")
+					}
+					cell.WriteString(text)
+				case paraLevel > 0:
+					flushSection()
+					heading = text
+					body.WriteString(strings.Repeat("#", min(paraLevel, 6)) + " " + text + "\n\n")
+				case listDepth > 0:
+					marker := "- "
+					if !inItem {
+						marker = "  "
+					}
+					body.WriteString(strings.Repeat("  ", listDepth-1) + marker + text + "\n")
+					inItem = false
+				default:
+					body.WriteString(text + "\n\n")
+				}
+			case "list":
+				listDepth--
+				if listDepth == 0 {
+					body.WriteString("\n")
+				}
+			case "table-cell", "covered-table-cell":
+				if tableDeep == 1 {
+					row = append(row, strings.ReplaceAll(strings.TrimSpace(cell.String()), "|", "\\|"))
+				}
+			case "table-row":
+				if tableDeep == 1 && len(row) > 0 {
+					tableRows = append(tableRows, row)
+				}
+			case "table":
+				tableDeep--
+				if tableDeep == 0 {
+					if table := markdownTable(tableRows); table != "" {
+						body.WriteString(table + "\n\n")
+					}
+				}
+			}
+		case xml.CharData:
+			if depth > 0 {
+				para.Write(t)
+			}
+		}
+	}
+	flushSection()
+	return sections, nil
+}
+
+// odsSheet 解析后的 ODS 工作表；空行不保存，仅体现在行号上
+type odsSheet struct {
+	name    string
+	rows    [][]string
+	rowNums []int
+}
+
+// all 按行号顺序返回非空行
+func (s odsSheet) all() iter.Seq2[int, []string] {
+	return func(yield func(int, []string) bool) {
+		for i, row := range s.rows {
+			if !yield(s.rowNums[i], row) {
+				return
+			}
+		}
+	}
+}
+
+// extractOds 解析 ODS 后复用 Excel 的行级语义编码
+func extractOds(path string) ([]Segment, error) {
+	sheets, err := parseOdsSheets(path)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := newRecordEncoder(path, "ODS")
+	if err != nil {
+		return nil, err
+	}
+	for _, sheet := range sheets {
+		enc.encodeSheet(sheet.name, sheet.all())
+	}
+	return enc.chunks, nil
+}
+
+// odsSheets 依次回调 ODS 的各个工作表
+func odsSheets(path string, sheet SheetFunc) error {
+	sheets, err := parseOdsSheets(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range sheets {
+		sheet(s.name, s.all())
+	}
+	return nil
+}
+
+func parseOdsSheets(path string) ([]odsSheet, error) {
+	zr, rc, err := openODFContent(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	defer rc.Close()
+
+	var (
+		sheets      []odsSheet
+		cur         *odsSheet
+		rowNum      int
+		rowRepeat   int
+		cells       []string
+		pendingCols int // 尚未写入的空单元格，仅在后面出现非空单元格时补齐
+		cellRepeat  int
+		cellText    strings.Builder
+		inCell      bool
+		paraCount   int
+	)
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse ods: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				sheets = append(sheets, odsSheet{name: odfAttr(t, "name")})
+				cur = &sheets[len(sheets)-1]
+				rowNum = 0
+			case "table-row":
+				rowRepeat = odfRepeat(t, "number-rows-repeated")
+				cells, pendingCols = nil, 0
+			case "table-cell", "covered-table-cell":
+				cellRepeat = odfRepeat(t, "number-columns-repeated")
+				cellText.Reset()
+				inCell, paraCount = true, 0
+			case "p":
+				if inCell {
+					if paraCount > 0 {
+						cellText.WriteString("\n")
+					}
+					paraCount++
+				}
+			case "s":
+				if inCell {
+					cellText.WriteString(strings.Repeat(" ", odfRepeat(t, "c")))
+				}
+			case "annotation":
+				if err := dec.Skip(); err != nil {
+					return nil, fmt.Errorf("parse ods: %w", err)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				v := strings.TrimSpace(cellText.String())
+				if v == "" {
+					pendingCols += cellRepeat
+					continue
+				}
+				for ; pendingCols > 0 && len(cells) < odfMaxRepeat; pendingCols-- {
+					cells = append(cells, "")
+				}
+				pendingCols = 0
+				for i := 0; i < min(cellRepeat, odfMaxRepeat); i++ {
+					cells = append(cells, v)
+				}
+			case "table-row":
+				if cur == nil {
+					continue
+				}
+				if len(cells) == 0 {
+					rowNum += rowRepeat
+					continue
+				}
+				// 最多展开 odfMaxRepeat 行，但行号按完整的重复次数推进，后面的行号保持正确
+				for i := 0; i < min(rowRepeat, odfMaxRepeat); i++ {
+					cur.rows = append(cur.rows, cells)
+					cur.rowNums = append(cur.rowNums, rowNum+i+1)
+				}
+				rowNum += rowRepeat
+			case "table":
+				cur = nil
+			}
+		case xml.CharData:
+			if inCell {
+				cellText.Write(t)
+			}
+		}
+	}
+	return sheets, nil
+}
@@ -0,0 +1,87 @@
+package kb
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const odfNS = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"`
+
+func TestExtractOdt(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "guide.odt")
+	writeZip(t, p, map[string]string{
+		"content.xml": `<office:document-content ` + odfNS + `><office:body><office:text>
+<text:p>前言</text:p>
+<text:h text:outline-level="1">安装</text:h>
+<text:p>先下载<text:note><text:note-body><text:p>脚注内容</text:p></text:note-body></text:note>安装包。</text:p>
+<text:list><text:list-item><text:p>解压</text:p></text:list-item><text:list-item><text:p>运行</text:p></text:list-item></text:list>
+<text:h text:outline-level="2">端口</text:h>
+<table:table><table:table-row><table:table-cell><text:p>服务</text:p></table:table-cell><table:table-cell><text:p>端口</text:p></table:table-cell></table:table-row>
+<table:table-row><table:table-cell><text:p>web</text:p></table:table-cell><table:table-cell><text:p>8080</text:p></table:table-cell></table:table-row></table:table>
+</office:text></office:body></office:document-content>`,
+	})
+
+	segments, err := extractOdt(p)
+	if err != nil {
+		t.Fatalf("extractOdt failed: %v", err)
+	}
+	var headings []string
+	for _, s := range segments {
+		headings = append(headings, s.Meta.Heading)
+	}
+	if !slices.Equal(headings, []string{"", "安装", "端口"}) {
+		t.Fatalf("expected sections split by heading, got %+v", segments)
+	}
+	if got := segments[1].Text; got != "# 安装\n\n先下载安装包。\n\n- 解压\n- 运行" {
+		t.Errorf("unexpected section text (footnote should be skipped): %q", got)
+	}
+	if !strings.Contains(segments[2].Text, "| web | 8080 |") {
+		t.Errorf("expected markdown table, got %q", segments[2].Text)
+	}
+}
+
+func TestParseOdsSheets(t *testing.T) {
+	cell := func(v string) string {
+		return `<table:table-cell><text:p>` + v + `</text:p></table:table-cell>`
+	}
+	p := filepath.Join(t.TempDir(), "scores.ods")
+	writeZip(t, p, map[string]string{
+		"content.xml": `<office:document-content ` + odfNS + `><office:body><office:spreadsheet>
+<table:table table:name="成绩">
+<table:table-row>` + cell("姓名") + cell("分数") + `</table:table-row>
+<table:table-row table:number-rows-repeated="3"><table:table-cell table:number-columns-repeated="2"/></table:table-row>
+<table:table-row table:number-rows-repeated="1500">` + cell("同上") + `<table:table-cell table:number-columns-repeated="2"/>` + cell("0") + `</table:table-row>
+<table:table-row>` + cell("张三") + cell("90") + `</table:table-row>
+<table:table-row table:number-rows-repeated="1048000"><table:table-cell/></table:table-row>
+</table:table>
+<table:table table:name="空表"/>
+</office:spreadsheet></office:body></office:document-content>`,
+	})
+
+	sheets, err := parseOdsSheets(p)
+	if err != nil {
+		t.Fatalf("parseOdsSheets failed: %v", err)
+	}
+	if len(sheets) != 2 || sheets[0].name != "成绩" || len(sheets[1].rows) != 0 {
+		t.Fatalf("unexpected sheets: %d", len(sheets))
+	}
+	s := sheets[0]
+
+	// 表头 + 最多展开 1000 行重复行 + 最后一行；空行只体现在行号上
+	if len(s.rows) != 1+odfMaxRepeat+1 {
+		t.Fatalf("expected %d rows, got %d", 2+odfMaxRepeat, len(s.rows))
+	}
+	if s.rowNums[0] != 1 || s.rowNums[1] != 5 {
+		t.Errorf("expected blank rows to advance row numbers, got %v", s.rowNums[:2])
+	}
+	if !slices.Equal(s.rows[1], []string{"同上", "", "", "0"}) {
+		t.Errorf("expected repeated empty cells to be filled in, got %q", s.rows[1])
+	}
+	// 重复 1500 次的行之后的行号按完整的重复次数计算
+	last := len(s.rows) - 1
+	if s.rowNums[last] != 1505 || !slices.Equal(s.rows[last], []string{"张三", "90"}) {
+		t.Errorf("expected row after repeated block to be row 1505, got %d %q", s.rowNums[last], s.rows[last])
+	}
+}
@@ -0,0 +1,94 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:      "pdf",
+		Exts:      []string{".pdf"},
+		MIMETypes: []string{"application/pdf"},
+		Extractor: ExtractorFunc(extractPdf),
+		// PDF 内容更适合较大分片
+		ChunkSize:    600,
+		ChunkOverlap: 100,
+	})
+}
+
+// extractPdf 逐页抽取 PDF 文本，每页一个分段并记录页码；单页解析失败时跳过该页。
+// 没有文本层的页（扫描件）渲染为图片后交给 OCR 识别，分段标记为 OCR
+func extractPdf(path string) ([]Segment, error) {
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		segments []Segment
+		warnings Warnings
+		firstErr error
+		ocrErr   error // OCR 不可用的原因，确定后不再对后续页面重试
+		scanned  int   // 没有文本层的页数
+		name     = filepath.Base(path)
+		fonts    = make(map[string]*pdf.Font) // 字体在页面间共享，避免重复解析字符映射
+	)
+	total := r.NumPage()
+	for i := 1; i <= total; i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		for _, fontName := range p.Fonts() {
+			if _, ok := fonts[fontName]; !ok {
+				font := p.Font(fontName)
+				fonts[fontName] = &font
+			}
+		}
+		text, err := p.GetPlainText(fonts)
+		if err != nil {
+			warnings.warnf("Failed to extract page %d of %s: %v", i, name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		meta := SegmentMeta{Page: i, File: name}
+		if strings.TrimSpace(text) == "" {
+			scanned++
+			if ocrErr != nil {
+				continue
+			}
+			if _, ocrErr = ocrCommand(); ocrErr != nil {
+				continue
+			}
+			if text, err = ocrPDFPage(path, i); err != nil {
+				warnings.warnf("Failed to OCR page %d of %s: %v", i, name, err)
+				if errors.Is(err, errOCRUnavailable) {
+					ocrErr = err
+				}
+				continue
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			meta.OCR = true
+		}
+		segments = append(segments, Segment{Text: text, Meta: meta})
+	}
+	if len(segments) == 0 {
+		if scanned > 0 && ocrErr != nil {
+			return nil, fmt.Errorf("%d page(s) have no text layer (scanned PDF): %w", scanned, ocrErr)
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	return segments, warnings.err()
+}
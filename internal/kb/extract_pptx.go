@@ -0,0 +1,352 @@
+package kb
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "pptx",
+		Exts:         []string{".pptx"},
+		MIMETypes:    []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		Extractor:    ExtractorFunc(extractPptx),
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+}
+
+const (
+	relTypeSlide      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide"
+	relTypeNotesSlide = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide"
+)
+
+var slideFileRe = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPptx 按幻灯片顺序抽取正文、表格与演讲者备注，每页一个分段；
+// 隐藏的幻灯片不索引，但保留编号，引用的页码与 PowerPoint 中一致
+func extractPptx(p string) ([]Segment, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	slides, err := pptxSlideOrder(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for i, slidePath := range slides {
+		if hidden, err := pptxSlideHidden(files[slidePath]); err != nil {
+			return nil, fmt.Errorf("read %s: %w", slidePath, err)
+		} else if hidden {
+			continue
+		}
+		body, err := pptxShapesText(files[slidePath])
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", slidePath, err)
+		}
+
+		var notes string
+		rels, _ := pptxRels(files, slidePath)
+		for _, rel := range rels {
+			if rel.Type == relTypeNotesSlide {
+				notes, _ = pptxShapesText(files[rel.target(slidePath)])
+				break
+			}
+		}
+
+		text := body
+		if notes != "" {
+			text = strings.TrimSpace(text + "\n\n备注：\n" + notes)
+		}
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{Text: text, Meta: SegmentMeta{Slide: i + 1}})
+	}
+	return segments, nil
+}
+
+type pptxRel struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+// target 把相对 Target 解析为包内路径
+func (r pptxRel) target(source string) string {
+	if strings.HasPrefix(r.Target, "/") {
+		return strings.TrimPrefix(r.Target, "/")
+	}
+	return path.Join(path.Dir(source), r.Target)
+}
+
+// pptxRels 读取部件对应的 _rels/xxx.rels
+func pptxRels(files map[string]*zip.File, source string) ([]pptxRel, error) {
+	f := files[path.Join(path.Dir(source), "_rels", path.Base(source)+".rels")]
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var doc struct {
+		Rels []pptxRel `xml:"Relationship"`
+	}
+	if err := xml.NewDecoder(rc).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc.Rels, nil
+}
+
+// pptxSlideOrder 按 presentation.xml 中的 sldIdLst 确定放映顺序；缺失时按文件序号排序
+func pptxSlideOrder(files map[string]*zip.File) ([]string, error) {
+	const presentation = "ppt/presentation.xml"
+	if f := files[presentation]; f != nil {
+		rels, err := pptxRels(files, presentation)
+		if err == nil && len(rels) > 0 {
+			byID := make(map[string]string, len(rels))
+			for _, rel := range rels {
+				if rel.Type == relTypeSlide {
+					byID[rel.ID] = rel.target(presentation)
+				}
+			}
+			ids, err := pptxSlideIDs(f)
+			if err == nil && len(ids) > 0 {
+				var order []string
+				for _, id := range ids {
+					if target := byID[id]; files[target] != nil {
+						order = append(order, target)
+					}
+				}
+				if len(order) > 0 {
+					return order, nil
+				}
+			}
+		}
+	}
+
+	type numbered struct {
+		n    int
+		name string
+	}
+	var found []numbered
+	for name := range files {
+		if m := slideFileRe.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			found = append(found, numbered{n, name})
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no slides found in presentation")
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].n < found[j].n })
+	order := make([]string, len(found))
+	for i, s := range found {
+		order[i] = s.name
+	}
+	return order, nil
+}
+
+// pptxSlideIDs 返回 sldIdLst 中各幻灯片的关系 ID
+func pptxSlideIDs(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var ids []string
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sldId" {
+			for _, a := range se.Attr {
+				if a.Name.Local == "id" && a.Name.Space != "" {
+					ids = append(ids, a.Value)
+				}
+			}
+		}
+	}
+}
+
+// pptxSlideHidden 幻灯片根元素 <p:sld show="0"> 表示放映时隐藏
+func pptxSlideHidden(f *zip.File) (bool, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			for _, a := range se.Attr {
+				if a.Name.Local == "show" {
+					return a.Value == "0" || a.Value == "false", nil
+				}
+			}
+			return false, nil
+		}
+	}
+}
+
+// pptxSkippedPlaceholders 页码、日期、页眉页脚与备注页中的幻灯片缩略图不参与索引
+var pptxSkippedPlaceholders = map[string]bool{
+	"sldNum": true, "dt": true, "ftr": true, "hdr": true, "sldImg": true,
+}
+
+// pptxShapesText 抽取幻灯片（或备注页）中的文本；表格输出为 Markdown 表格
+func pptxShapesText(f *zip.File) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var (
+		out       strings.Builder
+		para      strings.Builder
+		shapeMark = -1 // 当前形状在 out 中的起始位置
+		skipShape bool
+		inTable   bool
+		rows      [][]string
+		row       []string
+		cell      strings.Builder
+		inText    bool
+	)
+	flushPara := func() {
+		t := strings.TrimSpace(para.String())
+		para.Reset()
+		if t == "" {
+			return
+		}
+		if inTable {
+			if cell.Len() > 0 {
+				cell.WriteString(" ")
+			}
+			cell.WriteString(t)
+			return
+		}
+		out.WriteString(t + "\n")
+	}
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				shapeMark, skipShape = out.Len(), false
+			case "ph":
+				for _, a := range t.Attr {
+					if a.Name.Local == "type" && pptxSkippedPlaceholders[a.Value] {
+						skipShape = true
+					}
+				}
+			case "tbl":
+				inTable, rows = true, nil
+			case "tr":
+				row = nil
+			case "tc":
+				cell.Reset()
+			case "t":
+				inText = true
+			case "br":
+				para.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				flushPara()
+			case "tc":
+				row = append(row, strings.ReplaceAll(strings.TrimSpace(cell.String()), "|", "\\|"))
+			case "tr":
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case "tbl":
+				inTable = false
+				if table := markdownTable(rows); table != "" {
+					out.WriteString("\n" + table + "\n\n")
+				}
+			case "sp":
+				if skipShape && shapeMark >= 0 {
+					s := out.String()[:shapeMark]
+					out.Reset()
+					out.WriteString(s)
+				}
+				shapeMark, skipShape = -1, false
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// markdownTable 把二维单元格渲染为 Markdown 表格，首行作为表头
+func markdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
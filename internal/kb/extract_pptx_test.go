@@ -0,0 +1,99 @@
+package kb
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeZip 按给定的包内路径与内容生成 zip（OOXML/ODF/EPUB 测试文件）
+func writeZip(t *testing.T, p string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const pptxNS = `xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+func pptxSlide(attrs, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><p:sld ` + pptxNS + attrs + `><p:cSld><p:spTree>` + body + `</p:spTree></p:cSld></p:sld>`
+}
+
+func pptxText(text string) string {
+	return `<p:sp><p:txBody><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:txBody></p:sp>`
+}
+
+func TestExtractPptx(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "deck.pptx")
+	rels := func(targets ...string) string {
+		s := `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+		for i, target := range targets {
+			typ := relTypeSlide
+			if strings.Contains(target, "notes") {
+				typ = relTypeNotesSlide
+			}
+			s += `<Relationship Id="rId` + strconv.Itoa(i+1) + `" Type="` + typ + `" Target="` + target + `"/>`
+		}
+		return s + `</Relationships>`
+	}
+	writeZip(t, p, map[string]string{
+		// 放映顺序与文件序号不同：slide2, slide1, slide3
+		"ppt/presentation.xml": `<p:presentation ` + pptxNS + `><p:sldIdLst>` +
+			`<p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId1"/><p:sldId id="258" r:id="rId3"/>` +
+			`</p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": rels("slides/slide1.xml", "slides/slide2.xml", "slides/slide3.xml"),
+		"ppt/slides/slide1.xml": pptxSlide("", pptxText("年度规划")+
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldNum"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>99</a:t></a:r></a:p></p:txBody></p:sp>`),
+		"ppt/slides/_rels/slide1.xml.rels": rels("../notesSlides/notesSlide1.xml"),
+		"ppt/notesSlides/notesSlide1.xml":  pptxSlide("", pptxText("强调预算")),
+		"ppt/slides/slide2.xml": pptxSlide("", pptxText("目录")+
+			`<p:graphicFrame><a:graphic><a:graphicData><a:tbl>`+
+			`<a:tr><a:tc><a:txBody><a:p><a:r><a:t>部门</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>人数</a:t></a:r></a:p></a:txBody></a:tc></a:tr>`+
+			`<a:tr><a:tc><a:txBody><a:p><a:r><a:t>研发</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>42</a:t></a:r></a:p></a:txBody></a:tc></a:tr>`+
+			`</a:tbl></a:graphicData></a:graphic></p:graphicFrame>`),
+		"ppt/slides/slide3.xml": pptxSlide(` show="0"`, pptxText("内部草稿")),
+	})
+
+	segments, err := extractPptx(p)
+	if err != nil {
+		t.Fatalf("extractPptx failed: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 visible slides, got %d: %+v", len(segments), segments)
+	}
+
+	first, second := segments[0], segments[1]
+	if first.Meta.Slide != 1 || !strings.HasPrefix(first.Text, "目录") {
+		t.Errorf("expected slide2.xml to be shown first, got %+v", first)
+	}
+	if !strings.Contains(first.Text, "| 部门 | 人数 |") || !strings.Contains(first.Text, "| 研发 | 42 |") {
+		t.Errorf("expected table cells as markdown, got %q", first.Text)
+	}
+	if second.Meta.Slide != 2 || second.Text != "年度规划\n\n备注：\n强调预算" {
+		t.Errorf("expected second slide with notes and without slide number, got %+v", second)
+	}
+	for _, s := range segments {
+		if strings.Contains(s.Text, "内部草稿") {
+			t.Errorf("expected hidden slide to be skipped, got %q", s.Text)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package kb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:         "rtf",
+		Exts:         []string{".rtf"},
+		MIMETypes:    []string{"application/rtf", "text/rtf"},
+		Extractor:    ExtractorFunc(extractRTFFile),
+		ChunkSize:    480,
+		ChunkOverlap: 80,
+	})
+}
+
+// rtfSkipDestinations 不含正文的目标组（字体表、样式表、图片、页眉页脚等）
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true,
+	"header": true, "headerl": true, "headerr": true, "headerf": true,
+	"footer": true, "footerl": true, "footerr": true, "footerf": true,
+	"footnote": true, "annotation": true, "object": true, "themedata": true,
+	"colorschememapping": true, "latentstyles": true, "datastore": true,
+	"xmlnstbl": true, "listtable": true, "listoverridetable": true, "rsidtbl": true,
+	"generator": true, "filetbl": true, "revtbl": true, "fldinst": true,
+}
+
+// rtfCodepage 根据 \ansicpg 返回对应编码，未知代码页按 Windows-1252 处理
+func rtfCodepage(cp int) encoding.Encoding {
+	switch cp {
+	case 936:
+		return simplifiedchinese.GBK
+	case 950:
+		return traditionalchinese.Big5
+	case 932:
+		return japanese.ShiftJIS
+	case 949:
+		return korean.EUCKR
+	case 1250:
+		return charmap.Windows1250
+	case 1251:
+		return charmap.Windows1251
+	case 1253:
+		return charmap.Windows1253
+	case 1254:
+		return charmap.Windows1254
+	case 1255:
+		return charmap.Windows1255
+	case 1256:
+		return charmap.Windows1256
+	case 1257:
+		return charmap.Windows1257
+	case 1258:
+		return charmap.Windows1258
+	case 65001:
+		return encoding.Nop
+	}
+	return charmap.Windows1252
+}
+
+func extractRTFFile(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return extractRTF(b)
+}
+
+type rtfState struct {
+	skip     bool
+	uc       int // \ucN：\uN 之后需要跳过的替代字符数
+	outline  int // 段落大纲级别，-1 表示正文
+	inTable  bool
+	isHidden bool
+}
+
+// extractRTF 解析 RTF 正文：跳过非正文目标组，解码 \'hh 与 \uN，
+// 带 \outlinelevel 的段落作为标题并按标题切分章节，表格行转为 Markdown 表格行
+func extractRTF(b []byte) ([]Segment, error) {
+	if !strings.HasPrefix(strings.TrimLeft(string(b[:min(len(b), 16)]), " \r\n\t"), "{\\rtf") {
+		return nil, fmt.Errorf("not a valid RTF document")
+	}
+
+	var (
+		sections []Segment
+		heading  string
+		body     strings.Builder
+		para     strings.Builder
+		pending  []byte            // 待按代码页解码的 \'hh 字节
+		enc      encoding.Encoding = charmap.Windows1252
+		state                      = rtfState{uc: 1, outline: -1}
+		stack    []rtfState
+		skipN    int // \uN 之后待跳过的替代字符
+		row      []string
+		rows     [][]string
+	)
+
+	flushBytes := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if s, err := enc.NewDecoder().Bytes(pending); err == nil {
+			para.Write(s)
+		}
+		pending = pending[:0]
+	}
+	writeText := func(s string) {
+		if state.skip || state.isHidden {
+			return
+		}
+		flushBytes()
+		para.WriteString(s)
+	}
+	flushSection := func() {
+		if text := collapseBlankLines(body.String()); text != "" {
+			sections = append(sections, Segment{Text: text, Meta: SegmentMeta{Heading: heading}})
+		}
+		body.Reset()
+	}
+	flushTable := func() {
+		if table := markdownTable(rows); table != "" {
+			body.WriteString(table + "\n\n")
+		}
+		rows = nil
+	}
+	endPara := func() {
+		flushBytes()
+		flushTable()
+		text := strings.TrimSpace(para.String())
+		para.Reset()
+		if text == "" {
+			return
+		}
+		if state.outline >= 0 {
+			flushSection()
+			heading = text
+			body.WriteString(strings.Repeat("#", min(state.outline+1, 6)) + " " + text + "\n\n")
+			return
+		}
+		body.WriteString(text + "\n\n")
+	}
+
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case '{':
+			flushBytes()
+			stack = append(stack, state)
+			// {\* ...} 可忽略目标
+			if i+2 < len(b) && b[i+1] == '\\' && b[i+2] == '*' {
+				state.skip = true
+			}
+		case '}':
+			flushBytes()
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case '\\':
+			if i+1 >= len(b) {
+				break
+			}
+			next := b[i+1]
+			switch {
+			case next == '\'' && i+3 < len(b):
+				v, err := strconv.ParseUint(string(b[i+2:i+4]), 16, 8)
+				i += 3
+				if err != nil || state.skip || state.isHidden {
+					continue
+				}
+				if skipN > 0 {
+					skipN--
+					continue
+				}
+				pending = append(pending, byte(v))
+			case next == '\\' || next == '{' || next == '}':
+				i++
+				if skipN > 0 {
+					skipN--
+					continue
+				}
+				writeText(string(next))
+			case next == '~':
+				i++
+				writeText(" ")
+			case next == '-' || next == '_':
+				i++
+			case next == '*':
+				i++
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(b) && isASCIILetter(b[j]) {
+					j++
+				}
+				word := string(b[i+1 : j])
+				k := j
+				if k < len(b) && (b[k] == '-' || (b[k] >= '0' && b[k] <= '9')) {
+					k++
+					for k < len(b) && b[k] >= '0' && b[k] <= '9' {
+						k++
+					}
+				}
+				param, hasParam := 0, k > j
+				if hasParam {
+					param, _ = strconv.Atoi(string(b[j:k]))
+				}
+				if k < len(b) && b[k] == ' ' {
+					k++ // 控制字后的分隔空格
+				}
+				i = k - 1
+
+				if rtfSkipDestinations[word] {
+					state.skip = true
+					continue
+				}
+				switch word {
+				case "ansicpg":
+					flushBytes()
+					enc = rtfCodepage(param)
+				case "u":
+					if param < 0 {
+						param += 65536
+					}
+					writeText(string(rune(param)))
+					skipN = state.uc
+				case "uc":
+					state.uc = param
+				case "par", "sect", "page":
+					if !state.skip && !state.inTable {
+						endPara()
+					}
+				case "line":
+					writeText("\n")
+				case "tab":
+					writeText("\t")
+				case "pard":
+					state.outline = -1
+					state.inTable = false
+				case "outlinelevel":
+					state.outline = param
+				case "intbl":
+					state.inTable = true
+				case "cell":
+					if !state.skip {
+						flushBytes()
+						row = append(row, strings.ReplaceAll(strings.TrimSpace(para.String()), "|", "\\|"))
+						para.Reset()
+					}
+				case "row":
+					if !state.skip && len(row) > 0 {
+						rows = append(rows, row)
+						row = nil
+					}
+				case "v":
+					state.isHidden = !hasParam || param != 0
+				case "emdash":
+					writeText("—")
+				case "endash":
+					writeText("–")
+				case "bullet":
+					writeText("•")
+				case "lquote", "rquote":
+					writeText("'")
+				case "ldblquote", "rdblquote":
+					writeText("\"")
+				}
+			default:
+				i++
+			}
+		case '\r', '\n':
+			// 原始换行不是正文
+		default:
+			if state.skip || state.isHidden {
+				continue
+			}
+			if skipN > 0 {
+				skipN--
+				continue
+			}
+			if c >= 0x80 {
+				pending = append(pending, c)
+				continue
+			}
+			writeText(string(c))
+		}
+	}
+	endPara()
+	flushSection()
+	return sections, nil
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
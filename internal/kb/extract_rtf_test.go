@@ -0,0 +1,20 @@
+package kb
+
+import "testing"
+
+func TestExtractRTF(t *testing.T) {
+	doc := `{\rtf1\ansi\ansicpg936{\fonttbl{\f0 \'cb\'ce\'cc\'e5;}}` +
+		`\pard\outlinelevel0 \'b8\'c5\'ca\'f6\par` +
+		`\pard Say \u8220?hi\u8221? \{ok\}{\v hidden}\par}`
+
+	segments, err := extractRTF([]byte(doc))
+	if err != nil {
+		t.Fatalf("extractRTF failed: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Meta.Heading != "概述" {
+		t.Fatalf("expected one section under 概述, got %+v", segments)
+	}
+	if want := "# 概述\n\nSay “hi” {ok}"; segments[0].Text != want {
+		t.Errorf("expected %q, got %q", want, segments[0].Text)
+	}
+}
@@ -0,0 +1,25 @@
+package kb
+
+import (
+	"os"
+)
+
+func init() {
+	RegisterExtractor(Registration{
+		Name:      "text",
+		Exts:      []string{".txt"},
+		MIMETypes: []string{"text/plain"},
+		Extractor: ExtractorFunc(extractPlainText),
+		// 普通文本适当减小重叠
+		ChunkSize:    400,
+		ChunkOverlap: 60,
+	})
+}
+
+func extractPlainText(path string) ([]Segment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []Segment{{Text: string(b)}}, nil
+}
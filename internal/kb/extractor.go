@@ -0,0 +1,434 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"knowledge/internal/db"
+)
+
+// SegmentMeta 分段的位置信息（未知的字段保持零值）
+type SegmentMeta struct {
+	Page     int    // PDF 页码，从 1 开始；跨页分片为起始页
+	PageEnd  int    // 跨页分片的结束页，0 表示与 Page 相同
+	Slide    int    // 幻灯片序号，从 1 开始
+	Sheet    string // 工作表名称
+	RowStart int    // 起始行号（含表头计数，与 Excel 行号一致）
+	RowEnd   int
+	Heading  string // 标题路径，如 "安装 > Linux"
+
+	// 源代码分片：仓库内相对路径、符号名与行号范围（PDF 只用 File 记录文件名）
+	File      string
+	Symbol    string
+	LineStart int
+	LineEnd   int
+
+	// 分片在所属分段文本中的字符偏移 [CharStart, CharEnd)；跨页分片的 CharEnd 相对结束页
+	CharStart int
+	CharEnd   int
+
+	OCR bool // 文本由 OCR 识别得到（扫描页、图片）
+
+	// 邮件：发件人与发送时间，Heading 为主题
+	Sender string
+	SentAt time.Time
+}
+
+// Label 返回可供引用的位置标签，如 "幻灯片 12"、"manual.pdf p.37"、"安装 > Linux"、"周会纪要 · 张三 <zs@example.com> · 2024-03-01 10:00"；没有可引用位置时返回空串
+func (m SegmentMeta) Label() string {
+	if m.Slide > 0 {
+		return fmt.Sprintf("幻灯片 %d", m.Slide)
+	}
+	if m.Page > 0 {
+		label := fmt.Sprintf("p.%d", m.Page)
+		if m.PageEnd > m.Page {
+			label = fmt.Sprintf("p.%d-%d", m.Page, m.PageEnd)
+		}
+		if m.File != "" {
+			label = m.File + " " + label
+		}
+		return label
+	}
+	if m.LineStart > 0 {
+		parts := make([]string, 0, 3)
+		for _, p := range []string{m.File, m.Symbol} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("行 %d-%d", m.LineStart, m.LineEnd))
+		return strings.Join(parts, " · ")
+	}
+	if m.Sender != "" {
+		parts := []string{m.Sender}
+		if m.Heading != "" {
+			parts = []string{m.Heading, m.Sender}
+		}
+		if !m.SentAt.IsZero() {
+			parts = append(parts, emailDate(m.SentAt))
+		}
+		return strings.Join(parts, " · ")
+	}
+	return m.Heading
+}
+
+// Segment 抽取器产出的结构化文本分段
+type Segment struct {
+	Text string
+	Meta SegmentMeta
+}
+
+// Extractor 文档抽取器：把文件解析为带位置信息的分段，预览与索引共用同一结果
+type Extractor interface {
+	Extract(path string) ([]Segment, error)
+}
+
+// ExtractorFunc 让普通函数实现 Extractor
+type ExtractorFunc func(path string) ([]Segment, error)
+
+func (f ExtractorFunc) Extract(path string) ([]Segment, error) { return f(path) }
+
+// Registration 抽取器的注册信息
+type Registration struct {
+	Name      string
+	Exts      []string // 小写且带点，如 ".pdf"
+	MIMETypes []string // 扩展名无法识别时按内容嗅探的 MIME 匹配
+	Extractor Extractor
+
+	// ChunkSize/ChunkOverlap 按 token 计的默认分片参数，可按类型在设置中调整，集合设置可统一覆盖
+	ChunkSize    int
+	ChunkOverlap int
+	// Records 为 true 时每个分段本身就是检索单元（如 Excel 行级记录），不再切分；
+	// 大文件导入时允许跳过向量生成
+	Records bool
+	// Chunked 为 true 时抽取器已按语义边界切好分片（如源代码按函数/类型），不再按字符窗口切分
+	Chunked bool
+	// RawPreview 为 true 时预览直接显示原文（如源代码），而不是抽取结果
+	RawPreview bool
+	// Tables 表格类文件（Excel、CSV 等）逐个工作表回调行数据，处理时物化为可 SQL 查询的表
+	Tables TableSource
+}
+
+// SheetFunc 接收一个工作表的行（行号与表格软件中一致），读到的第一行为表头
+type SheetFunc func(name string, rows iter.Seq2[int, []string])
+
+// TableSource 按工作表读取表格文件的原始行
+type TableSource func(path string, sheet SheetFunc) error
+
+var extractors = struct {
+	mu     sync.RWMutex
+	byExt  map[string]*Registration
+	byMIME map[string]*Registration
+}{
+	byExt:  make(map[string]*Registration),
+	byMIME: make(map[string]*Registration),
+}
+
+// RegisterExtractor 注册抽取器；同一扩展名/MIME 后注册的覆盖先注册的
+func RegisterExtractor(r Registration) {
+	if r.Extractor == nil {
+		panic("kb: RegisterExtractor with nil extractor")
+	}
+	extractors.mu.Lock()
+	defer extractors.mu.Unlock()
+	reg := r
+	for _, ext := range r.Exts {
+		extractors.byExt[strings.ToLower(ext)] = &reg
+	}
+	for _, m := range r.MIMETypes {
+		extractors.byMIME[strings.ToLower(m)] = &reg
+	}
+}
+
+// SupportedExtensions 返回所有已注册的扩展名（排序后），用于上传控件的 accept 列表
+func SupportedExtensions() []string {
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	exts := make([]string, 0, len(extractors.byExt))
+	for ext := range extractors.byExt {
+		exts = append(exts, ext)
+	}
+	// 压缩包没有抽取器，展开后按包内文件各自的类型处理
+	exts = append(exts, ".zip", ".tar", ".tgz", ".tar.gz")
+	slices.Sort(exts)
+	return exts
+}
+
+// ChunkType 可调整分片参数的文件类型（按 token 计）
+type ChunkType struct {
+	Name                string   `json:"name"`
+	Extensions          []string `json:"extensions"`
+	DefaultChunkSize    int      `json:"default_chunk_size"`
+	DefaultChunkOverlap int      `json:"default_chunk_overlap"`
+	ChunkSize           int      `json:"chunk_size"`
+	ChunkOverlap        int      `json:"chunk_overlap"`
+}
+
+// ChunkTypes 列出按长度切分的文件类型及当前生效的分片参数；
+// 记录类与抽取时已按语义切好的类型（表格、源代码）不在其列
+func ChunkTypes() ([]ChunkType, error) {
+	settings, err := db.GetKBChunkSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	extractors.mu.RLock()
+	byName := make(map[string]*ChunkType)
+	for ext, r := range extractors.byExt {
+		if r.Records || r.Chunked {
+			continue
+		}
+		t, ok := byName[r.Name]
+		if !ok {
+			t = &ChunkType{Name: r.Name, DefaultChunkSize: r.ChunkSize, DefaultChunkOverlap: r.ChunkOverlap}
+			t.ChunkSize, t.ChunkOverlap = chunkParams(r, settings, nil)
+			byName[r.Name] = t
+		}
+		t.Extensions = append(t.Extensions, ext)
+	}
+	extractors.mu.RUnlock()
+
+	types := make([]ChunkType, 0, len(byName))
+	for _, t := range byName {
+		slices.Sort(t.Extensions)
+		types = append(types, *t)
+	}
+	slices.SortFunc(types, func(a, b ChunkType) int { return strings.Compare(a.Name, b.Name) })
+	return types, nil
+}
+
+// chunkParams 计算生效的分片参数：注册默认值 < 按类型设置 < 集合设置
+func chunkParams(reg *Registration, settings map[string]db.ChunkSetting, collection *db.KnowledgeBaseCollection) (int, int) {
+	chunkSize, overlap := reg.ChunkSize, reg.ChunkOverlap
+	if s, ok := settings[reg.Name]; ok && s.ChunkSize > 0 {
+		chunkSize, overlap = s.ChunkSize, s.ChunkOverlap
+	}
+	if collection != nil && collection.ChunkSize > 0 {
+		chunkSize, overlap = collection.ChunkSize, collection.ChunkOverlap
+	}
+	return chunkSize, overlap
+}
+
+func extractorForExt(ext string) (*Registration, bool) {
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	r, ok := extractors.byExt[strings.ToLower(ext)]
+	return r, ok
+}
+
+func extractorForMIME(mimeType string) (*Registration, bool) {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = mimeType
+	}
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	r, ok := extractors.byMIME[strings.ToLower(mediaType)]
+	return r, ok
+}
+
+// lookupExtractor 按扩展名查找抽取器；没有扩展名时读取文件头嗅探 MIME。
+// 目录扫描、单文件添加与预览都通过它判断文件是否受支持，结果保持一致
+func lookupExtractor(path string) (*Registration, bool) {
+	if ext := filepath.Ext(path); ext != "" {
+		return extractorForExt(ext)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	return extractorForMIME(http.DetectContentType(head[:n]))
+}
+
+// extractSegments 使用已注册的抽取器解析文件
+func extractSegments(path string) ([]Segment, *Registration, error) {
+	segments, reg, _, err := extractDocument(path)
+	return segments, reg, err
+}
+
+// extractDocument 同 extractSegments，另外返回抽取器跳过内容时的警告
+func extractDocument(path string) ([]Segment, *Registration, Warnings, error) {
+	if _, entry, ok := splitArchivePath(path); ok {
+		return extractArchiveEntry(path, entry)
+	}
+	reg, ok := lookupExtractor(path)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported file type: %s", filepath.Base(path))
+	}
+	// 设置了打开密码的 docx/xlsx/pptx 实际是复合文档：先给出明确提示，
+	// 不交给抽取器（有的抽取器会把它当作空文档而不报错）
+	if hasFileMagic(path, cfbMagic) {
+		if _, err := readCFBStreams(path); errors.Is(err, errPasswordProtected) {
+			return nil, reg, nil, errPasswordProtected
+		}
+	}
+	segments, err := reg.Extractor.Extract(path)
+	var warnings Warnings
+	if errors.As(err, &warnings) {
+		err = nil
+	}
+	if err != nil {
+		return nil, reg, nil, err
+	}
+	return segments, reg, warnings, nil
+}
+
+// extractArchiveEntry 解压压缩包内的文件后抽取；分段中的文件名替换为包内路径
+func extractArchiveEntry(path, entry string) ([]Segment, *Registration, Warnings, error) {
+	local, cleanup, err := LocalFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer cleanup()
+	segments, reg, warnings, err := extractDocument(local)
+	for i := range segments {
+		if segments[i].Meta.File != "" {
+			segments[i].Meta.File = entry
+		}
+	}
+	return segments, reg, warnings, err
+}
+
+// Warnings 抽取时跳过的非致命问题（无法解析的页、行、附件等）。抽取器把它当作 error
+// 与已得到的分段一起返回，extractDocument 不把它视为失败，而是记录到文件的诊断信息中
+type Warnings []string
+
+func (w Warnings) Error() string { return strings.Join(w, "; ") }
+
+// warnf 记录一条警告并输出日志
+func (w *Warnings) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("[KB] %s\n", msg)
+	*w = append(*w, msg)
+}
+
+// err 没有警告时返回 nil，避免返回值为空切片的非 nil error
+func (w Warnings) err() error {
+	if len(w) == 0 {
+		return nil
+	}
+	return w
+}
+
+// renderSegments 将分段拼接为预览文本
+func renderSegments(segments []Segment) string {
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		if t := strings.TrimSpace(s.Text); t != "" {
+			if label := s.Meta.Label(); label != "" {
+				t = "## " + label + "\n\n" + t
+			}
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// chunkSegments 按注册信息把分段切成检索分片，分片沿用所属分段的位置信息；
+// keep 为 true 时分段已是检索单元，不再切分。连续的分页分段（PDF）作为整体切分，
+// 段落可以跨页，分片记录起止页码
+func chunkSegments(segments []Segment, chunkSize, overlap int, keep bool) []Segment {
+	var chunks []Segment
+	splitter := newTextSplitter(chunkSize, overlap)
+	for i := 0; i < len(segments); i++ {
+		seg := segments[i]
+		if keep {
+			meta := seg.Meta
+			meta.CharStart, meta.CharEnd = 0, utf8.RuneCountInString(seg.Text)
+			chunks = append(chunks, labeledChunk(seg.Text, meta))
+			continue
+		}
+		if seg.Meta.Page > 0 {
+			j := i + 1
+			for j < len(segments) && segments[j].Meta.Page > 0 {
+				j++
+			}
+			chunks = append(chunks, chunkPages(segments[i:j], splitter)...)
+			i = j - 1
+			continue
+		}
+		offsets := runeOffsets{text: seg.Text}
+		for _, c := range splitter.split(seg.Text) {
+			meta := seg.Meta
+			meta.CharStart, meta.CharEnd = offsets.at(c.start), offsets.at(c.end)
+			chunks = append(chunks, labeledChunk(c.text, meta))
+		}
+	}
+	return chunks
+}
+
+// chunkPages 把各页文本以空行相连后切分，再按分片的字节区间换算起止页码
+func chunkPages(pages []Segment, splitter *textSplitter) []Segment {
+	var (
+		sb     strings.Builder
+		starts = make([]int, len(pages))
+	)
+	for i, p := range pages {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		starts[i] = sb.Len()
+		sb.WriteString(p.Text)
+	}
+	pageAt := func(offset int) int {
+		i, _ := slices.BinarySearch(starts, offset+1)
+		return max(i-1, 0)
+	}
+	// 页内字符偏移：分片起点相对起始页，终点相对结束页
+	charAt := func(page, offset int) int {
+		text := pages[page].Text
+		return utf8.RuneCountInString(text[:min(max(offset-starts[page], 0), len(text))])
+	}
+
+	var chunks []Segment
+	for _, c := range splitter.split(sb.String()) {
+		first, last := pageAt(c.start), pageAt(c.end-1)
+		meta := pages[first].Meta
+		if p := pages[last].Meta.Page; p > meta.Page {
+			meta.PageEnd = p
+		}
+		for _, p := range pages[first+1 : last+1] {
+			meta.OCR = meta.OCR || p.Meta.OCR
+		}
+		meta.CharStart, meta.CharEnd = charAt(first, c.start), charAt(last, c.end)
+		chunks = append(chunks, labeledChunk(c.text, meta))
+	}
+	return chunks
+}
+
+// runeOffsets 把字节偏移换算为字符偏移；相邻查询的位置接近，只统计两次查询之间的部分
+type runeOffsets struct {
+	text           string
+	byteOff, runes int
+}
+
+func (r *runeOffsets) at(offset int) int {
+	if offset >= r.byteOff {
+		r.runes += utf8.RuneCountInString(r.text[r.byteOff:offset])
+	} else {
+		r.runes -= utf8.RuneCountInString(r.text[offset:r.byteOff])
+	}
+	r.byteOff = offset
+	return r.runes
+}
+
+// labeledChunk 分片前加上位置标签，便于回答时引用（如 "幻灯片 12"）
+func labeledChunk(text string, meta SegmentMeta) Segment {
+	if label := meta.Label(); label != "" {
+		text = "[" + label + "]\n" + text
+	}
+	return Segment{Text: text, Meta: meta}
+}
@@ -0,0 +1,229 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"knowledge/internal/db"
+)
+
+func TestLookupExtractor(t *testing.T) {
+	dir := t.TempDir()
+
+	// 按扩展名匹配（大小写不敏感）
+	if _, ok := lookupExtractor(filepath.Join(dir, "Report.PDF")); !ok {
+		t.Errorf("expected extractor for .PDF")
+	}
+
+	// 无扩展名时按内容嗅探为纯文本
+	noExt := filepath.Join(dir, "README")
+	if err := os.WriteFile(noExt, []byte("hello knowledge base"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	reg, ok := lookupExtractor(noExt)
+	if !ok || reg.Name != "text" {
+		t.Errorf("expected text extractor by sniffing, got %+v", reg)
+	}
+
+	// 扩展名无法识别时不再嗅探，与目录扫描的判断一致
+	unknown := filepath.Join(dir, "notes.unknown")
+	if err := os.WriteFile(unknown, []byte("hello knowledge base"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, ok := lookupExtractor(unknown); ok {
+		t.Errorf("expected no extractor for unknown extension")
+	}
+	rules := newScanRules(dir, db.ScanSettings{}, nil)
+	var scanned []string
+	if err := rules.walk(dir, func(path string, info os.FileInfo) error {
+		scanned = append(scanned, filepath.Base(path))
+		return nil
+	}); err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if !slices.Equal(scanned, []string{"README"}) {
+		t.Errorf("expected scan to agree with lookupExtractor, got %v", scanned)
+	}
+}
+
+func TestChunkSegments(t *testing.T) {
+	segments := []Segment{
+		{Text: strings.Repeat("知识库。", 10), Meta: SegmentMeta{Page: 1}},
+		{Text: "row", Meta: SegmentMeta{Sheet: "Sheet1", RowStart: 2, RowEnd: 2}},
+	}
+
+	// 记录类分段原样保留
+	records := chunkSegments(segments, 10, 0, true)
+	if len(records) != 2 || records[1].Meta.Sheet != "Sheet1" {
+		t.Errorf("expected records to be kept as-is, got %+v", records)
+	}
+
+	// 普通分段按大小切分并继承元数据，记录字符偏移
+	chunks := chunkSegments(segments[:1], 10, 0, false)
+	if len(chunks) < 2 {
+		t.Fatalf("expected segment to be split, got %d chunks", len(chunks))
+	}
+	runes := []rune(segments[0].Text)
+	for _, c := range chunks {
+		if c.Meta.Page != 1 {
+			t.Errorf("expected chunk to keep page meta, got %+v", c.Meta)
+		}
+		if body := string(runes[c.Meta.CharStart:c.Meta.CharEnd]); !strings.HasSuffix(c.Text, "\n"+body) {
+			t.Errorf("char offsets [%d, %d) do not match chunk %q", c.Meta.CharStart, c.Meta.CharEnd, c.Text)
+		}
+	}
+}
+
+func TestChunkSegmentsSlideLabel(t *testing.T) {
+	segments := []Segment{{Text: "季度目标", Meta: SegmentMeta{Slide: 12}}}
+
+	chunks := chunkSegments(segments, 1000, 100, false)
+	if len(chunks) != 1 || !strings.HasPrefix(chunks[0].Text, "[幻灯片 12]\n") {
+		t.Errorf("expected slide label prefix, got %+v", chunks)
+	}
+	if got := renderSegments(segments); !strings.HasPrefix(got, "## 幻灯片 12") {
+		t.Errorf("expected slide heading in preview, got %q", got)
+	}
+}
+
+func TestMatchSymbol(t *testing.T) {
+	cases := []struct {
+		ext, line, want string
+	}{
+		{".py", "async def fetch(self, key):", "def fetch"},
+		{".ts", "export interface User {", "interface User"},
+		{".java", "public static <T> List<T> wrap(T t) {", "method wrap"},
+		{".java", "if (x > 0) {", ""},
+		{".sql", "CREATE TABLE IF NOT EXISTS users (", "table users"},
+	}
+	for _, c := range cases {
+		if got := matchSymbol(c.line, codeLanguages[c.ext].patterns); got != c.want {
+			t.Errorf("%s %q: expected %q, got %q", c.ext, c.line, c.want, got)
+		}
+	}
+}
+
+func TestChunkMarkdown(t *testing.T) {
+	code := "```sh\n# not a heading\n\n" + strings.Repeat("echo hi\n", 20) + "```"
+	table := "| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |"
+	doc := "# Install\n\n## Linux\n\nIntro text.\n\n### Troubleshooting\n\n" + code + "\n" + table + "\n\nMac\n===\n\nDone."
+
+	chunks := chunkSegments(markdownSections(doc), 30, 0, false)
+	want := []string{
+		"[Install > Linux]\nIntro text.",
+		"[Install > Linux > Troubleshooting]\n" + code, // 超长代码块保持完整，代码块内的 # 不当作标题
+		"[Install > Linux > Troubleshooting]\n" + table,
+		"[Mac]\nDone.",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i, c := range chunks {
+		if c.Text != want[i] {
+			t.Errorf("chunk %d: expected %q, got %q", i, want[i], c.Text)
+		}
+	}
+}
+
+func TestTextSplitter(t *testing.T) {
+	check := func(text string, sp *textSplitter, want []string) {
+		t.Helper()
+		chunks := sp.split(text)
+		got := make([]string, len(chunks))
+		for i, c := range chunks {
+			got[i] = c.text
+			if text[c.start:c.end] != c.text {
+				t.Errorf("chunk %q has wrong offsets [%d, %d)", c.text, c.start, c.end)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	// 在句末切分；相邻分片以上一分片末尾不超过 overlap 的句子开头
+	check("甲一。乙二。丙三。丁四。戊五。己六。", newTextSplitter(9, 3),
+		[]string{"甲一。乙二。丙三。", "丙三。丁四。戊五。", "戊五。己六。"})
+
+	// 段落放不下时退到句子，再退到分句
+	check("Short paragraph.\n\nA longer sentence, with a clause, and another clause here.", newTextSplitter(12, 0),
+		[]string{"Short paragraph.", "A longer sentence, with a clause,", "and another clause here."})
+
+	// 数字与网址中的标点不作为边界
+	if parts := splitAfter("pi is 3.14, see example.com. Next", isSentenceEnd); len(parts) != 2 {
+		t.Errorf("expected 2 sentences, got %q", parts)
+	}
+}
+
+func TestChunkPages(t *testing.T) {
+	pages := []Segment{
+		{Text: "第一页的内容。", Meta: SegmentMeta{Page: 1, File: "manual.pdf"}},
+		{Text: "第二页开头。", Meta: SegmentMeta{Page: 2, File: "manual.pdf"}},
+		{Text: strings.Repeat("第三页很长的段落。", 3), Meta: SegmentMeta{Page: 3, File: "manual.pdf"}},
+	}
+	chunks := chunkSegments(pages, 16, 0, false)
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %+v", chunks)
+	}
+	// 前两页合在一个分片里，标记页码范围
+	if first := chunks[0]; first.Meta.Page != 1 || first.Meta.PageEnd != 2 || !strings.HasPrefix(first.Text, "[manual.pdf p.1-2]\n") {
+		t.Errorf("expected chunk spanning p.1-2, got %+v", first)
+	}
+	if last := chunks[len(chunks)-1]; last.Meta.Page != 3 || last.Meta.PageEnd != 0 || !strings.HasPrefix(last.Text, "[manual.pdf p.3]\n") {
+		t.Errorf("expected chunk on p.3, got %+v", last)
+	}
+}
+
+func TestChunkPagesOCR(t *testing.T) {
+	pages := []Segment{
+		{Text: "第一页的内容。", Meta: SegmentMeta{Page: 1, File: "scan.pdf"}},
+		{Text: "扫描页识别结果。", Meta: SegmentMeta{Page: 2, File: "scan.pdf", OCR: true}},
+		{Text: strings.Repeat("第三页很长的段落。", 3), Meta: SegmentMeta{Page: 3, File: "scan.pdf"}},
+	}
+	chunks := chunkSegments(pages, 16, 0, false)
+	// 包含 OCR 页的分片标记为 OCR，纯文本层的分片不标记
+	for _, c := range chunks {
+		covers := c.Meta.Page <= 2 && max(c.Meta.Page, c.Meta.PageEnd) >= 2
+		if c.Meta.OCR != covers {
+			t.Errorf("chunk %+v: OCR = %v, want %v", c.Meta, c.Meta.OCR, covers)
+		}
+	}
+}
+
+func TestOCRArgs(t *testing.T) {
+	got := ocrArgs(strings.Fields("tesseract {input} stdout -l chi_sim+eng"), "/tmp/a b.png")
+	want := []string{"tesseract", "/tmp/a b.png", "stdout", "-l", "chi_sim+eng"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ocrArgs = %q, want %q", got, want)
+	}
+	got = ocrArgs([]string{"ocr-cli", "--image={input}"}, "x.png")
+	if !slices.Equal(got, []string{"ocr-cli", "--image=x.png"}) {
+		t.Errorf("ocrArgs with inline placeholder = %q", got)
+	}
+	got = ocrArgs([]string{"ocr-cli", "-q"}, "x.png")
+	if !slices.Equal(got, []string{"ocr-cli", "-q", "x.png"}) {
+		t.Errorf("ocrArgs without placeholder = %q", got)
+	}
+}
+
+func TestValidateOCRLanguages(t *testing.T) {
+	detectTesseract()
+	bin, langs := tesseract.bin, tesseract.langs
+	defer func() { tesseract.bin, tesseract.langs = bin, langs }()
+	tesseract.bin, tesseract.langs = "/usr/bin/tesseract", []string{"chi_sim", "eng", "osd"}
+
+	for _, ok := range []string{"", "eng", "chi_sim+eng"} {
+		if err := ValidateOCRLanguages(ok); err != nil {
+			t.Errorf("ValidateOCRLanguages(%q) = %v", ok, err)
+		}
+	}
+	// 只接受已安装的语言包，参数注入与未安装的语言都被拒绝
+	for _, bad := range []string{"fra", "eng --tessdata-dir /tmp", "eng+", "eng;rm"} {
+		if err := ValidateOCRLanguages(bad); err == nil {
+			t.Errorf("ValidateOCRLanguages(%q) should fail", bad)
+		}
+	}
+}
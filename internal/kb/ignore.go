@@ -0,0 +1,229 @@
+package kb
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoredDirs 版本控制、缓存与包管理器安装目录，里面不会有用户放置的文档，任何情况下都不纳入也不监听
+var ignoredDirs = map[string]bool{
+	".git": true, ".hg": true, ".svn": true,
+	"node_modules": true, "bower_components": true,
+	"__pycache__": true, ".mypy_cache": true,
+	"__MACOSX": true, // macOS 打包时附带的资源分叉目录
+}
+
+// dependencyDirs 依赖与 IDE 目录：位于代码仓库中时整体跳过；
+// 在普通文档目录中（如供应商资料放在 vendor 下）照常扫描，只跳过其中的源代码
+var dependencyDirs = map[string]bool{
+	"vendor": true, "venv": true, ".venv": true, ".tox": true,
+	".idea": true, ".vscode": true, ".gradle": true,
+}
+
+// repoMarkers 标识代码仓库根目录的版本控制目录
+var repoMarkers = []string{".git", ".hg", ".svn"}
+
+// systemDirs 操作系统维护的目录（回收站、索引、卷信息等），不纳入知识库
+var systemDirs = map[string]bool{
+	"$RECYCLE.BIN": true, "RECYCLER": true, "System Volume Information": true,
+	".Trash": true, ".Trashes": true, ".Spotlight-V100": true, ".fseventsd": true,
+	".TemporaryItems": true, ".DocumentRevisions-V100": true, "lost+found": true,
+}
+
+// generatedSuffixes 常见生成代码/压缩产物的文件名后缀
+var generatedSuffixes = []string{
+	".pb.go", "_pb2.py", "_pb2_grpc.py", ".pb.cc", ".pb.h",
+	"_generated.go", ".generated.ts", ".generated.cs", ".g.dart",
+	".min.js", ".bundle.js",
+}
+
+// generatedMarkers 生成代码文件头部的约定标记
+var generatedMarkers = [][]byte{
+	[]byte("DO NOT EDIT"),
+	[]byte("@generated"),
+	[]byte("<auto-generated"),
+	[]byte("autogenerated file"),
+}
+
+// lockFiles 包管理器生成的锁文件（JSON/YAML 格式，体积大且没有检索价值）
+var lockFiles = map[string]bool{
+	"package-lock.json": true, "npm-shrinkwrap.json": true, "pnpm-lock.yaml": true,
+	"composer.lock": true, "pipfile.lock": true, "flake.lock": true,
+}
+
+// isIgnoredDir 判断目录名是否在任何位置都整体跳过
+func isIgnoredDir(name string) bool {
+	return ignoredDirs[name]
+}
+
+// inIgnoredDir 判断路径是否位于被忽略的目录下（用于监听事件等直接给出文件路径的场景）
+func inIgnoredDir(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if isIgnoredDir(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLockFile 判断是否为包管理器锁文件
+func isLockFile(path string) bool {
+	return lockFiles[strings.ToLower(filepath.Base(path))]
+}
+
+// isGeneratedFile 判断源代码是否为生成文件：按文件名后缀或文件头部的生成标记
+func isGeneratedFile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 1024)
+	n, _ := f.Read(head)
+	head = head[:n]
+	// Go 约定：// Code generated ... DO NOT EDIT.
+	if bytes.Contains(head, []byte("Code generated")) {
+		return true
+	}
+	for _, marker := range generatedMarkers {
+		if bytes.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// kbIgnoreFile 目录根下的忽略规则文件，语法同 .gitignore
+const kbIgnoreFile = ".kbignore"
+
+// ignoreRule 一条 gitignore 语法的规则
+type ignoreRule struct {
+	pattern string // 原始规则，报告跳过原因时使用
+	source  string // 规则来源：settings 或 .kbignore
+	negate  bool   // 以 ! 开头：重新纳入
+	dirOnly bool   // 以 / 结尾：只匹配目录
+	re      *regexp.Regexp
+}
+
+// parseIgnoreRules 解析 gitignore 语法的规则：忽略空行与 # 注释，支持 !、**、结尾 / 与以 / 锚定到根目录
+func parseIgnoreRules(lines []string, source string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{pattern: line, source: source}
+		p := line
+		if strings.HasPrefix(p, "!") {
+			r.negate, p = true, p[1:]
+		} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly, p = true, strings.TrimRight(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+		// 含 / 的规则相对根目录匹配，否则匹配任意层级的名称
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		expr := globToRegexp(p)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// globToRegexp 把 gitignore 通配符转换为正则：* 与 ? 不跨目录，** 匹配任意层目录
+func globToRegexp(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// matchIgnoreRules 按顺序匹配规则，最后一条匹配的规则生效；rel 为相对根目录、以 / 分隔的路径。
+// 被忽略时返回生效的规则
+func matchIgnoreRules(rules []ignoreRule, rel string, isDir bool) (*ignoreRule, bool) {
+	var matched *ignoreRule
+	for i := range rules {
+		r := &rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			matched = r
+		}
+	}
+	if matched == nil || matched.negate {
+		return nil, false
+	}
+	return matched, true
+}
+
+// readIgnoreFile 读取目录根下的 .kbignore，不存在时返回空
+func readIgnoreFile(root string) []string {
+	f, err := os.Open(filepath.Join(root, kbIgnoreFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
@@ -0,0 +1,393 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"knowledge/internal/db"
+)
+
+const (
+	// jobMaxAttempts 每个阶段任务的最大执行次数（含首次）
+	jobMaxAttempts = 3
+	// jobIdlePoll 没有可执行任务时重新检查队列的最长间隔
+	jobIdlePoll = 2 * time.Second
+	// jobWaitPoll 同步流程等待任务结束时查询任务状态的间隔
+	jobWaitPoll = 300 * time.Millisecond
+	// 已完成/已取消的任务保留 7 天、最多 5000 条，每小时清理一次
+	jobRetention     = 7 * 24 * time.Hour
+	jobKeepFinished  = 5000
+	jobPruneInterval = time.Hour
+)
+
+// ErrJobState 任务当前的状态不允许重试或取消
+var ErrJobState = errors.New("job state does not allow this operation")
+
+// errJobFileRemoved 任务对应的文件记录已删除，任务直接取消而不重试
+var errJobFileRemoved = errors.New("file removed")
+
+// jobBackoff 第 attempt 次执行失败后的重试等待：10s 起按指数增长，最多 10 分钟
+func jobBackoff(attempt int) time.Duration {
+	const base, maxBackoff = 10 * time.Second, 10 * time.Minute
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 7 {
+		return maxBackoff
+	}
+	return min(base<<(attempt-1), maxBackoff)
+}
+
+// jobConcurrency 同时执行的任务数：根据 CPU 核心数自适应，限制在 4~16 之间
+func jobConcurrency() int {
+	return min(max(runtime.NumCPU()*2, 4), 16)
+}
+
+// StartJobs 启动后台任务执行器与向量补齐；首次调用时把上次退出时中断的任务放回队列，之后自动继续执行
+func (kb *KnowledgeBase) StartJobs() {
+	kb.jobsOnce.Do(func() {
+		if n, err := db.RequeueRunningKBJobs(); err != nil {
+			fmt.Printf("[KB] Failed to requeue interrupted jobs: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("[KB] Resuming %d interrupted jobs\n", n)
+		}
+		go kb.jobLoop()
+		go kb.backfillLoop()
+	})
+}
+
+// wakeJobs 通知执行器队列有变化
+func (kb *KnowledgeBase) wakeJobs() {
+	select {
+	case kb.jobWake <- struct{}{}:
+	default:
+	}
+}
+
+// jobsClosing 知识库是否正在关闭（关闭时中断的任务保持执行中，下次启动时恢复）
+func (kb *KnowledgeBase) jobsClosing() bool {
+	select {
+	case <-kb.jobsDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// syncContext 当前同步流程的上下文；停止同步时被取消
+func (kb *KnowledgeBase) syncContext() context.Context {
+	kb.syncMu.Lock()
+	defer kb.syncMu.Unlock()
+	return kb.ctx
+}
+
+// checkJob 在任务的处理循环中调用，支持暂停、停止同步与取消单个任务
+func (kb *KnowledgeBase) checkJob(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !kb.paused.Load() {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// pruneJobs 清理过期的已结束任务，避免任务表随同步次数无限增长
+func pruneJobs() {
+	if n, err := db.PruneKBJobs(time.Now().Add(-jobRetention), jobKeepFinished); err != nil {
+		fmt.Printf("[KB] Failed to prune finished jobs: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("[KB] Pruned %d finished jobs\n", n)
+	}
+}
+
+func (kb *KnowledgeBase) jobLoop() {
+	semaphore := make(chan struct{}, jobConcurrency())
+	var lastPrune time.Time
+	for {
+		select {
+		case semaphore <- struct{}{}:
+		case <-kb.jobsDone:
+			return
+		}
+
+		var job *db.KBJob
+		if !kb.paused.Load() {
+			var err error
+			if job, err = db.ClaimKBJob(); err != nil {
+				fmt.Printf("[KB] Failed to claim job: %v\n", err)
+			}
+		}
+		if job != nil {
+			go func(job db.KBJob) {
+				defer func() { <-semaphore }()
+				kb.runJob(job)
+			}(*job)
+			continue
+		}
+		<-semaphore
+
+		if time.Since(lastPrune) >= jobPruneInterval {
+			pruneJobs()
+			lastPrune = time.Now()
+		}
+
+		// 没有到期的任务：等待新任务、任务结束或最近一个重试到期
+		wait := jobIdlePoll
+		if !kb.paused.Load() {
+			if next, ok, err := db.NextKBJobRunAt(); err == nil && ok {
+				wait = min(max(time.Until(next), 50*time.Millisecond), jobIdlePoll)
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-kb.jobWake:
+		case <-timer.C:
+		case <-kb.jobsDone:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// runJob 执行一个任务并记录结果：失败时按退避策略重新排队，次数用完后文件标记为 error
+func (kb *KnowledgeBase) runJob(job db.KBJob) {
+	ctx, cancel := context.WithCancel(kb.syncContext())
+	kb.jobsMu.Lock()
+	kb.runningJobs[job.ID] = runningJob{path: job.Path, cancel: cancel}
+	kb.jobsMu.Unlock()
+	defer func() {
+		kb.jobsMu.Lock()
+		delete(kb.runningJobs, job.ID)
+		kb.jobsMu.Unlock()
+		cancel()
+		kb.wakeJobs()
+	}()
+
+	err := kb.runStage(ctx, job)
+	switch {
+	case err == nil:
+		err = db.FinishKBJob(job.ID, db.JobDone, "", time.Time{})
+	case ctx.Err() != nil:
+		if kb.jobsClosing() {
+			return
+		}
+		err = db.FinishKBJob(job.ID, db.JobCanceled, "canceled", time.Time{})
+	case errors.Is(err, errJobFileRemoved):
+		err = db.FinishKBJob(job.ID, db.JobCanceled, err.Error(), time.Time{})
+	case job.Attempts < job.MaxAttempts:
+		fmt.Printf("[KB] Job %d (%s %s) failed, retrying: %v\n", job.ID, job.Stage, job.Path, err)
+		_ = db.RecordKBFileError(job.FileID, failedStage(err, job.Stage), err.Error(), false)
+		err = db.FinishKBJob(job.ID, db.JobQueued, err.Error(), time.Now().Add(jobBackoff(job.Attempts)))
+	default:
+		fmt.Printf("Error processing file %s: %v\n", job.Path, err)
+		_ = db.RecordKBFileError(job.FileID, failedStage(err, job.Stage), err.Error(), true)
+		err = db.FinishKBJob(job.ID, db.JobFailed, err.Error(), time.Time{})
+	}
+	if err != nil {
+		fmt.Printf("[KB] Failed to update job %d: %v\n", job.ID, err)
+	}
+}
+
+// runStage 执行任务对应的阶段；extract 后仍有分片需要生成向量时排队 embed 阶段，否则文件处理完成
+func (kb *KnowledgeBase) runStage(ctx context.Context, job db.KBJob) error {
+	files, err := db.GetKBFilesByIDs([]uint{job.FileID})
+	if err != nil {
+		return err
+	}
+	f, ok := files[job.FileID]
+	if !ok {
+		return errJobFileRemoved
+	}
+
+	start := time.Now()
+	switch job.Stage {
+	case db.JobStageExtract:
+		res, err := kb.processFile(ctx, f)
+		if err != nil {
+			return err
+		}
+		if err := db.RecordKBFileExtract(f.ID, res.Chunks, res.Vectors, res.Warnings, time.Since(start)); err != nil {
+			return atStage(db.FileStageStore, err)
+		}
+		if res.NeedEmbed {
+			_, err := db.EnqueueKBJob(f.ID, db.JobStageEmbed, jobMaxAttempts)
+			return atStage(db.FileStageStore, err)
+		}
+	case db.JobStageEmbed:
+		err := kb.embedFile(ctx, f)
+		if rerr := db.RecordKBFileEmbed(f.ID, time.Since(start)); rerr != nil {
+			fmt.Printf("[KB] Failed to record embed stats for %s: %v\n", f.Path, rerr)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown job stage: %s", job.Stage)
+	}
+	return atStage(db.FileStageStore, db.MarkKBFileProcessed(f.ID))
+}
+
+// enqueueFiles 为文件排队 extract 任务；force 为 false 时跳过已有未结束任务的文件
+func (kb *KnowledgeBase) enqueueFiles(files []db.KnowledgeBaseFile, force bool) error {
+	kb.StartJobs()
+	defer kb.wakeJobs()
+	for _, f := range files {
+		if !force {
+			active, err := db.HasActiveKBJob(f.ID)
+			if err != nil {
+				return err
+			}
+			if active {
+				continue
+			}
+		}
+		if _, err := db.EnqueueKBJob(f.ID, db.JobStageExtract, jobMaxAttempts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForFiles 等待文件的任务全部结束（完成、失败、取消或等待重试），期间回报进度；
+// 返回失败或等待重试的文件的错误
+func (kb *KnowledgeBase) waitForFiles(files []db.KnowledgeBaseFile, onProgress func(settled int, current string), stop <-chan struct{}) error {
+	ctx := kb.syncContext()
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	ticker := time.NewTicker(jobWaitPoll)
+	defer ticker.Stop()
+	for {
+		latest, err := db.LatestKBJobs(ids)
+		if err != nil {
+			return err
+		}
+		settled := 0
+		var errs []error
+		for _, f := range files {
+			job, ok := latest[f.ID]
+			switch {
+			case !ok, job.Status == db.JobDone, job.Status == db.JobCanceled:
+				settled++
+			case job.Status == db.JobFailed:
+				settled++
+				errs = append(errs, fmt.Errorf("%s: %s", f.Path, job.Error))
+			case job.Status == db.JobQueued && job.Attempts > 0:
+				settled++
+				errs = append(errs, fmt.Errorf("%s: %s (will retry)", f.Path, job.Error))
+			}
+		}
+		if onProgress != nil {
+			onProgress(settled, kb.currentJobPath())
+		}
+		if settled == len(files) {
+			return errors.Join(errs...)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-kb.jobsDone:
+			return context.Canceled
+		case <-stop:
+			return context.Canceled
+		case <-ticker.C:
+		}
+	}
+}
+
+// currentJobPath 任意一个正在执行的任务的文件路径，用于进度展示
+func (kb *KnowledgeBase) currentJobPath() string {
+	kb.jobsMu.Lock()
+	defer kb.jobsMu.Unlock()
+	for _, j := range kb.runningJobs {
+		return j.path
+	}
+	return ""
+}
+
+// RetryJob 重新排队失败或已取消的任务；文件恢复为待处理
+func (kb *KnowledgeBase) RetryJob(id uint) error {
+	job, err := db.GetKBJob(id)
+	if err != nil {
+		return err
+	}
+	ok, err := db.RetryKBJob(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: job %d is %s", ErrJobState, id, job.Status)
+	}
+	if err := db.UpdateKBFileStatus(job.FileID, "pending"); err != nil {
+		return err
+	}
+	kb.StartJobs()
+	kb.wakeJobs()
+	return nil
+}
+
+// CancelJob 取消排队中或正在执行的任务；文件保持待处理，下次同步时重新处理
+func (kb *KnowledgeBase) CancelJob(id uint) error {
+	job, err := db.GetKBJob(id)
+	if err != nil {
+		return err
+	}
+	ok, err := db.CancelKBJob(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: job %d is %s", ErrJobState, id, job.Status)
+	}
+	kb.jobsMu.Lock()
+	if j, ok := kb.runningJobs[id]; ok {
+		j.cancel()
+	}
+	kb.jobsMu.Unlock()
+	return nil
+}
+
+// RetryFailedFiles 重新处理失败的文件（不指定集合时为全部），返回重新排队的文件数：
+// 最近一个任务失败时重试该任务（embed 阶段失败只补齐剩余向量），否则从 extract 阶段重新开始
+func (kb *KnowledgeBase) RetryFailedFiles(collectionIDs ...uint) (int, error) {
+	files, err := db.ListFailedKBFiles(collectionIDs)
+	if err != nil || len(files) == 0 {
+		return 0, err
+	}
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	latest, err := db.LatestKBJobs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	kb.StartJobs()
+	defer kb.wakeJobs()
+	for i, f := range files {
+		if err := db.UpdateKBFileStatus(f.ID, "pending"); err != nil {
+			return i, err
+		}
+		if job, ok := latest[f.ID]; ok && job.Status == db.JobFailed {
+			if ok, err := db.RetryKBJob(job.ID); err != nil {
+				return i, err
+			} else if ok {
+				continue
+			}
+		}
+		if _, err := db.EnqueueKBJob(f.ID, db.JobStageExtract, jobMaxAttempts); err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
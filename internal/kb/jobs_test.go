@@ -0,0 +1,23 @@
+package kb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  10 * time.Second,
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		6:  320 * time.Second,
+		7:  10 * time.Minute,
+		40: 10 * time.Minute,
+	}
+	for attempt, want := range cases {
+		if got := jobBackoff(attempt); got != want {
+			t.Errorf("jobBackoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
@@ -1,32 +1,26 @@
 package kb
 
 import (
-	"bytes"
 	"container/list"
 	"context"
 	"crypto/md5"
 	"encoding/binary"
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
-	"runtime"
 	"slices"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode"
 
 	"knowledge/internal/db"
 	"knowledge/internal/llm"
 
-	"github.com/ledongthuc/pdf"
-	"github.com/lu4p/cat"
-	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 type embeddingCacheEntry struct {
@@ -110,6 +104,9 @@ func (c *embeddingLRUCache) Set(key string, val []byte) {
 // 向量缓存 - 优化：减少重复内容的向量生成（有界 + TTL）
 var embeddingCache = newEmbeddingLRUCache(2048, 10*time.Minute)
 
+// EmbeddingCacheMaxEntries 持久化 embedding 缓存的条目上限，每批向量写入缓存后淘汰最久未使用的条目
+const EmbeddingCacheMaxEntries = 200000
+
 // ChunkProgress 文件分片进度信息
 type ChunkProgress struct {
 	FileName        string  `json:"file_name"`
@@ -118,19 +115,46 @@ type ChunkProgress struct {
 	Progress        float64 `json:"progress"`
 }
 
+// SyncStats 最近一次扫描的对账结果
+type SyncStats struct {
+	Added   int `json:"added"`
+	Changed int `json:"changed"`
+	Removed int `json:"removed"`
+	Renamed int `json:"renamed"`
+}
+
+// SkippedFile 扫描时跳过的文件或目录及原因
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// maxSkippedReport 同步进度中最多列出的跳过条目数，SkippedCount 仍为总数
+const maxSkippedReport = 500
+
 // SyncProgress 同步进度信息
 type SyncProgress struct {
-	TotalFiles     int             `json:"total_files"`
-	ProcessedFiles int             `json:"processed_files"`
-	CurrentFile    string          `json:"current_file"`
-	Status         string          `json:"status"`
-	Progress       float64         `json:"progress"`
-	ChunkProgress  []ChunkProgress `json:"chunk_progress"`
+	TotalFiles     int               `json:"total_files"`
+	ProcessedFiles int               `json:"processed_files"`
+	CurrentFile    string            `json:"current_file"`
+	Status         string            `json:"status"`
+	Progress       float64           `json:"progress"`
+	ChunkProgress  []ChunkProgress   `json:"chunk_progress"`
+	Stats          SyncStats         `json:"stats"`
+	Skipped        []SkippedFile     `json:"skipped"`
+	SkippedCount   int               `json:"skipped_count"`
+	Backfill       BackfillProgress  `json:"backfill"`
+	Reembed        []ReembedProgress `json:"reembed"`
 }
 
 type KnowledgeBase struct {
 	mu         sync.Mutex
 	progress   SyncProgress
+	stats      SyncStats
+	skipped    []SkippedFile
+	skipCount  int
+	backfill   BackfillProgress
+	reembed    []ReembedProgress
 	progressMu sync.Mutex
 	isSyncing  bool
 	syncMu     sync.Mutex
@@ -138,24 +162,85 @@ type KnowledgeBase struct {
 	cancel     context.CancelFunc
 
 	paused atomic.Bool
+
+	watchers []*folderWatcher
+	watchMu  sync.Mutex
+
+	// 持久化任务执行器
+	jobsOnce    sync.Once
+	jobWake     chan struct{}
+	jobsDone    chan struct{}
+	closeOnce   sync.Once
+	jobsMu      sync.Mutex
+	runningJobs map[uint]runningJob
+
+	backfillFailures map[uint]int // 后台补齐向量连续失败的次数，只在补齐协程中访问
+	reembedFailures  map[uint]int // 按集合统计重新生成向量连续失败的次数，只在补齐协程中访问
+}
+
+// runningJob 正在执行的任务，取消单个任务时使用
+type runningJob struct {
+	path   string
+	cancel context.CancelFunc
 }
 
 func NewKnowledgeBase() *KnowledgeBase {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &KnowledgeBase{ctx: ctx, cancel: cancel}
+	return &KnowledgeBase{
+		ctx:         ctx,
+		cancel:      cancel,
+		jobWake:     make(chan struct{}, 1),
+		jobsDone:    make(chan struct{}),
+		runningJobs: make(map[uint]runningJob),
+	}
 }
 
 func (kb *KnowledgeBase) Close() {
+	kb.StopWatching()
+	// 先标记关闭再取消上下文：被中断的任务保持执行中状态，下次启动时恢复
+	kb.closeOnce.Do(func() { close(kb.jobsDone) })
+	kb.syncMu.Lock()
 	if kb.cancel != nil {
 		kb.cancel()
 	}
+	kb.syncMu.Unlock()
 }
 
 // GetSyncProgress 获取当前同步进度
 func (kb *KnowledgeBase) GetSyncProgress() SyncProgress {
 	kb.progressMu.Lock()
 	defer kb.progressMu.Unlock()
-	return kb.progress
+	p := kb.progress
+	p.Stats = kb.stats
+	p.Skipped = slices.Clone(kb.skipped)
+	p.SkippedCount = kb.skipCount
+	p.Backfill = kb.backfill
+	p.Reembed = slices.Clone(kb.reembed)
+	return p
+}
+
+// resetSkipped 清空上一次扫描记录的跳过条目
+func (kb *KnowledgeBase) resetSkipped() {
+	kb.progressMu.Lock()
+	defer kb.progressMu.Unlock()
+	kb.skipped, kb.skipCount = nil, 0
+}
+
+// addSkipped 记录扫描时跳过的路径及原因（与扫描对账结果一样独立于进度保存）
+func (kb *KnowledgeBase) addSkipped(path, reason string) {
+	kb.progressMu.Lock()
+	defer kb.progressMu.Unlock()
+	kb.skipCount++
+	if len(kb.skipped) < maxSkippedReport {
+		kb.skipped = append(kb.skipped, SkippedFile{Path: path, Reason: reason})
+	}
+}
+
+// setSyncStats 记录扫描对账结果（独立于进度保存，避免被后续处理阶段的进度覆盖）
+func (kb *KnowledgeBase) setSyncStats(stats SyncStats) {
+	kb.progressMu.Lock()
+	defer kb.progressMu.Unlock()
+	kb.stats = stats
 }
 
 // UpdateSyncProgress 更新同步进度
@@ -194,6 +279,10 @@ func (kb *KnowledgeBase) CancelSync() {
 	kb.syncMu.Lock()
 	defer kb.syncMu.Unlock()
 
+	// 排队中的任务一并取消，文件保持待处理，下次同步继续
+	if _, err := db.CancelQueuedKBJobs(); err != nil {
+		fmt.Printf("[KB] Failed to cancel queued jobs: %v\n", err)
+	}
 	if kb.cancel != nil {
 		kb.cancel()
 	}
@@ -205,6 +294,26 @@ func (kb *KnowledgeBase) CancelSync() {
 	kb.paused.Store(false)
 }
 
+var errSyncInProgress = errors.New("sync already in progress")
+
+// beginSync 占用同步标记；已有同步/处理在进行时返回 errSyncInProgress
+func (kb *KnowledgeBase) beginSync() error {
+	kb.syncMu.Lock()
+	defer kb.syncMu.Unlock()
+	if kb.isSyncing {
+		return errSyncInProgress
+	}
+	kb.isSyncing = true
+	return nil
+}
+
+// endSync 释放同步标记
+func (kb *KnowledgeBase) endSync() {
+	kb.syncMu.Lock()
+	kb.isSyncing = false
+	kb.syncMu.Unlock()
+}
+
 // waitIfPaused 在分片/扫描循环中调用，支持暂停与停止
 func (kb *KnowledgeBase) waitIfPaused() error {
 	for {
@@ -240,8 +349,8 @@ func (kb *KnowledgeBase) updateChunkProgress(p ChunkProgress) {
 	}
 }
 
-// AddFile 添加单个文件到知识库并立即处理
-func (kb *KnowledgeBase) AddFile(path string) error {
+// AddFile 添加单个文件到指定集合并立即处理
+func (kb *KnowledgeBase) AddFile(collectionID uint, path string) error {
 	info, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -249,17 +358,18 @@ func (kb *KnowledgeBase) AddFile(path string) error {
 	if info.IsDir() {
 		return fmt.Errorf("path is a directory")
 	}
-
 	// 过滤以 .~ 开头的临时文件
 	filename := filepath.Base(path)
 	if strings.HasPrefix(filename, ".~") {
 		return fmt.Errorf("temporary file not supported: %s", filename)
 	}
+	if isArchive(path) {
+		return kb.addArchive(collectionID, path)
+	}
 
-	// 只处理文本相关文件
-	ext := strings.ToLower(filepath.Ext(path))
-	if !isSupportedExt(ext) {
-		return fmt.Errorf("unsupported file extension: %s", ext)
+	// 只处理已注册抽取器的文件（没有扩展名时按内容嗅探）
+	if _, ok := lookupExtractor(path); !ok {
+		return fmt.Errorf("unsupported file extension: %s", strings.ToLower(filepath.Ext(path)))
 	}
 
 	checksum, err := calculateMD5(path)
@@ -268,22 +378,44 @@ func (kb *KnowledgeBase) AddFile(path string) error {
 	}
 
 	// 存入数据库
-	kbFile, err := db.SaveKBFile(path, info.Size(), checksum)
+	kbFile, err := db.SaveKBFile(collectionID, path, info.Size(), checksum)
 	if err != nil {
 		return err
 	}
 
-	// 立即处理文件
-	if err := kb.processFile(*kbFile); err != nil {
-		_ = db.UpdateKBFileStatus(kbFile.ID, "error")
+	// 立即处理文件：排队任务并等待其结束
+	files := []db.KnowledgeBaseFile{*kbFile}
+	if err := kb.enqueueFiles(files, true); err != nil {
 		return err
 	}
+	return kb.waitForFiles(files, nil, nil)
+}
 
-	return db.UpdateKBFileStatus(kbFile.ID, "processed")
+// addArchive 展开压缩包，包内每个可索引文件作为独立文档加入集合并立即处理
+func (kb *KnowledgeBase) addArchive(collectionID uint, path string) error {
+	files, err := scanArchive(path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no supported files in archive: %s", filepath.Base(path))
+	}
+	kbFiles := make([]db.KnowledgeBaseFile, 0, len(files))
+	for _, file := range files {
+		kbFile, err := db.SaveKBFile(collectionID, file.path, file.size, file.checksum)
+		if err != nil {
+			return err
+		}
+		kbFiles = append(kbFiles, *kbFile)
+	}
+	if err := kb.enqueueFiles(kbFiles, true); err != nil {
+		return err
+	}
+	return kb.waitForFiles(kbFiles, nil, nil)
 }
 
-// ScanFolder 扫描文件夹并同步到数据库
-func (kb *KnowledgeBase) ScanFolder() error {
+// ScanFolder 扫描集合目录并同步到数据库；不指定集合时扫描全部集合
+func (kb *KnowledgeBase) ScanFolder(collectionIDs ...uint) error {
 	if kb.ctx != nil {
 		select {
 		case <-kb.ctx.Done():
@@ -292,35 +424,41 @@ func (kb *KnowledgeBase) ScanFolder() error {
 		}
 	}
 	// 检查是否正在同步中
-	kb.syncMu.Lock()
-	if kb.isSyncing {
-		kb.syncMu.Unlock()
-		return fmt.Errorf("sync already in progress")
+	if err := kb.beginSync(); err != nil {
+		return err
 	}
-	kb.isSyncing = true
-	kb.syncMu.Unlock()
-
 	// 函数结束时重置同步状态
-	defer func() {
-		kb.syncMu.Lock()
-		kb.isSyncing = false
-		kb.syncMu.Unlock()
-	}()
+	defer kb.endSync()
 
-	folder, err := db.GetKBFolder()
-	if err != nil || folder == "" {
+	collections, err := db.ListCollections()
+	if err != nil {
+		return err
+	}
+	if len(collectionIDs) > 0 {
+		collections = slices.DeleteFunc(collections, func(c db.KnowledgeBaseCollection) bool {
+			return !slices.Contains(collectionIDs, c.ID)
+		})
+	}
+	hasFolder := false
+	for _, c := range collections {
+		if len(c.Folders) > 0 {
+			hasFolder = true
+			break
+		}
+	}
+	if !hasFolder {
 		return fmt.Errorf("knowledge base folder not set")
 	}
 
 	// 重置进度
 	kb.ResetSyncProgress()
+	kb.setSyncStats(SyncStats{})
+	kb.resetSkipped()
 
-	// 收集所有文件信息
-	var files []struct {
-		path     string
-		info     os.FileInfo
-		checksum string
-	}
+	// 收集所有文件信息（按集合分组）
+	files := make(map[uint][]scannedFile, len(collections))
+	kept := make(map[uint][]string, len(collections))
+	totalFiles := 0
 
 	// 第一遍：收集文件信息
 	kb.UpdateSyncProgress(SyncProgress{
@@ -331,65 +469,54 @@ func (kb *KnowledgeBase) ScanFolder() error {
 		Progress:       0,
 	})
 
-	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
-		if kb.ctx != nil {
-			select {
-			case <-kb.ctx.Done():
-				return kb.ctx.Err()
-			default:
+	for _, c := range collections {
+		for _, folder := range c.Folders {
+			rules, err := loadScanRules(folder, kb.addSkipped)
+			if err != nil {
+				return err
 			}
-		}
-		if err := kb.waitIfPaused(); err != nil {
-			return err
-		}
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		// 过滤以 .~ 开头的临时文件
-		filename := filepath.Base(path)
-		if strings.HasPrefix(filename, ".~") {
-			return nil
-		}
-
-		// 只处理文本相关文件
-		ext := strings.ToLower(filepath.Ext(path))
-		if !isSupportedExt(ext) {
-			return nil
-		}
-
-		checksum, err := calculateMD5(path)
-		if err != nil {
-			return err
-		}
+			err = rules.walk(folder, func(path string, info os.FileInfo) error {
+				if kb.ctx != nil {
+					select {
+					case <-kb.ctx.Done():
+						return kb.ctx.Err()
+					default:
+					}
+				}
+				if err := kb.waitIfPaused(); err != nil {
+					return err
+				}
+				scanned, err := rules.scan(path, info)
+				if err != nil {
+					return err
+				}
+				if len(scanned) == 0 {
+					return nil
+				}
 
-		files = append(files, struct {
-			path     string
-			info     os.FileInfo
-			checksum string
-		}{path, info, checksum})
+				files[c.ID] = append(files[c.ID], scanned...)
+				totalFiles += len(scanned)
 
-		// 更新进度
-		kb.UpdateSyncProgress(SyncProgress{
-			TotalFiles:     len(files),
-			ProcessedFiles: 0,
-			CurrentFile:    path,
-			Status:         "scanning",
-			Progress:       0,
-		})
+				// 更新进度
+				kb.UpdateSyncProgress(SyncProgress{
+					TotalFiles:     totalFiles,
+					ProcessedFiles: 0,
+					CurrentFile:    path,
+					Status:         "scanning",
+					Progress:       0,
+				})
 
-		return nil
-	})
+				return nil
+			})
 
-	if err != nil {
-		return err
+			if err != nil {
+				return err
+			}
+			kept[c.ID] = append(kept[c.ID], rules.kept...)
+		}
 	}
 
-	// 第二遍：批量处理数据库操作
-	totalFiles := len(files)
+	// 第二遍：与数据库对账（新增 / 变更 / 改名 / 删除）
 	kb.UpdateSyncProgress(SyncProgress{
 		TotalFiles:     totalFiles,
 		ProcessedFiles: 0,
@@ -398,22 +525,32 @@ func (kb *KnowledgeBase) ScanFolder() error {
 		Progress:       0,
 	})
 
-	for i, file := range files {
-		_, err = db.SaveKBFile(file.path, file.info.Size(), file.checksum)
+	var stats SyncStats
+	base := 0
+	for _, c := range collections {
+		existing, err := db.ListKBFilesInCollection(c.ID)
 		if err != nil {
 			return err
 		}
-
-		// 更新进度
-		progress := float64(i+1) / float64(totalFiles) * 100
-		kb.UpdateSyncProgress(SyncProgress{
-			TotalFiles:     totalFiles,
-			ProcessedFiles: i + 1,
-			CurrentFile:    file.path,
-			Status:         "syncing",
-			Progress:       progress,
+		st, err := reconcileFiles(c.ID, files[c.ID], excludeKept(existing, kept[c.ID]), func(done int, path string) {
+			kb.UpdateSyncProgress(SyncProgress{
+				TotalFiles:     totalFiles,
+				ProcessedFiles: base + done,
+				CurrentFile:    path,
+				Status:         "syncing",
+				Progress:       float64(base+done) / float64(max(totalFiles, 1)) * 100,
+			})
 		})
+		if err != nil {
+			return err
+		}
+		base += len(files[c.ID])
+		stats.Added += st.Added
+		stats.Changed += st.Changed
+		stats.Removed += st.Removed
+		stats.Renamed += st.Renamed
 	}
+	kb.setSyncStats(stats)
 
 	kb.UpdateSyncProgress(SyncProgress{
 		TotalFiles:     totalFiles,
@@ -426,6 +563,94 @@ func (kb *KnowledgeBase) ScanFolder() error {
 	return nil
 }
 
+// scannedFile 扫描阶段收集到的文件（磁盘文件或压缩包内的文件）
+type scannedFile struct {
+	path     string
+	size     int64
+	checksum string
+}
+
+// withinPath 判断记录路径 f 是否为 p 本身、位于目录 p 之下或压缩包 p 之内
+func withinPath(f, p string) bool {
+	return f == p || strings.HasPrefix(f, p+string(filepath.Separator)) || strings.HasPrefix(f, p+archiveSep)
+}
+
+// excludeKept 从对账范围中去掉读取失败的路径下的记录，这些记录保持原样，等下次能读取时再对账
+func excludeKept(existing []db.KnowledgeBaseFile, kept []string) []db.KnowledgeBaseFile {
+	if len(kept) == 0 {
+		return existing
+	}
+	return slices.DeleteFunc(existing, func(f db.KnowledgeBaseFile) bool {
+		return slices.ContainsFunc(kept, func(p string) bool { return withinPath(f.Path, p) })
+	})
+}
+
+// reconcileFiles 将磁盘文件与数据库记录对账：新增/变更的文件置为 pending，
+// 内容相同但路径变化的视为改名（沿用原记录与分片，无需重新向量化），
+// existing 中在 files 里找不到的记录视为已删除，连同分片一起清理。
+// existing 只需包含本次对账范围内的记录。
+func reconcileFiles(collectionID uint, files []scannedFile, existing []db.KnowledgeBaseFile, onProgress func(done int, path string)) (SyncStats, error) {
+	var stats SyncStats
+
+	existingByPath := make(map[string]db.KnowledgeBaseFile, len(existing))
+	for _, f := range existing {
+		existingByPath[f.Path] = f
+	}
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		seen[file.path] = true
+	}
+
+	// 磁盘上已不存在的记录，按 checksum 建索引，用于识别改名/移动
+	missingByChecksum := make(map[string][]db.KnowledgeBaseFile)
+	for _, f := range existing {
+		if !seen[f.Path] {
+			missingByChecksum[f.Checksum] = append(missingByChecksum[f.Checksum], f)
+		}
+	}
+
+	for i, file := range files {
+		if old, ok := existingByPath[file.path]; ok {
+			if old.Size != file.size || old.Checksum != file.checksum {
+				stats.Changed++
+			}
+			if _, err := db.SaveKBFile(collectionID, file.path, file.size, file.checksum); err != nil {
+				return stats, err
+			}
+		} else if cands := missingByChecksum[file.checksum]; len(cands) > 0 {
+			old := cands[0]
+			missingByChecksum[file.checksum] = cands[1:]
+			if err := db.RenameKBFile(old.ID, file.path); err != nil {
+				return stats, err
+			}
+			stats.Renamed++
+		} else {
+			if _, err := db.SaveKBFile(collectionID, file.path, file.size, file.checksum); err != nil {
+				return stats, err
+			}
+			stats.Added++
+		}
+
+		if onProgress != nil {
+			onProgress(i+1, file.path)
+		}
+	}
+
+	// 剩余未被认领的缺失记录：文件已删除，清理其记录与分片
+	var removedIDs []uint
+	for _, cands := range missingByChecksum {
+		for _, f := range cands {
+			removedIDs = append(removedIDs, f.ID)
+		}
+	}
+	if err := db.PurgeKBFiles(removedIDs); err != nil {
+		return stats, err
+	}
+	stats.Removed = len(removedIDs)
+
+	return stats, nil
+}
+
 // ProcessFiles 处理待处理的文件
 func (kb *KnowledgeBase) ProcessFiles() error {
 	if kb.ctx != nil {
@@ -436,20 +661,11 @@ func (kb *KnowledgeBase) ProcessFiles() error {
 		}
 	}
 	// 检查是否正在同步中
-	kb.syncMu.Lock()
-	if kb.isSyncing {
-		kb.syncMu.Unlock()
-		return fmt.Errorf("sync already in progress")
+	if err := kb.beginSync(); err != nil {
+		return err
 	}
-	kb.isSyncing = true
-	kb.syncMu.Unlock()
-
 	// 函数结束时重置同步状态
-	defer func() {
-		kb.syncMu.Lock()
-		kb.isSyncing = false
-		kb.syncMu.Unlock()
-	}()
+	defer kb.endSync()
 
 	files, err := db.ListKBFiles()
 	if err != nil {
@@ -476,7 +692,6 @@ func (kb *KnowledgeBase) ProcessFiles() error {
 	}
 
 	totalFiles := len(pendingFiles)
-	var processedCount atomic.Int64
 
 	// 更新进度为处理开始
 	kb.UpdateSyncProgress(SyncProgress{
@@ -487,90 +702,15 @@ func (kb *KnowledgeBase) ProcessFiles() error {
 		Progress:       0,
 	})
 
-	// 并发处理文件
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(pendingFiles))
-	progressChan := make(chan struct{}, len(pendingFiles))
-	progressDone := make(chan struct{})
-
-	// 控制并发数量：根据 CPU 核心数自适应，避免在多核机器上过于保守
-	concurrencyLimit := runtime.NumCPU() * 2
-	if concurrencyLimit < 4 {
-		concurrencyLimit = 4
-	}
-	if concurrencyLimit > 16 {
-		concurrencyLimit = 16
+	// 每个文件排队一个持久化任务，由后台执行器并发处理；中断后重启会自动继续
+	if err := kb.enqueueFiles(pendingFiles, false); err != nil {
+		return err
 	}
-	semaphore := make(chan struct{}, concurrencyLimit)
-
-	for _, f := range pendingFiles {
-		wg.Add(1)
-		go func(file db.KnowledgeBaseFile) {
-			defer wg.Done()
-
-			if err := kb.waitIfPaused(); err != nil {
-				errChan <- err
-				return
-			}
-
-			if kb.ctx != nil {
-				select {
-				case <-kb.ctx.Done():
-					errChan <- kb.ctx.Err()
-					return
-				default:
-				}
-			}
-
-			// 申请信号量
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			// 更新当前处理的文件
-			cur := processedCount.Load()
-			kb.UpdateSyncProgress(SyncProgress{
-				TotalFiles:     totalFiles,
-				ProcessedFiles: int(cur),
-				CurrentFile:    file.Path,
-				Status:         "processing",
-				Progress:       float64(cur) / float64(totalFiles) * 100,
-			})
-
-			if err := kb.processFile(file); err != nil {
-				fmt.Printf("Error processing file %s: %v\n", file.Path, err)
-				_ = db.UpdateKBFileStatus(file.ID, "error")
-				errChan <- err
-				return
-			}
-
-			_ = db.UpdateKBFileStatus(file.ID, "processed")
-			progressChan <- struct{}{}
-		}(f)
+	err = kb.waitForFiles(pendingFiles, kb.processingProgress(totalFiles), nil)
+	if errors.Is(err, context.Canceled) {
+		return err
 	}
 
-	// 处理进度更新
-	go func() {
-		defer close(progressDone)
-		for range pendingFiles {
-			<-progressChan
-			cur := processedCount.Add(1)
-			progress := float64(cur) / float64(totalFiles) * 100
-			kb.UpdateSyncProgress(SyncProgress{
-				TotalFiles:     totalFiles,
-				ProcessedFiles: int(cur),
-				CurrentFile:    "",
-				Status:         "processing",
-				Progress:       progress,
-			})
-		}
-	}()
-
-	// 等待所有处理完成
-	wg.Wait()
-	close(errChan)
-	close(progressChan)
-	<-progressDone
-
 	// 更新进度为处理完成
 	kb.UpdateSyncProgress(SyncProgress{
 		TotalFiles:     totalFiles,
@@ -579,38 +719,50 @@ func (kb *KnowledgeBase) ProcessFiles() error {
 		Status:         "completed",
 		Progress:       100,
 	})
+	return err
+}
 
-	// 检查是否有错误
-	for err := range errChan {
-		if err != nil {
-			// 只返回第一个错误
-			return err
-		}
+// processingProgress 等待任务时回报处理进度
+func (kb *KnowledgeBase) processingProgress(totalFiles int) func(settled int, current string) {
+	return func(settled int, current string) {
+		kb.UpdateSyncProgress(SyncProgress{
+			TotalFiles:     totalFiles,
+			ProcessedFiles: settled,
+			CurrentFile:    current,
+			Status:         "processing",
+			Progress:       float64(settled) / float64(totalFiles) * 100,
+		})
 	}
-
-	return nil
 }
 
-// GetFileContent 获取文件内容
+// GetFileContent 获取文件内容（与索引共用抽取器，预览即索引所见）；源代码等显示原文，未注册的类型按纯文本读取
 func (kb *KnowledgeBase) GetFileContent(path string) (string, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".pdf":
-		return extractTextFromPDF(path)
-	case ".docx":
-		return extractTextFromDocx(path)
-	case ".xlsx", ".xls":
-		return extractTextFromXlsx(path)
-	case ".csv":
-		return extractTextFromCsv(path)
-	default:
-		// 默认处理文本文件
+	// 压缩包内的文件先解压到临时目录
+	local, cleanup, err := LocalFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	path = local
+
+	if reg, ok := lookupExtractor(path); ok && reg.RawPreview {
 		b, err := os.ReadFile(path)
 		if err != nil {
 			return "", err
 		}
 		return string(b), nil
 	}
+	segments, _, err := extractSegments(path)
+	if err != nil {
+		if _, ok := lookupExtractor(path); ok {
+			return "", err
+		}
+		segments, err = extractPlainText(path)
+		if err != nil {
+			return "", err
+		}
+	}
+	return renderSegments(segments), nil
 }
 
 // Float32SliceToBytes 将float32切片转换为字节数组
@@ -656,8 +808,8 @@ func CosineSimilarity(a, b []float32) float32 {
 
 // getEmbedding 获取文本的向量表示
 func getEmbedding(text string) ([]byte, error) {
-	// 计算文本哈希作为缓存键
-	hash := md5.Sum([]byte(text))
+	// 计算模型与文本的哈希作为缓存键（切换模型后不复用旧模型的向量）
+	hash := md5.Sum([]byte(currentEmbeddingModel() + "\x00" + text))
 	key := fmt.Sprintf("%x", hash)
 
 	// 检查缓存
@@ -682,108 +834,162 @@ func getEmbedding(text string) ([]byte, error) {
 	return vector, nil
 }
 
-func (kb *KnowledgeBase) processFile(f db.KnowledgeBaseFile) error {
-	// 确保“写入向量时使用的 embedding 模型”和“后续查询的 embedding 模型”一致
-	if llm.CurrentEngine != nil {
-		currentModel := strings.TrimSpace(llm.CurrentEngine.GetModelPath())
-		if currentModel != "" {
-			existingModel, _ := db.GetKBEmbeddingModel()
-			existingModel = strings.TrimSpace(existingModel)
-			if existingModel == "" {
-				_ = db.SetKBEmbeddingModel(currentModel)
-			} else if existingModel != currentModel {
-				return fmt.Errorf("embedding model changed (kb=%s, current=%s). please reset/rebuild knowledge base", existingModel, currentModel)
-			}
+// contentHash 持久化 embedding 缓存的键（分片内容的 SHA-256）
+func contentHash(text string) string {
+	return db.ContentHash(text)
+}
+
+// currentEmbeddingModel 当前生成向量的模型，引擎未初始化时返回空串（不使用持久化缓存）
+func currentEmbeddingModel() string {
+	if llm.CurrentEngine == nil {
+		return ""
+	}
+	return strings.TrimSpace(llm.CurrentEngine.GetModelPath())
+}
+
+// CachedEmbedding 生成单个文本的向量：先查持久化缓存，未命中时计算并写回（写入失败不影响结果）。
+// 用于检索时为导入阶段跳过向量的分片按需生成向量
+func CachedEmbedding(text string) ([]float32, error) {
+	model, hash := currentEmbeddingModel(), contentHash(text)
+	if cached, err := db.LookupEmbeddings(db.DB, model, []string{hash}); err == nil {
+		if v, ok := cached[hash]; ok {
+			return BytesToFloat32Slice(v), nil
 		}
 	}
+	vector, err := getEmbedding(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.SaveEmbeddings(db.DB, model, map[string][]byte{hash: vector}); err != nil {
+		fmt.Printf("[KB] Failed to save embedding cache: %v\n", err)
+	}
+	return BytesToFloat32Slice(vector), nil
+}
+
+// evictEmbeddingCache 把持久化 embedding 缓存控制在条目上限以内
+func evictEmbeddingCache() {
+	n, err := db.EvictEmbeddingCache(EmbeddingCacheMaxEntries)
+	if err != nil {
+		fmt.Printf("[KB] Failed to evict embedding cache: %v\n", err)
+		return
+	}
+	if n > 0 {
+		fmt.Printf("[KB] Evicted %d embedding cache entries\n", n)
+	}
+}
+
+// extractResult extract 阶段的结果，记录到文件的诊断信息中
+type extractResult struct {
+	Chunks    int
+	Vectors   int  // 写入时已有向量（来自持久化缓存）的分片数
+	NeedEmbed bool // 仍有分片需要在 embed 阶段生成向量
+	Warnings  Warnings
+}
+
+// stageError 标记失败发生在哪个处理阶段（extract/chunk/embed/store）
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// atStage 为错误标记处理阶段；err 为 nil 时返回 nil
+func atStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{stage: stage, err: err}
+}
 
-	ext := strings.ToLower(filepath.Ext(f.Path))
-	var (
-		content     string
-		indexChunks []string
-		err         error
-	)
-
-	switch ext {
-	case ".pdf":
-		content, err = extractTextFromPDF(f.Path)
-	case ".docx":
-		content, err = extractTextFromDocx(f.Path)
-	case ".xlsx", ".xls":
-		// 预览仍使用 markdown 表格；索引/检索使用行级语义编码（更适合按编号/成绩查询）
-		indexChunks, err = extractIndexChunksFromXlsx(f.Path)
-	default:
-		// 默认处理文本文件
-		var b []byte
-		b, err = os.ReadFile(f.Path)
-		if err == nil {
-			content = string(b)
+// failedStage 错误发生的处理阶段，未标记时返回 fallback
+func failedStage(err error, fallback string) string {
+	var se *stageError
+	if errors.As(err, &se) {
+		return se.stage
+	}
+	return fallback
+}
+
+// chunkSegmentsSafe 切分分段；切分过程中的 panic 转为 chunk 阶段的错误，只让当前文件失败
+func chunkSegmentsSafe(segments []Segment, chunkSize, overlap int, keepSegments bool) (chunks []Segment, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = atStage(db.FileStageChunk, fmt.Errorf("chunking panicked: %v", r))
 		}
+	}()
+	return chunkSegments(segments, chunkSize, overlap, keepSegments), nil
+}
+
+// processFile extract 阶段：抽取、切分并在单个事务中替换文件的分片（文本立即可检索）。
+// 持久化缓存中已有的向量直接写入；仍有分片缺少向量且需要生成时交给 embed 阶段
+func (kb *KnowledgeBase) processFile(ctx context.Context, f db.KnowledgeBaseFile) (res extractResult, err error) {
+	collection, err := db.GetCollection(f.CollectionID)
+	if err != nil {
+		return res, atStage(db.FileStageExtract, fmt.Errorf("collection %d not found: %w", f.CollectionID, err))
+	}
+
+	// 集合首次写入向量时记录 embedding 模型；模型变化后分片照常按当前模型写入（逐分片记录模型与维度），
+	// 集合已有的旧向量由后台的重新生成向量任务迁移，完成后整体切换
+	model := currentEmbeddingModel()
+	if model != "" && strings.TrimSpace(collection.EmbeddingModel) == "" {
+		_ = db.SetCollectionEmbeddingModel(collection.ID, model)
 	}
 
+	segments, reg, warnings, err := extractDocument(f.Path)
 	if err != nil {
-		return err
+		return res, atStage(db.FileStageExtract, err)
+	}
+	res.Warnings = warnings
+	// 表格同时物化为 SQLite 表供 SQL 查询；失败不影响文本索引
+	if err := materializeTables(f, reg); err != nil {
+		res.Warnings.warnf("Failed to materialize tables for %s: %v", filepath.Base(f.Path), err)
 	}
 
-	// 优化：根据文件类型调整分片大小
-	var chunks []string
-	switch ext {
-	case ".pdf":
-		chunks = splitText(content, 1500, 250) // PDF 内容更适合较大分片
-	case ".docx":
-		chunks = splitText(content, 1200, 200)
-	case ".xlsx", ".xls":
-		chunks = indexChunks
-	default:
-		chunks = splitText(content, 1000, 150) // 普通文本适当减小重叠
+	// 分片参数来自抽取器注册信息（可按类型设置，集合可统一覆盖）；行级记录类分段不再切分
+	settings, err := db.GetKBChunkSettings()
+	if err != nil {
+		res.Warnings.warnf("Failed to load chunk settings: %v", err)
+	}
+	chunkSize, overlap := chunkParams(reg, settings, collection)
+	chunks, err := chunkSegmentsSafe(segments, chunkSize, overlap, reg.Records || reg.Chunked)
+	if err != nil {
+		return res, err
 	}
 
 	// 过滤空切片
-	var validChunks []string
+	var validChunks []Segment
 	for _, chunk := range chunks {
-		if strings.TrimSpace(chunk) != "" {
+		if strings.TrimSpace(chunk.Text) != "" {
 			validChunks = append(validChunks, chunk)
 		}
 	}
 
-	if len(validChunks) == 0 {
-		return nil
-	}
-
-	// 创建文件分片进度对象
-	fileName := filepath.Base(f.Path)
 	totalChunks := len(validChunks)
-	processedChunks := 0
-	lastProgressUpdate := time.Now()
-	fileInfo, _ := os.Stat(f.Path)
-	fileSize := int64(0)
-	if fileInfo != nil {
-		fileSize = fileInfo.Size()
+	fileSize := f.Size
+	res.Chunks = totalChunks
+	if totalChunks == 0 {
+		res.Warnings.warnf("No text extracted from %s", filepath.Base(f.Path))
 	}
 
-	// 大文件导入加速：对超大 Excel 可跳过向量生成（仍保存文本，依赖编号/关键词检索；必要时查询阶段再按需生成向量）
+	// 大文件导入加速：对超大表格可跳过向量生成（仍保存文本，依赖编号/关键词检索；
+	// 引擎空闲时由后台补齐向量，补齐前查询阶段对少量候选按需生成向量）
 	skipEmbedding := false
-	if ext == ".xlsx" || ext == ".xls" {
+	if reg.Records {
 		// Excel 的“按编号/字段检索”主要依赖文本命中；大量向量生成会极慢。
 		// 因此对“中等规模以上”的 Excel 就跳过 embedding，以显著提升导入速度。
 		// （查询阶段仍可对少量候选按需生成向量做精排）
 		if totalChunks >= 200 || fileSize >= 3*1024*1024 || totalChunks >= 1200 || fileSize >= 15*1024*1024 {
 			skipEmbedding = true
+			res.Warnings.warnf("Skipped embedding for %d records of %s (vectors are backfilled in the background when idle)", totalChunks, filepath.Base(f.Path))
 		}
 	}
 
-	// 更新同步进度，添加分片进度信息
-	kb.updateChunkProgress(ChunkProgress{
-		FileName:        fileName,
-		TotalChunks:     totalChunks,
-		ProcessedChunks: 0,
-		Progress:        0,
-	})
-
 	// 单事务 + 批量写入：减少 SQLite 写锁争用，并避免中途失败导致数据不一致
 	tx := db.DB.Begin()
 	if tx.Error != nil {
-		return tx.Error
+		return res, atStage(db.FileStageStore, tx.Error)
 	}
 	defer func() {
 		if r := recover(); r != nil {
@@ -794,7 +1000,7 @@ func (kb *KnowledgeBase) processFile(f db.KnowledgeBaseFile) error {
 
 	if err := tx.Where("file_id = ?", f.ID).Delete(&db.KnowledgeBaseChunk{}).Error; err != nil {
 		_ = tx.Rollback()
-		return err
+		return res, atStage(db.FileStageStore, err)
 	}
 
 	batchSize := 200
@@ -803,53 +1009,44 @@ func (kb *KnowledgeBase) processFile(f db.KnowledgeBaseFile) error {
 	}
 	batch := make([]db.KnowledgeBaseChunk, 0, batchSize)
 
-	for _, chunkContent := range validChunks {
-		if err := kb.waitIfPaused(); err != nil {
+	// 持久化 embedding 缓存：内容未变的分片直接复用向量（在同一事务内读取，避免争用写锁）
+	cached := make(map[string][]byte)
+	if !skipEmbedding {
+		hashes := make([]string, len(validChunks))
+		for i, chunk := range validChunks {
+			hashes[i] = contentHash(chunk.Text)
+		}
+		if cached, err = db.LookupEmbeddings(tx, model, hashes); err != nil {
+			fmt.Printf("[KB] Failed to read embedding cache: %v\n", err)
+			cached = make(map[string][]byte)
+		}
+	}
+
+	for i, chunk := range validChunks {
+		if err := kb.checkJob(ctx); err != nil {
 			_ = tx.Rollback()
-			return err
+			return res, err
 		}
-		if kb.ctx != nil {
-			select {
-			case <-kb.ctx.Done():
-				_ = tx.Rollback()
-				return kb.ctx.Err()
-			default:
-			}
+		row := db.KnowledgeBaseChunk{
+			FileID:    f.ID,
+			Content:   chunk.Text,
+			ChunkMeta: chunkMeta(chunk, i+1),
 		}
-		// 生成向量（失败则降级为空向量，仍保留 content 供文本检索）
-		var vector []byte
 		if !skipEmbedding {
-			v, err := getEmbedding(chunkContent)
-			if err != nil {
-				fmt.Printf("Error getting embedding: %v\n", err)
-				v = nil
+			if v, ok := cached[contentHash(chunk.Text)]; ok {
+				row.Vector, row.EmbeddingModel, row.EmbeddingDim = v, model, len(v)/4
+				res.Vectors++
+			} else {
+				res.NeedEmbed = true
 			}
-			vector = v
 		}
 
-		batch = append(batch, db.KnowledgeBaseChunk{
-			FileID:  f.ID,
-			Content: chunkContent,
-			Vector:  vector,
-		})
-
-		processedChunks++
-		// 进度更新节流：大文件分片时避免每个 chunk 都加锁刷新
-		if processedChunks == totalChunks || processedChunks%25 == 0 || time.Since(lastProgressUpdate) >= 250*time.Millisecond {
-			progress := float64(processedChunks) / float64(totalChunks) * 100
-			kb.updateChunkProgress(ChunkProgress{
-				FileName:        fileName,
-				TotalChunks:     totalChunks,
-				ProcessedChunks: processedChunks,
-				Progress:        progress,
-			})
-			lastProgressUpdate = time.Now()
-		}
+		batch = append(batch, row)
 
 		if len(batch) >= batchSize {
 			if err := tx.CreateInBatches(batch, batchSize).Error; err != nil {
 				_ = tx.Rollback()
-				return err
+				return res, atStage(db.FileStageStore, err)
 			}
 			batch = batch[:0]
 		}
@@ -858,407 +1055,188 @@ func (kb *KnowledgeBase) processFile(f db.KnowledgeBaseFile) error {
 	if len(batch) > 0 {
 		if err := tx.CreateInBatches(batch, batchSize).Error; err != nil {
 			_ = tx.Rollback()
-			return err
+			return res, atStage(db.FileStageStore, err)
 		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
-		return err
+		return res, atStage(db.FileStageStore, err)
 	}
-
-	return nil
+	return res, nil
 }
 
-func extractIndexChunksFromXlsx(path string) ([]string, error) {
-	f, err := excelize.OpenFile(path)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = f.Close()
-	}()
+// embedBatchSize embed 阶段每批生成并提交的分片数
+const embedBatchSize = 50
 
-	fileInfo, err := os.Stat(path)
+// embedFile embed 阶段：为文件中还没有向量的分片分批生成向量，每批单独提交；
+// 中断或失败前已完成的分片照常写入，重试时只处理剩余分片
+func (kb *KnowledgeBase) embedFile(ctx context.Context, f db.KnowledgeBaseFile) error {
+	model := currentEmbeddingModel()
+	total, remaining, err := db.CountKBChunks(f.ID, model)
 	if err != nil {
-		return nil, err
-	}
-	fileSize := fileInfo.Size()
-
-	// 最大处理行数：文件大小每增加1MB，增加1000行，最大不超过200000行
-	maxProcessRows := int(fileSize/(1024*1024)) * 1000
-	if maxProcessRows < 1000 {
-		maxProcessRows = 1000
+		return err
 	}
-	if maxProcessRows > 200000 {
-		maxProcessRows = 200000
+	if remaining == 0 {
+		return nil
 	}
 
-	// chunk 越小需要算的 embedding 越多，会显著拖慢大文件导入。
-	// 对大文件提高 chunk 字符数上限，减少 embedding 次数，但仍保证“按行/按记录”可检索。
-	targetChunkChars := 5000
-	if maxProcessRows >= 20000 || fileSize >= 20*1024*1024 {
-		targetChunkChars = 12000
-	} else if maxProcessRows >= 10000 || fileSize >= 10*1024*1024 {
-		targetChunkChars = 8000
-	}
-	var chunks []string
+	// 创建文件分片进度对象
+	fileName := filepath.Base(f.Path)
+	totalChunks := int(total)
+	processedChunks := totalChunks - int(remaining)
+	lastProgressUpdate := time.Now()
+	kb.updateChunkProgress(ChunkProgress{
+		FileName:        fileName,
+		TotalChunks:     totalChunks,
+		ProcessedChunks: processedChunks,
+		Progress:        float64(processedChunks) / float64(totalChunks) * 100,
+	})
 
-	sheets := f.GetSheetList()
-	for _, sheet := range sheets {
-		rows, err := f.Rows(sheet)
+	for {
+		chunks, err := db.ListKBChunksWithoutVector(f.ID, model, embedBatchSize)
 		if err != nil {
-			continue
+			return err
 		}
-
-		var (
-			headers []string
-			rowNum  = 0
-			sb      strings.Builder
-		)
-		var line strings.Builder
-
-		flush := func() {
-			s := strings.TrimSpace(sb.String())
-			if s != "" {
-				chunks = append(chunks, s)
-			}
-			sb.Reset()
+		if len(chunks) == 0 {
+			return nil
 		}
 
-		for rows.Next() {
-			rowNum++
-			if rowNum > maxProcessRows {
-				break
-			}
-			cells, err := rows.Columns()
-			if err != nil {
-				continue
-			}
-			if rowNum == 1 {
-				// 表头行
-				headers = make([]string, len(cells))
-				for i := range cells {
-					headers[i] = strings.TrimSpace(cells[i])
-					if headers[i] == "" {
-						headers[i] = fmt.Sprintf("列%d", i+1)
-					}
-				}
-				continue
-			}
-
-			// 跳过空行
-			empty := true
-			for _, c := range cells {
-				if strings.TrimSpace(c) != "" {
-					empty = false
-					break
-				}
-			}
-			if empty {
-				continue
-			}
-
-			// 行级语义编码：工作表 + 行号 + 列名:值
-			line.Reset()
-			line.WriteString("工作表: ")
-			line.WriteString(sheet)
-			line.WriteString("；行: ")
-			line.WriteString(strconv.Itoa(rowNum))
-			line.WriteString("；")
-
-			limit := len(cells)
-			if len(headers) < limit {
-				limit = len(headers)
-			}
-			for i := 0; i < limit; i++ {
-				v := strings.TrimSpace(cells[i])
-				if v == "" {
-					continue
-				}
-				line.WriteString(headers[i])
-				line.WriteString(": ")
-				line.WriteString(v)
-				line.WriteString("；")
-			}
-
-			record := strings.TrimSpace(line.String())
-			if record == "" {
-				continue
-			}
-
-			// 控制 chunk 大小，保证记录不被截断
-			if sb.Len() > 0 && sb.Len()+len(record)+1 > targetChunkChars {
-				flush()
+		n, err := embedChunks(chunks, model, saveChunkVectors(model), func(done int) error {
+			if err := kb.checkJob(ctx); err != nil {
+				return err
 			}
-			if sb.Len() == 0 {
-				sb.WriteString("数据来源: Excel；文件: ")
-				sb.WriteString(filepath.Base(path))
-				sb.WriteString("\n")
+			// 进度更新节流：大文件分片时避免每个 chunk 都加锁刷新
+			if done > 0 && (done%25 == 0 || time.Since(lastProgressUpdate) >= 250*time.Millisecond) {
+				kb.updateChunkProgress(ChunkProgress{
+					FileName:        fileName,
+					TotalChunks:     totalChunks,
+					ProcessedChunks: processedChunks + done,
+					Progress:        float64(processedChunks+done) / float64(totalChunks) * 100,
+				})
+				lastProgressUpdate = time.Now()
 			}
-			sb.WriteString(record)
-			sb.WriteString("\n")
+			return nil
+		})
+		processedChunks += n
+		if err != nil {
+			return err
 		}
-
-		flush()
+		kb.updateChunkProgress(ChunkProgress{
+			FileName:        fileName,
+			TotalChunks:     totalChunks,
+			ProcessedChunks: processedChunks,
+			Progress:        float64(processedChunks) / float64(totalChunks) * 100,
+		})
 	}
-
-	return chunks, nil
 }
 
-func extractTextFromPDF(path string) (string, error) {
-	f, r, err := pdf.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
+// errEmbeddingModelChanged 生成向量的过程中切换了模型，已生成的部分按原模型写入，剩余分片稍后按新模型处理
+var errEmbeddingModelChanged = errors.New("embedding model changed")
 
-	var buf bytes.Buffer
-	b, err := r.GetPlainText()
-	if err != nil {
-		return "", err
-	}
-	_, err = buf.ReadFrom(b)
-	if err != nil {
-		return "", err
+// saveChunkVectors 把向量直接写入分片
+func saveChunkVectors(model string) func(tx *gorm.DB, vectors map[uint][]byte) error {
+	return func(tx *gorm.DB, vectors map[uint][]byte) error {
+		return db.SaveKBChunkVectors(tx, model, vectors)
 	}
-	return buf.String(), nil
-}
-
-func extractTextFromDocx(path string) (string, error) {
-	return cat.File(path)
 }
 
-func extractTextFromXlsx(path string) (string, error) {
-	f, err := excelize.OpenFile(path)
+// embedChunks 为一批分片生成向量（优先复用持久化缓存），并在一个事务中通过 save 写入向量、同时写入缓存。
+// 每个分片计算前调用 next（参数为本批已完成的分片数）；next 返回错误或生成失败时，
+// 已完成的部分照常写入，返回写入的分片数与该错误
+func embedChunks(chunks []db.KnowledgeBaseChunk, model string, save func(tx *gorm.DB, vectors map[uint][]byte) error, next func(done int) error) (int, error) {
+	hashes := make([]string, len(chunks))
+	for i, c := range chunks {
+		hashes[i] = contentHash(c.Content)
+	}
+	cached, err := db.LookupEmbeddings(db.DB, model, hashes)
 	if err != nil {
-		return "", err
+		fmt.Printf("[KB] Failed to read embedding cache: %v\n", err)
+		cached = make(map[string][]byte)
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Printf("关闭 Excel 文件出错: %v\n", err)
-		}
-	}()
-
-	var fullText strings.Builder
-	sheets := f.GetSheetList()
-	for _, sheet := range sheets {
-		// 添加工作表名称
-		fullText.WriteString("工作表: ")
-		fullText.WriteString(sheet)
-		fullText.WriteString("\n")
 
-		// 获取工作表的最大行数和列数
-		dimension, err := f.GetSheetDimension(sheet)
-		if err != nil {
-			continue
-		}
-
-		// 解析维度字符串，获取最大行号
-		maxRow := 0
-		if dimension != "" {
-			parts := strings.Split(dimension, ":")
-			if len(parts) == 2 {
-				endCell := parts[1]
-				rowStr := ""
-				for _, char := range endCell {
-					if unicode.IsDigit(char) {
-						rowStr += string(char)
-					}
-				}
-				if rowStr != "" {
-					maxRow, _ = strconv.Atoi(rowStr)
-				}
-			}
-		}
-
-		// 根据文件大小动态调整处理行数
-		fileInfo, err := os.Stat(path)
-		if err != nil {
-			continue
-		}
-		fileSize := fileInfo.Size()
-
-		// 计算最大处理行数：文件大小每增加1MB，增加1000行，最大不超过200000行
-		maxProcessRows := int(fileSize/(1024*1024)) * 1000
-		if maxProcessRows < 1000 {
-			maxProcessRows = 1000
-		}
-		if maxProcessRows > 200000 {
-			maxProcessRows = 200000
-		}
-
-		// 如果工作表行数小于最大处理行数，则处理所有行
-		if maxRow < maxProcessRows {
-			maxProcessRows = maxRow
-		}
-
-		// 获取所有行数据
-		rows, err := f.GetRows(sheet)
-		if err != nil {
-			continue
-		}
-
-		// 获取表头（第一行）
-		var headers []string
-		if len(rows) > 0 {
-			headerCells := rows[0]
-			headers = make([]string, len(headerCells))
-			copy(headers, headerCells)
-
-			// 写入markdown表格格式的表头
-			fullText.WriteString("| ")
-			for _, header := range headers {
-				fullText.WriteString(header)
-				fullText.WriteString(" | ")
-			}
-			fullText.WriteString("\n")
-
-			// 写入表头分隔线
-			fullText.WriteString("| ")
-			for _, header := range headers {
-				fullText.WriteString(strings.Repeat("-", len(header)))
-				fullText.WriteString(" | ")
-			}
-			fullText.WriteString("\n")
+	vectors := make(map[uint][]byte, len(chunks))
+	fresh := make(map[string][]byte)
+	var embedErr error
+	for i, c := range chunks {
+		if embedErr = next(len(vectors)); embedErr != nil {
+			break
 		}
-
-		// 逐行处理，避免一次性加载所有行
-		startRow := 1 // 从第二行开始处理数据（索引为1）
-		if len(rows) < startRow {
-			startRow = 0
+		if currentEmbeddingModel() != model {
+			embedErr = atStage(db.FileStageEmbed, errEmbeddingModelChanged)
+			break
 		}
-
-		for row := startRow; row < len(rows) && row < maxProcessRows; row++ {
-			cells := rows[row]
-
-			// 跳过空行
-			isEmptyRow := true
-			for _, cell := range cells {
-				if cell != "" {
-					isEmptyRow = false
-					break
-				}
-			}
-			if isEmptyRow {
-				continue
+		v, ok := cached[hashes[i]]
+		if !ok {
+			if v, err = getEmbedding(c.Content); err != nil {
+				embedErr = atStage(db.FileStageEmbed, fmt.Errorf("embed chunk %d: %w", c.Ordinal, err))
+				break
 			}
-
-			// 写入markdown表格格式的数据行
-			fullText.WriteString("| ")
-			for _, cell := range cells {
-				fullText.WriteString(cell)
-				fullText.WriteString(" | ")
+			if len(v) == 0 {
+				embedErr = atStage(db.FileStageEmbed, fmt.Errorf("embed chunk %d: empty embedding", c.Ordinal))
+				break
 			}
-			fullText.WriteString("\n")
+			cached[hashes[i]], fresh[hashes[i]] = v, v
 		}
-
-		// 添加工作表分隔符
-		fullText.WriteString("\n" + strings.Repeat("-", 80) + "\n\n")
+		vectors[c.ID] = v
 	}
-	return fullText.String(), nil
-}
-
-func extractTextFromCsv(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+	if len(vectors) == 0 {
+		return 0, embedErr
 	}
-	defer f.Close()
-
-	var fullText strings.Builder
-	reader := csv.NewReader(f)
 
-	// 根据文件大小动态调整处理行数
-	fileInfo, err := os.Stat(path)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := save(tx, vectors); err != nil {
+			return err
+		}
+		return db.SaveEmbeddings(tx, model, fresh)
+	})
 	if err != nil {
-		return "", err
-	}
-	fileSize := fileInfo.Size()
-
-	// 计算最大处理行数：文件大小每增加1MB，增加1000行，最大不超过200000行
-	maxProcessRows := int(fileSize/(1024*1024)) * 1000
-	if maxProcessRows < 1000 {
-		maxProcessRows = 1000
-	}
-	if maxProcessRows > 200000 {
-		maxProcessRows = 200000
+		return 0, atStage(db.FileStageStore, err)
 	}
-
-	// 添加文件名称
-	fullText.WriteString("CSV文件: ")
-	fullText.WriteString(filepath.Base(path))
-	fullText.WriteString("\n")
-
-	// 获取表头（第一行）
-	var headers []string
-	headerRow, err := reader.Read()
-	if err == nil {
-		headers = make([]string, len(headerRow))
-		copy(headers, headerRow)
-
-		// 写入markdown表格格式的表头
-		fullText.WriteString("| ")
-		for _, header := range headers {
-			fullText.WriteString(header)
-			fullText.WriteString(" | ")
-		}
-		fullText.WriteString("\n")
-
-		// 写入表头分隔线
-		fullText.WriteString("| ")
-		for _, header := range headers {
-			fullText.WriteString(strings.Repeat("-", len(header)))
-			fullText.WriteString(" | ")
-		}
-		fullText.WriteString("\n")
+	// 导入、补全向量与重新生成向量都经由这里写缓存，每批写入后即淘汰，长时间运行的任务也不会让缓存无限增长
+	if len(fresh) > 0 {
+		evictEmbeddingCache()
 	}
+	return len(vectors), embedErr
+}
 
-	// 逐行处理，避免一次性加载所有行
-	rowCount := 2 // 从第二行开始处理数据
-	for rowCount <= maxProcessRows {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		// 跳过空行
-		isEmptyRow := true
-		for _, cell := range row {
-			if cell != "" {
-				isEmptyRow = false
-				break
-			}
-		}
-		if isEmptyRow {
-			rowCount++
-			continue
-		}
-
-		// 写入markdown表格格式的数据行
-		fullText.WriteString("| ")
-		for _, cell := range row {
-			fullText.WriteString(cell)
-			fullText.WriteString(" | ")
-		}
-		fullText.WriteString("\n")
-
-		rowCount++
-	}
-
-	// 添加文件分隔符
-	fullText.WriteString("\n" + strings.Repeat("-", 80) + "\n\n")
-
-	return fullText.String(), nil
+// chunkMeta 把分片的位置信息转换为数据库中的元数据列
+func chunkMeta(chunk Segment, ordinal int) db.ChunkMeta {
+	m := chunk.Meta
+	meta := db.ChunkMeta{
+		Ordinal:    ordinal,
+		Slide:      m.Slide,
+		Sheet:      m.Sheet,
+		RowStart:   m.RowStart,
+		RowEnd:     m.RowEnd,
+		Heading:    m.Heading,
+		Symbol:     m.Symbol,
+		LineStart:  m.LineStart,
+		LineEnd:    m.LineEnd,
+		CharStart:  m.CharStart,
+		CharEnd:    m.CharEnd,
+		TokenCount: countTokens(chunk.Text),
+		OCR:        m.OCR,
+		Sender:     m.Sender,
+	}
+	if m.Page > 0 {
+		meta.PageStart, meta.PageEnd = m.Page, max(m.PageEnd, m.Page)
+	}
+	if !m.SentAt.IsZero() {
+		sentAt := m.SentAt.UTC()
+		meta.SentAt = &sentAt
+	}
+	return meta
 }
 
 func isSupportedExt(ext string) bool {
-	supported := []string{
-		".txt", ".md", ".pdf", ".docx", ".xlsx", ".xls", ".csv",
-	}
-	return slices.Contains(supported, ext)
+	_, ok := extractorForExt(ext)
+	return ok
+}
+
+// isSupportedFile 磁盘上的文件是否有可用的抽取器（与 AddFile 的判断一致）
+func isSupportedFile(path string) bool {
+	_, ok := lookupExtractor(path)
+	return ok
 }
 
 func calculateMD5(path string) (string, error) {
@@ -1275,37 +1253,3 @@ func calculateMD5(path string) (string, error) {
 
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
-
-func splitText(text string, chunkSize int, overlap int) []string {
-	if chunkSize <= 0 {
-		return []string{text}
-	}
-	if overlap < 0 {
-		overlap = 0
-	}
-	if overlap >= chunkSize {
-		overlap = chunkSize - 1
-	}
-
-	var chunks []string
-	runes := []rune(text)
-	n := len(runes)
-
-	if n == 0 {
-		return chunks
-	}
-
-	step := chunkSize - overlap
-	if step <= 0 {
-		step = 1
-	}
-
-	for i := 0; i < n; i += step {
-		end := min(i+chunkSize, n)
-		chunks = append(chunks, string(runes[i:end]))
-		if end == n {
-			break
-		}
-	}
-	return chunks
-}
@@ -0,0 +1,91 @@
+//go:build cgo
+
+package kb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"knowledge/internal/db"
+)
+
+// openTestDB 在临时目录中初始化数据库（go-sqlite3 需要 cgo）
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db.InitDB(filepath.Join(t.TempDir(), "knowledge.db"))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		db.DB = nil
+	})
+}
+
+func TestReconcileFiles(t *testing.T) {
+	openTestDB(t)
+	const collectionID = 1
+	save := func(path, checksum string) db.KnowledgeBaseFile {
+		f, err := db.SaveKBFile(collectionID, path, 10, checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateKBFileStatus(f.ID, "processed"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveKBChunk(f.ID, "content of "+path, nil); err != nil {
+			t.Fatal(err)
+		}
+		return *f
+	}
+	chunks := func(fileID uint) int64 {
+		var n int64
+		if err := db.DB.Model(&db.KnowledgeBaseChunk{}).Where("file_id = ?", fileID).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	moved := save("/docs/old/guide.md", "aaa")
+	changed := save("/docs/notes.md", "bbb")
+	deleted := save("/docs/removed.md", "ccc")
+	same := save("/docs/same.md", "ddd")
+
+	existing, err := db.ListKBFilesInCollection(collectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []scannedFile{
+		{path: "/docs/new/guide.md", size: 10, checksum: "aaa"},
+		{path: "/docs/notes.md", size: 12, checksum: "bbb2"},
+		{path: "/docs/same.md", size: 10, checksum: "ddd"},
+		{path: "/docs/added.md", size: 5, checksum: "eee"},
+	}
+	stats, err := reconcileFiles(collectionID, files, existing, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SyncStats{Added: 1, Changed: 1, Removed: 1, Renamed: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	// 内容相同、路径变化：沿用原记录与分片
+	rec, err := db.GetKBFileByPath("/docs/new/guide.md")
+	if err != nil || rec.ID != moved.ID || rec.Status != "processed" || chunks(moved.ID) != 1 {
+		t.Errorf("renamed file = %+v (%v), chunks = %d; want the original record with its chunk", rec, err, chunks(moved.ID))
+	}
+	// checksum 变化：重新置为 pending
+	if rec, err := db.GetKBFileByPath("/docs/notes.md"); err != nil || rec.ID != changed.ID || rec.Status != "pending" {
+		t.Errorf("changed file = %+v (%v), want pending", rec, err)
+	}
+	// 未变化的文件保持原状态
+	if rec, err := db.GetKBFileByPath("/docs/same.md"); err != nil || rec.ID != same.ID || rec.Status != "processed" {
+		t.Errorf("unchanged file = %+v (%v), want completed", rec, err)
+	}
+	// 新文件为 pending
+	if rec, err := db.GetKBFileByPath("/docs/added.md"); err != nil || rec.Status != "pending" {
+		t.Errorf("added file = %+v (%v), want pending", rec, err)
+	}
+	// 已删除的文件连同分片一起清理
+	if _, err := db.GetKBFileByPath("/docs/removed.md"); err == nil || chunks(deleted.ID) != 0 {
+		t.Errorf("deleted file still present (chunks = %d)", chunks(deleted.ID))
+	}
+}
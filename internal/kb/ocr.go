@@ -0,0 +1,185 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"knowledge/internal/db"
+)
+
+// ocrTimeout 单张图片（或单页 PDF 渲染）的处理超时；视觉模型在 CPU 上可能较慢
+const ocrTimeout = 3 * time.Minute
+
+// errOCRUnavailable 未通过 -ocr-cmd 指定 OCR 命令且 PATH 中找不到 tesseract，或 OCR 已被关闭
+var errOCRUnavailable = errors.New("OCR is not available: install tesseract or start the server with -ocr-cmd")
+
+// ocrCommandLine 启动参数 -ocr-cmd 指定的命令模板。命令只能来自本机启动参数，
+// 不能通过 HTTP 接口修改，否则任何能访问服务端口的人都可以执行任意命令
+var ocrCommandLine []string
+
+// SetOCRCommand 设置 OCR 命令模板（按空白拆分参数），在启动时调用；为空时使用 PATH 中的 tesseract
+func SetOCRCommand(command string) {
+	ocrCommandLine = strings.Fields(command)
+}
+
+var tesseract struct {
+	once  sync.Once
+	bin   string
+	langs []string
+}
+
+// detectTesseract 探测 PATH 中的 tesseract 及其已安装的语言包
+func detectTesseract() (string, []string) {
+	tesseract.once.Do(func() {
+		bin, err := exec.LookPath("tesseract")
+		if err != nil {
+			return
+		}
+		tesseract.bin = bin
+		if out, err := exec.Command(bin, "--list-langs").Output(); err == nil {
+			// 第一行是 "List of available languages ..." 说明文字
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			for _, l := range lines[1:] {
+				if l = strings.TrimSpace(l); l != "" {
+					tesseract.langs = append(tesseract.langs, l)
+				}
+			}
+		}
+	})
+	return tesseract.bin, tesseract.langs
+}
+
+// OCRLanguages 返回 tesseract 已安装的语言包，未安装 tesseract 时为空
+func OCRLanguages() []string {
+	_, langs := detectTesseract()
+	return langs
+}
+
+// ValidateOCRLanguages 校验 tesseract 语言设置（如 "chi_sim+eng"）：每一项都必须是已安装的语言包
+func ValidateOCRLanguages(languages string) error {
+	if languages == "" {
+		return nil
+	}
+	bin, langs := detectTesseract()
+	if bin == "" {
+		return errOCRUnavailable
+	}
+	for _, l := range strings.Split(languages, "+") {
+		if !slices.Contains(langs, l) {
+			return fmt.Errorf("tesseract language %q is not installed", l)
+		}
+	}
+	return nil
+}
+
+// ocrCommand 返回 OCR 命令模板：优先使用启动参数中的命令，否则使用自动探测到的 tesseract。
+// 设置中的语言须为已安装的语言包；未设置时若安装了简体中文语言包则同时识别中英文
+func ocrCommand() ([]string, error) {
+	var settings db.OCRSettings
+	if db.DB != nil {
+		var err error
+		if settings, err = db.GetKBOCRSettings(); err != nil {
+			return nil, err
+		}
+		if settings.Disabled {
+			return nil, errOCRUnavailable
+		}
+	}
+	if len(ocrCommandLine) > 0 {
+		return ocrCommandLine, nil
+	}
+	bin, langs := detectTesseract()
+	if bin == "" {
+		return nil, errOCRUnavailable
+	}
+	args := []string{bin, "{input}", "stdout"}
+	switch {
+	case settings.Languages != "" && ValidateOCRLanguages(settings.Languages) == nil:
+		args = append(args, "-l", settings.Languages)
+	case slices.Contains(langs, "chi_sim"):
+		args = append(args, "-l", "chi_sim+eng")
+	}
+	return args, nil
+}
+
+// ocrArgs 把命令模板中的 {input} 替换为图片路径；模板未包含 {input} 时追加在末尾
+func ocrArgs(tmpl []string, input string) []string {
+	args := make([]string, 0, len(tmpl)+1)
+	found := false
+	for _, a := range tmpl {
+		if strings.Contains(a, "{input}") {
+			found = true
+			a = strings.ReplaceAll(a, "{input}", input)
+		}
+		args = append(args, a)
+	}
+	if !found {
+		args = append(args, input)
+	}
+	return args
+}
+
+// ocrImage 调用 OCR 命令识别图片中的文字，结果取自标准输出
+func ocrImage(path string) (string, error) {
+	tmpl, err := ocrCommand()
+	if err != nil {
+		return "", err
+	}
+	args := ocrArgs(tmpl, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = msg[len(msg)-200:]
+		}
+		return "", fmt.Errorf("OCR command %s failed: %v %s", filepath.Base(args[0]), err, msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ocrPDFPage 用 pdftoppm（poppler-utils）把 PDF 的一页渲染为 300 DPI 的 PNG 后识别
+func ocrPDFPage(path string, page int) (string, error) {
+	bin, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return "", fmt.Errorf("pdftoppm (poppler-utils) is required to OCR scanned PDF pages: %w", errOCRUnavailable)
+	}
+	dir, err := os.MkdirTemp("", "kb-ocr-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+	out := filepath.Join(dir, "page")
+	n := strconv.Itoa(page)
+	if b, err := exec.CommandContext(ctx, bin, "-f", n, "-l", n, "-r", "300", "-png", "-singlefile", path, out).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("render page %d: %v %s", page, err, strings.TrimSpace(string(b)))
+	}
+	return ocrImage(out + ".png")
+}
+
+// OCREngine 返回当前生效的 OCR 命令模板，OCR 不可用时返回空串
+func OCREngine() string {
+	args, err := ocrCommand()
+	if err != nil {
+		return ""
+	}
+	return strings.Join(args, " ")
+}
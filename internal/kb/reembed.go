@@ -0,0 +1,149 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"knowledge/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// ReembedProgress 集合重新生成向量任务的进度：切换前集合保留旧模型的向量（查询向量来自新模型，期间只做关键词检索），完成后整体切换到新模型
+type ReembedProgress struct {
+	JobID        uint   `json:"job_id"`
+	CollectionID uint   `json:"collection_id"`
+	Collection   string `json:"collection"`
+	FromModel    string `json:"from_model"`
+	ToModel      string `json:"to_model"`
+	Status       string `json:"status"`
+	Total        int    `json:"total"`
+	Done         int    `json:"done"`
+}
+
+// updateReembed 修改指定任务的进度
+func (kb *KnowledgeBase) updateReembed(jobID uint, fn func(p *ReembedProgress)) {
+	kb.progressMu.Lock()
+	defer kb.progressMu.Unlock()
+	for i := range kb.reembed {
+		if kb.reembed[i].JobID == jobID {
+			fn(&kb.reembed[i])
+		}
+	}
+}
+
+// runReembed 为 embedding 模型与当前模型不一致的集合排队并执行重新生成向量任务；
+// 模型切换回集合记录的模型时取消未完成的任务。与补齐向量一样只在引擎空闲时执行
+func (kb *KnowledgeBase) runReembed() {
+	model := currentEmbeddingModel()
+	if model == "" {
+		return
+	}
+	collections, err := db.ListCollections()
+	if err != nil {
+		fmt.Printf("[KB] Failed to list collections: %v\n", err)
+		return
+	}
+	if kb.reembedFailures == nil {
+		kb.reembedFailures = make(map[uint]int)
+	}
+
+	var jobs []*db.KBReembedJob
+	var progress []ReembedProgress
+	for _, c := range collections {
+		from := strings.TrimSpace(c.EmbeddingModel)
+		active, err := db.ActiveKBReembedJob(c.ID)
+		if err != nil {
+			fmt.Printf("[KB] Failed to load re-embed job for collection %s: %v\n", c.Name, err)
+			continue
+		}
+		if from == "" || from == model {
+			if active != nil {
+				fmt.Printf("[KB] Canceling re-embed of collection %s: embedding model is %s again\n", c.Name, model)
+				if err := db.CancelKBReembedJob(active.ID, "embedding model switched back"); err != nil {
+					fmt.Printf("[KB] Failed to cancel re-embed job %d: %v\n", active.ID, err)
+				}
+			}
+			continue
+		}
+		if kb.reembedFailures[c.ID] >= backfillMaxFailures {
+			continue
+		}
+		job, err := db.StartKBReembedJob(c.ID, from, model)
+		if err != nil {
+			fmt.Printf("[KB] Failed to start re-embed job for collection %s: %v\n", c.Name, err)
+			continue
+		}
+		if active == nil || active.ID != job.ID {
+			fmt.Printf("[KB] Re-embedding collection %s: %s -> %s (%d chunks)\n", c.Name, from, model, job.Total)
+		}
+		jobs = append(jobs, job)
+		progress = append(progress, ReembedProgress{
+			JobID: job.ID, CollectionID: c.ID, Collection: c.Name,
+			FromModel: from, ToModel: model, Status: job.Status, Total: job.Total, Done: job.Done,
+		})
+	}
+	kb.progressMu.Lock()
+	kb.reembed = progress
+	kb.progressMu.Unlock()
+
+	for _, job := range jobs {
+		if kb.engineBusy() {
+			return
+		}
+		kb.updateReembed(job.ID, func(p *ReembedProgress) { p.Status = db.JobRunning })
+		err := kb.reembedCollection(job)
+		switch {
+		case err == nil:
+			delete(kb.reembedFailures, job.CollectionID)
+			fmt.Printf("[KB] Collection %d switched to embedding model %s\n", job.CollectionID, job.ToModel)
+			kb.updateReembed(job.ID, func(p *ReembedProgress) { p.Status = db.JobDone })
+		case errors.Is(err, errBackfillYield), errors.Is(err, errEmbeddingModelChanged):
+			kb.updateReembed(job.ID, func(p *ReembedProgress) { p.Status = db.JobQueued })
+			return
+		default:
+			kb.reembedFailures[job.CollectionID]++
+			fmt.Printf("[KB] Failed to re-embed collection %d: %v\n", job.CollectionID, err)
+			if err := db.FailKBReembedJob(job.ID, err.Error()); err != nil {
+				fmt.Printf("[KB] Failed to update re-embed job %d: %v\n", job.ID, err)
+			}
+			kb.updateReembed(job.ID, func(p *ReembedProgress) { p.Status = db.JobFailed })
+		}
+	}
+}
+
+// reembedCollection 用新模型为集合的分片分批生成向量并写入暂存表，全部完成后切换；引擎变忙时让出
+func (kb *KnowledgeBase) reembedCollection(job *db.KBReembedJob) error {
+	for {
+		chunks, err := db.ListKBChunksToReembed(job, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		// 记录生成向量所用的内容，切换时据此丢弃分片已被替换的暂存向量
+		hashes := make(map[uint]string, len(chunks))
+		for _, c := range chunks {
+			hashes[c.ID] = contentHash(c.Content)
+		}
+		stage := func(tx *gorm.DB, vectors map[uint][]byte) error {
+			return db.StageKBVectors(tx, job.ID, vectors, hashes)
+		}
+		if len(chunks) == 0 {
+			ok, err := db.CutoverKBReembedJob(job.ID)
+			if err != nil || ok {
+				return err
+			}
+			continue
+		}
+		n, err := embedChunks(chunks, job.ToModel, stage, func(int) error {
+			if kb.engineBusy() {
+				return errBackfillYield
+			}
+			return nil
+		})
+		kb.updateReembed(job.ID, func(p *ReembedProgress) { p.Done += n })
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package kb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"knowledge/internal/db"
+)
+
+// scanRules 扫描某个集合目录时的过滤规则：内置的忽略目录/文件、隐藏与系统目录、
+// 设置与 .kbignore 中的 gitignore 规则、按类型的大小上限与符号链接处理
+type scanRules struct {
+	root     string
+	settings db.ScanSettings
+	rules    []ignoreRule
+	onSkip   func(path, reason string)
+	onDir    func(path string) error // 每个纳入扫描的目录（含根目录）
+	dirsOnly bool                    // 只遍历目录（用于建立目录监听）
+	visited  map[string]bool         // 跟随符号链接时已遍历目录的真实路径，防止循环
+	repos    map[string]bool         // 目录是否位于代码仓库中（缓存）
+	kept     []string                // 读取失败的路径，对账时保留其下已有的记录
+}
+
+// loadScanRules 读取扫描设置与目录根下的 .kbignore
+func loadScanRules(root string, onSkip func(path, reason string)) (*scanRules, error) {
+	settings, err := db.GetKBScanSettings()
+	if err != nil {
+		return nil, err
+	}
+	return newScanRules(root, settings, onSkip), nil
+}
+
+func newScanRules(root string, settings db.ScanSettings, onSkip func(path, reason string)) *scanRules {
+	rules := parseIgnoreRules(settings.Ignore, "settings")
+	rules = append(rules, parseIgnoreRules(readIgnoreFile(root), kbIgnoreFile)...)
+	return &scanRules{root: filepath.Clean(root), settings: settings, rules: rules, onSkip: onSkip, visited: make(map[string]bool), repos: make(map[string]bool)}
+}
+
+func (r *scanRules) skip(path, reason string) {
+	if r.onSkip != nil {
+		r.onSkip(path, reason)
+	}
+}
+
+// keep 跳过读取失败的路径（损坏的压缩包、无权限的目录等），并在对账时保留其下已索引的记录，
+// 避免一次暂时性的读取错误清空这部分索引
+func (r *scanRules) keep(path, reason string) {
+	r.skip(path, reason)
+	r.kept = append(r.kept, path)
+}
+
+// rel 相对根目录、以 / 分隔的路径；不在根目录下时返回空串
+func (r *scanRules) rel(path string) string {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// dirSkipReason 目录被跳过的原因，纳入扫描时返回空串
+func (r *scanRules) dirSkipReason(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case systemDirs[name]:
+		return "system directory"
+	case isIgnoredDir(name):
+		return "dependency or VCS directory"
+	case dependencyDirs[name] && r.inRepository(filepath.Dir(path)):
+		return "dependency directory in code repository"
+	case strings.HasPrefix(name, ".") && !r.settings.IncludeHidden:
+		return "hidden directory"
+	}
+	if rule, ok := matchIgnoreRules(r.rules, r.rel(path), true); ok {
+		return fmt.Sprintf("excluded by %s rule %q", rule.source, rule.pattern)
+	}
+	return ""
+}
+
+// fileSkipReason 文件被跳过的原因，纳入扫描时返回空串；压缩包内的条目由 scan 按大小过滤
+func (r *scanRules) fileSkipReason(path string, info os.FileInfo) string {
+	name := filepath.Base(path)
+	if rule, ok := matchIgnoreRules(r.rules, r.rel(path), false); ok {
+		return fmt.Sprintf("excluded by %s rule %q", rule.source, rule.pattern)
+	}
+	switch {
+	case strings.HasPrefix(name, ".~"), strings.HasPrefix(name, "~$"):
+		return "temporary file"
+	case isArchive(path):
+		return ""
+	case isLockFile(path):
+		return "lock file"
+	case !isSupportedFile(path):
+		return "unsupported file type"
+	}
+	if reason := r.sizeSkipReason(path, info.Size()); reason != "" {
+		return reason
+	}
+	if isCodeExt(filepath.Ext(path)) {
+		if r.inDependencyDir(path) {
+			return "source code in dependency directory"
+		}
+		if isGeneratedFile(path) {
+			return "generated code"
+		}
+	}
+	return ""
+}
+
+// inRepository 目录（或其任一上级目录）是否包含版本控制目录
+func (r *scanRules) inRepository(dir string) bool {
+	dir = filepath.Clean(dir)
+	if v, ok := r.repos[dir]; ok {
+		return v
+	}
+	found := false
+	for _, marker := range repoMarkers {
+		if _, err := os.Lstat(filepath.Join(dir, marker)); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if parent := filepath.Dir(dir); parent != dir {
+			found = r.inRepository(parent)
+		}
+	}
+	r.repos[dir] = found
+	return found
+}
+
+// inDependencyDir 文件是否位于根目录下的依赖/IDE 目录中
+func (r *scanRules) inDependencyDir(path string) bool {
+	parts := strings.Split(r.rel(path), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if dependencyDirs[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeSkipReason 超过该类型的大小上限时返回原因
+func (r *scanRules) sizeSkipReason(path string, size int64) string {
+	if len(r.settings.MaxFileSizeMB) == 0 {
+		return ""
+	}
+	typ := "*"
+	limit, ok := 0, false
+	if reg, found := lookupExtractor(path); found {
+		typ = reg.Name
+		limit, ok = r.settings.MaxFileSizeMB[typ]
+	}
+	if !ok {
+		limit = r.settings.MaxFileSizeMB["*"]
+	}
+	if limit > 0 && size > int64(limit)<<20 {
+		return fmt.Sprintf("larger than %d MB limit for %s", limit, typ)
+	}
+	return ""
+}
+
+// walk 遍历 start（根目录或其下的文件/目录），对每个纳入扫描的文件调用 fn；跳过的路径通过 onSkip 报告。
+// 读取失败的子目录与文件同样跳过而不是中止整个扫描，并记入 kept，对账时保留其下已有的记录
+func (r *scanRules) walk(start string, fn func(path string, info os.FileInfo) error) error {
+	start = filepath.Clean(start)
+	info, err := os.Lstat(start)
+	if err != nil {
+		return err
+	}
+	if start != r.root {
+		// 增量同步直接给出的路径：祖先目录被跳过时，路径本身也不纳入
+		rel := r.rel(start)
+		parts := strings.Split(rel, "/")
+		for i := 1; i < len(parts); i++ {
+			dir := filepath.Join(r.root, filepath.FromSlash(strings.Join(parts[:i], "/")))
+			if reason := r.dirSkipReason(dir); reason != "" {
+				r.skip(start, reason)
+				return nil
+			}
+		}
+	}
+	return r.walkEntry(start, info, fn)
+}
+
+func (r *scanRules) walkEntry(path string, info os.FileInfo, fn func(path string, info os.FileInfo) error) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !r.settings.FollowSymlinks {
+			r.skip(path, "symbolic link")
+			return nil
+		}
+		target, err := os.Stat(path)
+		if err != nil {
+			r.skip(path, "broken symbolic link")
+			return nil
+		}
+		info = target
+	}
+
+	if !info.IsDir() {
+		if r.dirsOnly || filepath.Base(path) == kbIgnoreFile {
+			return nil
+		}
+		if reason := r.fileSkipReason(path, info); reason != "" {
+			r.skip(path, reason)
+			return nil
+		}
+		return fn(path, info)
+	}
+
+	if path != r.root {
+		if reason := r.dirSkipReason(path); reason != "" {
+			r.skip(path, reason)
+			return nil
+		}
+	}
+	if r.settings.FollowSymlinks {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			r.keep(path, fmt.Sprintf("unreadable directory: %v", err))
+			return nil
+		}
+		if r.visited[real] {
+			r.skip(path, "directory already scanned via another symbolic link")
+			return nil
+		}
+		r.visited[real] = true
+	}
+	if r.onDir != nil {
+		if err := r.onDir(path); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		r.keep(path, fmt.Sprintf("unreadable directory: %v", err))
+		return nil
+	}
+	for _, e := range entries {
+		child := filepath.Join(path, e.Name())
+		ci, err := e.Info()
+		if err != nil {
+			r.keep(child, fmt.Sprintf("unreadable: %v", err))
+			continue
+		}
+		if err := r.walkEntry(child, ci, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan 收集 walk 纳入的文件（压缩包展开为包内文件），包内文件同样按类型的大小上限过滤。
+// 读取失败的文件跳过并保留已有记录，不中止整个同步
+func (r *scanRules) scan(path string, info os.FileInfo) ([]scannedFile, error) {
+	if !isArchive(path) {
+		checksum, err := calculateMD5(path)
+		if err != nil {
+			r.keep(path, fmt.Sprintf("unreadable: %v", err))
+			return nil, nil
+		}
+		return []scannedFile{{path: path, size: info.Size(), checksum: checksum}}, nil
+	}
+	files, err := scanArchive(path)
+	if err != nil {
+		r.keep(path, fmt.Sprintf("unreadable archive: %v", err))
+		return nil, nil
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if reason := r.sizeSkipReason(f.path, f.size); reason != "" {
+			r.skip(f.path, reason)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
@@ -0,0 +1,218 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"knowledge/internal/db"
+)
+
+func TestScanDependencyDirs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel string) {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 普通文档目录：vendor 中的供应商资料照常纳入，只跳过其中的源代码
+	write("docs/vendor/acme/manual.md")
+	write("docs/vendor/acme/sdk.py")
+	write("docs/node_modules/x.md")
+	// 代码仓库：vendor 整体跳过
+	write("repo/.git/HEAD")
+	write("repo/README.md")
+	write("repo/vendor/lib/README.md")
+
+	skipped := make(map[string]string)
+	r := newScanRules(dir, db.ScanSettings{}, func(path, reason string) {
+		rel, _ := filepath.Rel(dir, path)
+		skipped[filepath.ToSlash(rel)] = reason
+	})
+	var got []string
+	if err := r.walk(dir, func(path string, info os.FileInfo) error {
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	if want := []string{"docs/vendor/acme/manual.md", "repo/README.md"}; !slices.Equal(got, want) {
+		t.Errorf("walk = %v, want %v", got, want)
+	}
+	for rel, want := range map[string]string{
+		"docs/vendor/acme/sdk.py": "source code in dependency directory",
+		"docs/node_modules":       "dependency or VCS directory",
+		"repo/vendor":             "dependency directory in code repository",
+	} {
+		if skipped[rel] != want {
+			t.Errorf("skip reason for %s = %q, want %q", rel, skipped[rel], want)
+		}
+	}
+}
+
+func TestScanKeepsUnreadableArchive(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.zip")
+	if err := os.WriteFile(broken, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reason string
+	r := newScanRules(dir, db.ScanSettings{}, func(path, r string) { reason = r })
+	info, _ := os.Stat(broken)
+	files, err := r.scan(broken, info)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("scan = %v, %v; want skipped without error", files, err)
+	}
+	if !slices.Equal(r.kept, []string{broken}) || !strings.HasPrefix(reason, "unreadable archive") {
+		t.Fatalf("kept = %v, reason = %q", r.kept, reason)
+	}
+
+	// 读取失败的压缩包内已索引的条目不参与对账，不会被当作已删除清理
+	existing := []db.KnowledgeBaseFile{
+		{Path: broken + archiveSep + "a.md"},
+		{Path: filepath.Join(dir, "other.md")},
+		{Path: broken + ".md"},
+	}
+	got := excludeKept(existing, r.kept)
+	if len(got) != 2 || got[0].Path != filepath.Join(dir, "other.md") || got[1].Path != broken+".md" {
+		t.Errorf("excludeKept = %+v", got)
+	}
+}
+
+func TestScanRules(t *testing.T) {
+	rules := parseIgnoreRules([]string{"# comment", "*.log", "!keep.log", "build/", "/drafts/*.md", "docs/**/tmp"}, "settings")
+	cases := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"sub/a.log", false, true},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, true},
+		{"build", false, false},
+		{"drafts/x.md", false, true},
+		{"sub/drafts/x.md", false, false},
+		{"docs/tmp", true, true},
+		{"docs/a/b/tmp", true, true},
+		{"notes.md", false, false},
+	}
+	for _, c := range cases {
+		if _, ok := matchIgnoreRules(rules, c.rel, c.isDir); ok != c.ignored {
+			t.Errorf("matchIgnoreRules(%q, dir=%v) = %v, want %v", c.rel, c.isDir, ok, c.ignored)
+		}
+	}
+
+	dir := t.TempDir()
+	write := func(rel string, size int) {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(strings.Repeat("a", size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", 10)
+	write("big.txt", 2<<20)
+	write("big.md", 2<<20)
+	write("secret/b.txt", 10)
+	write(".hidden/c.txt", 10)
+	write("node_modules/d.txt", 10)
+	write("~$tmp.docx", 10)
+	write(".kbignore", 0)
+	if err := os.WriteFile(filepath.Join(dir, ".kbignore"), []byte("secret/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	symlink := os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt")) == nil
+
+	skipped := make(map[string]string)
+	settings := db.ScanSettings{MaxFileSizeMB: map[string]int{"text": 1}}
+	r := newScanRules(dir, settings, func(path, reason string) {
+		rel, _ := filepath.Rel(dir, path)
+		skipped[filepath.ToSlash(rel)] = reason
+	})
+	var got []string
+	err := r.walk(dir, func(path string, info os.FileInfo) error {
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	if want := []string{"a.txt", "big.md"}; !slices.Equal(got, want) {
+		t.Errorf("walk = %v, want %v", got, want)
+	}
+	for rel, want := range map[string]string{
+		"big.txt":      "larger than 1 MB limit for text",
+		"secret":       `excluded by .kbignore rule "secret/"`,
+		".hidden":      "hidden directory",
+		"node_modules": "dependency or VCS directory",
+		"~$tmp.docx":   "temporary file",
+	} {
+		if skipped[rel] != want {
+			t.Errorf("skip reason for %s = %q, want %q", rel, skipped[rel], want)
+		}
+	}
+	if symlink && skipped["link.txt"] != "symbolic link" {
+		t.Errorf("skip reason for link.txt = %q", skipped["link.txt"])
+	}
+
+	// 增量同步直接给出被排除目录下的文件
+	got = nil
+	if err := r.walk(filepath.Join(dir, "secret", "b.txt"), func(path string, info os.FileInfo) error {
+		got = append(got, path)
+		return nil
+	}); err != nil || len(got) != 0 {
+		t.Errorf("walk of excluded file = %v, %v", got, err)
+	}
+}
+
+func TestScanKeepsUnreadablePaths(t *testing.T) {
+	dir := t.TempDir()
+	r := newScanRules(dir, db.ScanSettings{}, nil)
+
+	// 扫描到之后、计算 checksum 之前被删除或无法读取的文件：跳过但不中止同步
+	gone := filepath.Join(dir, "gone.md")
+	if err := os.WriteFile(gone, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(gone)
+	os.Remove(gone)
+	if files, err := r.scan(gone, info); err != nil || len(files) != 0 {
+		t.Fatalf("scan = %v, %v; want skipped without error", files, err)
+	}
+	if !slices.Equal(r.kept, []string{gone}) {
+		t.Fatalf("kept = %v, want %v", r.kept, []string{gone})
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced for root")
+	}
+	locked := filepath.Join(dir, "locked")
+	if err := os.MkdirAll(filepath.Join(locked, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+	r = newScanRules(dir, db.ScanSettings{}, nil)
+	if err := r.walk(dir, func(string, os.FileInfo) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(r.kept, []string{locked}) {
+		t.Errorf("kept = %v, want %v", r.kept, []string{locked})
+	}
+}
@@ -0,0 +1,259 @@
+package kb
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"knowledge/internal/llm"
+)
+
+// textSplitter 递归文本切分器：依次尝试在段落、行、句子、分句、词的边界切分，
+// 长度按当前 embedding 模型的 token 计；围栏代码块与 Markdown 表格作为整体不拆开
+type textSplitter struct {
+	chunkSize int
+	overlap   int
+	count     func(string) int
+}
+
+func newTextSplitter(chunkSize, overlap int) *textSplitter {
+	if overlap < 0 {
+		overlap = 0
+	}
+	if chunkSize > 0 && overlap >= chunkSize {
+		overlap = chunkSize / 2
+	}
+	return &textSplitter{chunkSize: chunkSize, overlap: overlap, count: countTokens}
+}
+
+// textPiece 待合并的文本片段及其 token 数，start 为在原文中的字节偏移
+type textPiece struct {
+	text   string
+	start  int
+	tokens int
+}
+
+// textChunk 切分结果：去除首尾空白后的文本及其在原文中的字节区间 [start, end)
+type textChunk struct {
+	text       string
+	start, end int
+}
+
+// splitLevels 由粗到细的切分方式；每种方式都保留分隔符，片段拼接后与原文一致
+var splitLevels = []func(string) []string{
+	splitParagraphs,
+	func(s string) []string { return splitAfter(s, func(r, next rune) bool { return r == '\n' }) },
+	func(s string) []string { return splitAfter(s, isSentenceEnd) },
+	func(s string) []string { return splitAfter(s, isClauseEnd) },
+	func(s string) []string { return splitAfter(s, func(r, next rune) bool { return unicode.IsSpace(r) }) },
+}
+
+// split 切分文本，返回去除首尾空白后的分片
+func (s *textSplitter) split(text string) []textChunk {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if s.chunkSize <= 0 {
+		return s.merge([]textPiece{{text: text}})
+	}
+	return s.splitLevel(text, 0, 0)
+}
+
+// splitLevel 按当前层级切分：放得下的相邻片段合并成分片，放不下的片段单独递归到更细的层级，
+// 因此一个分片不会跨越更粗一级的边界（如半个段落拼上下一段的开头）
+func (s *textSplitter) splitLevel(text string, level, base int) []textChunk {
+	var (
+		chunks []textChunk
+		fits   []textPiece
+		pos    = base
+	)
+	for _, part := range splitLevels[level](text) {
+		start := pos
+		pos += len(part)
+		n := s.count(part)
+		if n <= s.chunkSize || (level == 0 && isAtomicBlock(part)) {
+			fits = append(fits, textPiece{text: part, start: start, tokens: n})
+			continue
+		}
+		chunks = append(chunks, s.merge(fits)...)
+		fits = nil
+		if level+1 < len(splitLevels) {
+			chunks = append(chunks, s.splitLevel(part, level+1, start)...)
+		} else {
+			chunks = append(chunks, s.merge(s.hardCut(part, start, n))...)
+		}
+	}
+	return append(chunks, s.merge(fits)...)
+}
+
+// hardCut 没有任何边界可用时（如超长 URL、Base64）按字符数等分
+func (s *textSplitter) hardCut(text string, start, tokens int) []textPiece {
+	runes := []rune(text)
+	size := max(1, len(runes)*s.chunkSize/max(tokens, 1))
+	var out []textPiece
+	for i := 0; i < len(runes); i += size {
+		part := string(runes[i:min(i+size, len(runes))])
+		out = append(out, textPiece{text: part, start: start, tokens: s.count(part)})
+		start += len(part)
+	}
+	return out
+}
+
+// merge 贪心合并相邻片段；新分片以上一分片末尾不超过 overlap 的若干片段开头
+func (s *textSplitter) merge(pieces []textPiece) []textChunk {
+	var (
+		chunks []textChunk
+		cur    []textPiece
+		total  int
+	)
+	emit := func() {
+		var sb strings.Builder
+		for _, p := range cur {
+			sb.WriteString(p.text)
+		}
+		raw := sb.String()
+		if text := strings.TrimSpace(raw); text != "" {
+			start := cur[0].start + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace))
+			chunks = append(chunks, textChunk{text: text, start: start, end: start + len(text)})
+		}
+	}
+	for _, p := range pieces {
+		if len(cur) > 0 && total+p.tokens > s.chunkSize {
+			emit()
+			keep, kept := len(cur), 0
+			for keep > 0 {
+				n := cur[keep-1].tokens
+				if kept+n > s.overlap || kept+n+p.tokens > s.chunkSize {
+					break
+				}
+				kept += n
+				keep--
+			}
+			cur, total = append([]textPiece(nil), cur[keep:]...), kept
+		}
+		cur = append(cur, p)
+		total += p.tokens
+	}
+	if len(cur) > 0 {
+		emit()
+	}
+	return chunks
+}
+
+// splitParagraphs 按空行切分段落；围栏代码块内部的空行不作为边界
+func splitParagraphs(text string) []string {
+	var (
+		parts []string
+		start int
+		fence string
+		blank bool
+	)
+	pos := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if mdIsFenceClose(strings.TrimRight(line, "\r\n"), fence) {
+				fence = ""
+			}
+		case trimmed == "":
+			blank = true
+		default:
+			if blank && pos > start {
+				parts = append(parts, text[start:pos])
+				start = pos
+			}
+			blank = false
+			if m := mdFenceOpen.FindStringSubmatch(line); m != nil {
+				fence = m[1]
+			}
+		}
+		pos += len(line)
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
+
+// isAtomicBlock 判断段落是否为围栏代码块或 Markdown 表格
+func isAtomicBlock(paragraph string) bool {
+	p := strings.TrimSpace(paragraph)
+	if mdFenceOpen.MatchString(p) {
+		return true
+	}
+	lines := strings.SplitN(p, "\n", 3)
+	return len(lines) >= 2 && strings.Contains(lines[0], "|") && strings.Contains(lines[1], "-") && mdTableDelim.MatchString(lines[1])
+}
+
+// splitAfter 在满足 boundary 的字符之后切分；紧随其后的右引号/括号与空白归入前一片段
+func splitAfter(text string, boundary func(r, next rune) bool) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next, _ := utf8.DecodeRuneInString(text[i+size:])
+		i += size
+		if !boundary(r, next) {
+			continue
+		}
+		for i < len(text) {
+			c, n := utf8.DecodeRuneInString(text[i:])
+			if !strings.ContainsRune(`"')]}”’」』）】》`, c) && c != ' ' && c != '\t' {
+				break
+			}
+			i += n
+		}
+		parts = append(parts, text[start:i])
+		start = i
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
+
+// isSentenceEnd 句末标点；英文句点只在其后为空白或文末时算作句末（避免切开 3.14、example.com）
+func isSentenceEnd(r, next rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '…', '!', '?', ';':
+		return true
+	case '.':
+		return next == utf8.RuneError || unicode.IsSpace(next)
+	}
+	return false
+}
+
+// isClauseEnd 分句标点；英文逗号、冒号要求其后为空白（避免切开 1,000、12:30）
+func isClauseEnd(r, next rune) bool {
+	switch r {
+	case '，', '、', '：':
+		return true
+	case ',', ':':
+		return next == utf8.RuneError || unicode.IsSpace(next)
+	}
+	return false
+}
+
+// countTokens 优先使用当前模型的分词器计数，不可用时按字符估算
+func countTokens(text string) int {
+	if tc, ok := llm.CurrentEngine.(llm.TokenCounter); ok {
+		if n, err := tc.CountTokens(text); err == nil {
+			return n
+		}
+	}
+	return estimateTokens(text)
+}
+
+// estimateTokens 粗略估算 token 数：CJK 字符约 1 个 token，其他字符约 4 个计 1 个 token
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
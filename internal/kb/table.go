@@ -0,0 +1,264 @@
+package kb
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"knowledge/internal/db"
+)
+
+// maxTableRows 单个工作表物化的最大数据行数，与行级记录编码的上限一致
+const maxTableRows = 200000
+
+var (
+	// 数字：可带千分位逗号与小数；以 0 开头的多位整数（如编号 007）按文本处理
+	tableNumber = regexp.MustCompile(`^[-+]?(\d+|\d{1,3}(,\d{3})+)(\.\d+)?$`)
+	// 日期：2024-03-01、2024/3/1、2024.3.1、2024年3月1日，可带时:分[:秒]
+	tableDate = regexp.MustCompile(`^(\d{4})[-/.年](\d{1,2})[-/.月](\d{1,2})日?(?:[ T](\d{1,2}):(\d{2})(?::(\d{2}))?)?$`)
+)
+
+// materializeTables 把表格文件的工作表写成 SQLite 表并登记表结构，供 text-to-SQL 查询；
+// 非表格文件清理可能遗留的旧表
+func materializeTables(f db.KnowledgeBaseFile, reg *Registration) error {
+	if reg == nil || reg.Tables == nil {
+		return db.DeleteKBTables(f.ID)
+	}
+	local, cleanup, err := LocalFile(f.Path)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var tables []db.TableData
+	err = reg.Tables(local, func(name string, rows iter.Seq2[int, []string]) {
+		if t, ok := buildTable(name, rows); ok {
+			tables = append(tables, t)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return db.ReplaceKBTables(f.ID, tables)
+}
+
+// buildTable 表头按 sheetHeader 确定，其后的非空行为数据；逐列推断类型后转换取值。没有数据行时返回 false
+func buildTable(sheet string, rows iter.Seq2[int, []string]) (db.TableData, bool) {
+	var (
+		found  sheetHeader
+		header []string
+		cells  [][]string
+	)
+	for _, row := range rows {
+		if !found.next(row) {
+			continue
+		}
+		if header == nil {
+			header = tableColumnNames(found.header)
+		}
+		if len(cells) >= maxTableRows {
+			break
+		}
+		if isBlankRow(row) {
+			continue
+		}
+		r := make([]string, len(header))
+		for i := range r {
+			if i < len(row) {
+				r[i] = strings.TrimSpace(row[i])
+			}
+		}
+		cells = append(cells, r)
+	}
+	if len(header) == 0 || len(cells) == 0 {
+		return db.TableData{}, false
+	}
+
+	t := db.TableData{Sheet: sheet, Columns: make([]db.TableColumn, len(header)), Rows: make([][]any, len(cells))}
+	for i, name := range header {
+		values := make([]string, len(cells))
+		for j, r := range cells {
+			values[j] = r[i]
+		}
+		t.Columns[i] = db.TableColumn{Name: name, Type: inferColumnType(values)}
+	}
+	for j, r := range cells {
+		row := make([]any, len(r))
+		for i, v := range r {
+			row[i] = convertCell(v, t.Columns[i].Type)
+		}
+		t.Rows[j] = row
+	}
+	return t, true
+}
+
+// sheetHeader 在工作表开头确定表头行：跳过开头的空行；只有一个非空单元格、
+// 而下一个非空行有多个非空单元格的行视为表格标题（如“2024 年销售明细”），不作为表头
+type sheetHeader struct {
+	candidate []string
+	header    []string
+}
+
+// next 依次送入各行，返回该行是否位于表头之后（表头确定后的空行也返回 true，由调用方跳过）
+func (h *sheetHeader) next(row []string) bool {
+	switch {
+	case h.header != nil:
+		return true
+	case isBlankRow(row):
+		return false
+	case h.candidate == nil:
+		h.candidate = row
+		return false
+	case nonBlankCells(h.candidate) == 1 && nonBlankCells(row) > 1:
+		h.candidate = row
+		return false
+	}
+	h.header = h.candidate
+	return true
+}
+
+func nonBlankCells(row []string) int {
+	n := 0
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func isBlankRow(row []string) bool {
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// tableColumnNames 表头作为列名：空表头为“列N”，重名（SQLite 列名不区分大小写）追加序号
+func tableColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := make(map[string]int)
+	for i, h := range header {
+		name := strings.Join(strings.Fields(h), " ")
+		if name == "" {
+			name = fmt.Sprintf("列%d", i+1)
+		}
+		key := strings.ToLower(name)
+		if n := seen[key]; n > 0 {
+			for {
+				n++
+				candidate := fmt.Sprintf("%s_%d", name, n)
+				if seen[strings.ToLower(candidate)] == 0 {
+					seen[key] = n
+					name, key = candidate, strings.ToLower(candidate)
+					break
+				}
+			}
+		}
+		seen[key]++
+		names[i] = name
+	}
+	return names
+}
+
+// inferColumnType 非空值全部为整数时为 INTEGER，全部为数字时为 REAL，全部为日期时为 DATE，否则为 TEXT
+func inferColumnType(values []string) string {
+	isInt, isReal, isDate, nonEmpty := true, true, true, false
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		nonEmpty = true
+		if _, ok := parseTableInt(v); !ok {
+			isInt = false
+		}
+		if _, ok := parseTableReal(v); !ok {
+			isReal = false
+		}
+		if _, ok := normalizeDate(v); !ok {
+			isDate = false
+		}
+		if !isInt && !isReal && !isDate {
+			return db.ColumnText
+		}
+	}
+	switch {
+	case !nonEmpty:
+		return db.ColumnText
+	case isInt:
+		return db.ColumnInteger
+	case isReal:
+		return db.ColumnReal
+	case isDate:
+		return db.ColumnDate
+	}
+	return db.ColumnText
+}
+
+// convertCell 按列类型转换单元格，空单元格为 NULL
+func convertCell(v, typ string) any {
+	if v == "" {
+		return nil
+	}
+	switch typ {
+	case db.ColumnInteger:
+		n, _ := parseTableInt(v)
+		return n
+	case db.ColumnReal:
+		f, _ := parseTableReal(v)
+		return f
+	case db.ColumnDate:
+		d, _ := normalizeDate(v)
+		return d
+	}
+	return v
+}
+
+func isTableNumber(v string) bool {
+	if !tableNumber.MatchString(v) {
+		return false
+	}
+	digits := strings.TrimLeft(v, "+-")
+	return !(len(digits) > 1 && digits[0] == '0' && digits[1] != '.')
+}
+
+func parseTableInt(v string) (int64, bool) {
+	if !isTableNumber(v) || strings.Contains(v, ".") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(v, ",", ""), 10, 64)
+	return n, err == nil
+}
+
+func parseTableReal(v string) (float64, bool) {
+	if !isTableNumber(v) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+	return f, err == nil
+}
+
+// normalizeDate 把常见日期写法统一为 "2006-01-02" 或 "2006-01-02 15:04:05"，便于在 SQL 中比较
+func normalizeDate(v string) (string, bool) {
+	m := tableDate.FindStringSubmatch(v)
+	if m == nil {
+		return "", false
+	}
+	n := make([]int, 6)
+	for i := range n {
+		n[i], _ = strconv.Atoi(m[i+1])
+	}
+	t := time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, time.UTC)
+	if t.Month() != time.Month(n[1]) || t.Day() != n[2] || n[3] > 23 || n[4] > 59 || n[5] > 59 {
+		return "", false
+	}
+	if m[4] == "" {
+		return t.Format("2006-01-02"), true
+	}
+	return t.Format("2006-01-02 15:04:05"), true
+}
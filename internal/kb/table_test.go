@@ -0,0 +1,94 @@
+package kb
+
+import (
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"knowledge/internal/db"
+)
+
+func TestBuildTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	src := "订单号,日期,金额,数量,备注,金额\n007,2024/3/1,\"1,200.50\",2,,9\n008,2024年3月15日,80,1,加急,10\n\n009,2024-04-02,1000,3,,11\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []db.TableData
+	err := csvSheet(path, func(name string, rows iter.Seq2[int, []string]) {
+		if tbl, ok := buildTable(name, rows); ok {
+			tables = append(tables, tbl)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Sheet != "orders.csv" || len(tables[0].Rows) != 3 {
+		t.Fatalf("unexpected tables: %+v", tables)
+	}
+
+	// 以 0 开头的编号保留为文本，重名列追加序号，空列为 TEXT
+	want := []db.TableColumn{
+		{Name: "订单号", Type: db.ColumnText},
+		{Name: "日期", Type: db.ColumnDate},
+		{Name: "金额", Type: db.ColumnReal},
+		{Name: "数量", Type: db.ColumnInteger},
+		{Name: "备注", Type: db.ColumnText},
+		{Name: "金额_2", Type: db.ColumnInteger},
+	}
+	if !slices.Equal(tables[0].Columns, want) {
+		t.Errorf("columns = %+v, want %+v", tables[0].Columns, want)
+	}
+	row := tables[0].Rows[1]
+	if row[0] != "008" || row[1] != "2024-03-15" || row[2] != 80.0 || row[3] != int64(1) || row[4] != "加急" {
+		t.Errorf("unexpected row: %#v", row)
+	}
+	if tables[0].Rows[0][4] != nil {
+		t.Errorf("empty cell should be NULL, got %#v", tables[0].Rows[0][4])
+	}
+
+	if _, ok := normalizeDate("2024-02-30"); ok {
+		t.Errorf("invalid date accepted")
+	}
+	if d, _ := normalizeDate("2024/3/1 9:05"); d != "2024-03-01 09:05:00" {
+		t.Errorf("normalizeDate = %q", d)
+	}
+}
+
+func TestBuildTableTitleRow(t *testing.T) {
+	rows := [][]string{
+		{"", ""},
+		{"2024 年销售明细", ""},
+		{},
+		{"地区", "金额"},
+		{"华东", "100"},
+		{"华北", "80"},
+	}
+	seq := func(yield func(int, []string) bool) {
+		for i, r := range rows {
+			if !yield(i+1, r) {
+				return
+			}
+		}
+	}
+	// 开头的空行与只有一个单元格的标题行被跳过，表头与记录编码器一致
+	tbl, ok := buildTable("销售", seq)
+	if !ok || len(tbl.Columns) != 2 || tbl.Columns[0].Name != "地区" || len(tbl.Rows) != 2 || tbl.Rows[1][1] != int64(80) {
+		t.Fatalf("unexpected table: %+v", tbl)
+	}
+	enc := &recordEncoder{path: "sales.xlsx", source: "Excel", maxProcessRows: 100, targetChunkChars: 1000}
+	enc.encodeSheet("销售", seq)
+	if len(enc.chunks) != 1 || !strings.Contains(enc.chunks[0].Text, "行: 5；地区: 华东；金额: 100") {
+		t.Errorf("unexpected records: %+v", enc.chunks)
+	}
+
+	// 单列表格的表头不会被当作标题
+	rows = [][]string{{"名称"}, {"甲"}, {"乙"}}
+	if tbl, ok := buildTable("单列", seq); !ok || tbl.Columns[0].Name != "名称" || len(tbl.Rows) != 2 {
+		t.Errorf("unexpected single-column table: %+v", tbl)
+	}
+}
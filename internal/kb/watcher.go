@@ -0,0 +1,416 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"knowledge/internal/db"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// 变更去抖：编辑器保存、批量拷贝等会在短时间内产生大量事件
+	watchDebounce = 2 * time.Second
+	// fsnotify 不可用时（如 inotify 句柄耗尽、网络文件系统）退化为定时轮询
+	watchPollInterval = 10 * time.Second
+)
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderWatcher 监听某个集合目录的变化，去抖后只把受影响的文件交给 processFile
+type folderWatcher struct {
+	kb           *KnowledgeBase
+	collectionID uint
+	folder       string
+
+	// debounce 去抖时长；syncFn 处理一批变更路径（默认为 kb.syncPaths，测试中替换）
+	debounce time.Duration
+	syncFn   func(paths []string, stop <-chan struct{}) error
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	timer   *time.Timer
+	flushes chan struct{} // 去抖计时到期的信号，由 flushLoop 在 wg 内处理
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newFolderWatcher(kb *KnowledgeBase, collectionID uint, folder string) *folderWatcher {
+	w := &folderWatcher{
+		kb:           kb,
+		collectionID: collectionID,
+		folder:       folder,
+		debounce:     watchDebounce,
+		pending:      make(map[string]struct{}),
+		flushes:      make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	w.syncFn = func(paths []string, stop <-chan struct{}) error {
+		return kb.syncPaths(collectionID, folder, paths, stop)
+	}
+	return w
+}
+
+// StartWatching 按当前集合配置（重新）启动所有集合目录的监听
+func (kb *KnowledgeBase) StartWatching() error {
+	kb.watchMu.Lock()
+	defer kb.watchMu.Unlock()
+
+	for _, w := range kb.watchers {
+		w.stop()
+	}
+	kb.watchers = nil
+
+	collections, err := db.ListCollections()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range collections {
+		for _, folder := range c.Folders {
+			info, err := os.Stat(folder)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !info.IsDir() {
+				errs = append(errs, fmt.Errorf("knowledge base folder is not a directory: %s", folder))
+				continue
+			}
+
+			w := newFolderWatcher(kb, c.ID, folder)
+			w.start()
+			kb.watchers = append(kb.watchers, w)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StopWatching 停止目录监听并等待进行中的增量同步退出（已排队但未处理的变更会被丢弃，下次同步时补齐）
+func (kb *KnowledgeBase) StopWatching() {
+	kb.watchMu.Lock()
+	defer kb.watchMu.Unlock()
+	for _, w := range kb.watchers {
+		w.stop()
+	}
+	kb.watchers = nil
+}
+
+func (w *folderWatcher) start() {
+	w.wg.Add(1)
+	go w.flushLoop()
+
+	fsw, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = w.addRecursive(fsw, w.folder)
+		if err != nil {
+			_ = fsw.Close()
+		}
+	}
+	if err != nil {
+		fmt.Printf("[KB] fsnotify unavailable (%v), falling back to polling every %s\n", err, watchPollInterval)
+		w.wg.Add(1)
+		go w.pollLoop()
+		return
+	}
+
+	fmt.Printf("[KB] Watching folder: %s\n", w.folder)
+	w.wg.Add(1)
+	go w.eventLoop(fsw)
+}
+
+func (w *folderWatcher) stop() {
+	close(w.done)
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+// addRecursive fsnotify 不支持递归监听，需要逐个目录添加；扫描时跳过的目录不监听
+func (w *folderWatcher) addRecursive(fsw *fsnotify.Watcher, start string) error {
+	rules, err := loadScanRules(w.folder, nil)
+	if err != nil {
+		return err
+	}
+	rules.dirsOnly = true
+	rules.onDir = fsw.Add
+	return rules.walk(start, nil)
+}
+
+func (w *folderWatcher) eventLoop(fsw *fsnotify.Watcher) {
+	defer w.wg.Done()
+	defer fsw.Close()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			// 仅权限变化不影响内容；依赖/版本控制目录内的变化不关心
+			if ev.Op == fsnotify.Chmod || inIgnoredDir(ev.Name) || isIgnoredDir(filepath.Base(ev.Name)) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := w.addRecursive(fsw, ev.Name); err != nil {
+						fmt.Printf("[KB] Failed to watch %s: %v\n", ev.Name, err)
+					}
+				}
+			}
+			w.enqueue(ev.Name)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("[KB] Watcher error: %v\n", err)
+			// 事件队列溢出时无法得知丢了哪些变更：整目录重新对账
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.enqueue(w.folder)
+			}
+		}
+	}
+}
+
+func (w *folderWatcher) pollLoop() {
+	defer w.wg.Done()
+
+	prev := w.snapshot()
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			cur := w.snapshot()
+			for path, st := range cur {
+				if old, ok := prev[path]; !ok || old != st {
+					w.enqueue(path)
+				}
+			}
+			for path := range prev {
+				if _, ok := cur[path]; !ok {
+					w.enqueue(path)
+				}
+			}
+			prev = cur
+		}
+	}
+}
+
+// snapshot 记录目录下可索引文件（以及 .kbignore）的大小与修改时间，用于轮询比对
+func (w *folderWatcher) snapshot() map[string]fileStamp {
+	m := make(map[string]fileStamp)
+	ignoreFile := filepath.Join(w.folder, kbIgnoreFile)
+	if info, err := os.Stat(ignoreFile); err == nil {
+		m[ignoreFile] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	rules, err := loadScanRules(w.folder, nil)
+	if err != nil {
+		return m
+	}
+	_ = rules.walk(w.folder, func(path string, info os.FileInfo) error {
+		m[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return m
+}
+
+// enqueue 记录变更路径并（重新）开始去抖计时；.kbignore 变化时整个目录重新对账
+func (w *folderWatcher) enqueue(path string) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	if filepath.Base(path) == kbIgnoreFile {
+		path = w.folder
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[path] = struct{}{}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, func() {
+			select {
+			case w.flushes <- struct{}{}:
+			default:
+			}
+		})
+	} else {
+		w.timer.Reset(w.debounce)
+	}
+}
+
+// flushLoop 在监听的生命周期内处理到期的变更，stop 因此能等到进行中的同步退出
+func (w *folderWatcher) flushLoop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.flushes:
+			w.flush()
+		}
+	}
+}
+
+func (w *folderWatcher) flush() {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for p := range w.pending {
+		paths = append(paths, p)
+	}
+	w.pending = make(map[string]struct{})
+	w.timer = nil
+	w.mu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+	// 监听已停止（集合被删除或目录变更）：不再处理
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	// 已暂停或有手动同步在进行：保留变更，稍后再试
+	if w.kb.paused.Load() {
+		w.requeue(paths)
+		return
+	}
+	if err := w.syncFn(paths, w.done); err != nil {
+		if errors.Is(err, errSyncInProgress) {
+			w.requeue(paths)
+			return
+		}
+		if !errors.Is(err, context.Canceled) {
+			fmt.Printf("[KB] Incremental sync failed: %v\n", err)
+		}
+	}
+}
+
+func (w *folderWatcher) requeue(paths []string) {
+	for _, p := range paths {
+		w.enqueue(p)
+	}
+}
+
+// syncPaths 增量同步：只对账并处理集合目录 folder 内给定路径（文件或目录）涉及的文件。
+// stop 关闭时（监听被停止）不再对账，也不再等待已排队的任务（任务已持久化，照常执行）
+func (kb *KnowledgeBase) syncPaths(collectionID uint, folder string, paths []string, stop <-chan struct{}) error {
+	if err := kb.beginSync(); err != nil {
+		return err
+	}
+	defer kb.endSync()
+
+	// 收集仍存在且按扫描规则纳入的文件；已删除或被排除的路径交给对账清理
+	kb.resetSkipped()
+	rules, err := loadScanRules(folder, kb.addSkipped)
+	if err != nil {
+		return err
+	}
+	var files []scannedFile
+	seen := make(map[string]bool)
+	addFile := func(path string, info os.FileInfo) error {
+		if seen[path] {
+			return nil
+		}
+		scanned, err := rules.scan(path, info)
+		if err != nil {
+			return err
+		}
+		seen[path] = true
+		files = append(files, scanned...)
+		return nil
+	}
+	for _, p := range paths {
+		if _, err := os.Lstat(p); err != nil {
+			continue
+		}
+		if err := rules.walk(p, addFile); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-stop:
+		return context.Canceled
+	default:
+	}
+
+	// 对账范围：路径本身、位于变更目录之下或变更压缩包之内的已有记录
+	all, err := db.ListKBFilesInCollection(collectionID)
+	if err != nil {
+		return err
+	}
+	var scope []db.KnowledgeBaseFile
+	for _, f := range all {
+		for _, p := range paths {
+			if withinPath(f.Path, p) {
+				scope = append(scope, f)
+				break
+			}
+		}
+	}
+
+	stats, err := reconcileFiles(collectionID, files, excludeKept(scope, rules.kept), nil)
+	if err != nil {
+		return err
+	}
+	kb.setSyncStats(stats)
+
+	var toProcess []db.KnowledgeBaseFile
+	for _, file := range files {
+		rec, err := db.GetKBFileByPath(file.path)
+		if err != nil {
+			return err
+		}
+		if rec.Status == "pending" {
+			toProcess = append(toProcess, *rec)
+		}
+	}
+	if len(toProcess) == 0 {
+		return nil
+	}
+
+	totalFiles := len(toProcess)
+	if err := kb.enqueueFiles(toProcess, true); err != nil {
+		return err
+	}
+	// 被停止：保持 pending，下次同步继续；单个文件的失败已记录在任务中
+	if err := kb.waitForFiles(toProcess, kb.processingProgress(totalFiles), stop); errors.Is(err, context.Canceled) {
+		return err
+	} else if err != nil {
+		fmt.Printf("Error processing files: %v\n", err)
+	}
+
+	kb.UpdateSyncProgress(SyncProgress{
+		TotalFiles:     totalFiles,
+		ProcessedFiles: totalFiles,
+		CurrentFile:    "",
+		Status:         "completed",
+		Progress:       100,
+	})
+	return nil
+}
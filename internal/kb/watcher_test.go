@@ -0,0 +1,129 @@
+package kb
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSync 记录 folderWatcher 每次交给同步的路径，err 依次作为各次调用的返回值
+type recordingSync struct {
+	mu    sync.Mutex
+	calls [][]string
+	errs  []error
+}
+
+func (r *recordingSync) sync(paths []string, stop <-chan struct{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slices.Sort(paths)
+	r.calls = append(r.calls, paths)
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (r *recordingSync) snapshot() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+func newTestWatcher(kb *KnowledgeBase, rec *recordingSync) *folderWatcher {
+	w := newFolderWatcher(kb, 1, "/kb")
+	w.debounce = 50 * time.Millisecond
+	w.syncFn = rec.sync
+	w.wg.Add(1)
+	go w.flushLoop()
+	return w
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for watcher")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	rec := &recordingSync{}
+	w := newTestWatcher(NewKnowledgeBase(), rec)
+	defer w.stop()
+
+	// 去抖时间内的多次变更合并为一次同步，重复路径只出现一次
+	w.enqueue("/kb/a.txt")
+	w.enqueue("/kb/b.txt")
+	w.enqueue("/kb/a.txt")
+	waitFor(t, func() bool { return len(rec.snapshot()) > 0 })
+	time.Sleep(3 * w.debounce)
+
+	calls := rec.snapshot()
+	if len(calls) != 1 || !slices.Equal(calls[0], []string{"/kb/a.txt", "/kb/b.txt"}) {
+		t.Errorf("expected one debounced sync of both files, got %v", calls)
+	}
+
+	// .kbignore 变化时整个目录重新对账
+	w.enqueue("/kb/" + kbIgnoreFile)
+	waitFor(t, func() bool { return len(rec.snapshot()) == 2 })
+	if calls := rec.snapshot(); !slices.Equal(calls[1], []string{"/kb"}) {
+		t.Errorf("expected folder resync after %s change, got %v", kbIgnoreFile, calls[1])
+	}
+}
+
+func TestWatcherPauseRequeue(t *testing.T) {
+	kb := NewKnowledgeBase()
+	rec := &recordingSync{errs: []error{errSyncInProgress}}
+	w := newTestWatcher(kb, rec)
+	defer w.stop()
+
+	// 暂停期间变更保留在队列中，不交给同步
+	kb.PauseSync()
+	w.enqueue("/kb/a.txt")
+	time.Sleep(5 * w.debounce)
+	if calls := rec.snapshot(); len(calls) != 0 {
+		t.Fatalf("expected no sync while paused, got %v", calls)
+	}
+
+	// 恢复后处理；第一次遇到正在进行的同步时重新排队再试
+	kb.ResumeSync()
+	waitFor(t, func() bool { return len(rec.snapshot()) == 2 })
+	for _, call := range rec.snapshot() {
+		if !slices.Equal(call, []string{"/kb/a.txt"}) {
+			t.Errorf("expected requeued path, got %v", call)
+		}
+	}
+}
+
+func TestWatcherStop(t *testing.T) {
+	rec := &recordingSync{}
+	started := make(chan struct{})
+	w := newTestWatcher(NewKnowledgeBase(), rec)
+	w.syncFn = func(paths []string, stop <-chan struct{}) error {
+		close(started)
+		<-stop
+		return rec.sync(paths, stop)
+	}
+
+	// stop 等待进行中的同步退出
+	w.enqueue("/kb/a.txt")
+	<-started
+	w.stop()
+	if calls := rec.snapshot(); len(calls) != 1 {
+		t.Fatalf("expected in-flight sync to finish before stop returns, got %v", calls)
+	}
+
+	// 停止后的变更不再处理
+	w.enqueue("/kb/b.txt")
+	time.Sleep(3 * w.debounce)
+	if calls := rec.snapshot(); len(calls) != 1 {
+		t.Errorf("expected no sync after stop, got %v", calls)
+	}
+}
@@ -0,0 +1,67 @@
+package kb
+
+import (
+	"fmt"
+	"iter"
+	"path/filepath"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// zipMagic OOXML（xlsx 等）本质是 zip 包
+var zipMagic = []byte{'P', 'K', 0x03, 0x04}
+
+// Workbook 表格文件的统一读取接口：xlsx 走 excelize，旧版 .xls（BIFF8）走内置解析器，
+// 索引与 Excel 预览共用
+type Workbook interface {
+	SheetNames() []string
+	// Rows 按顺序返回工作表中的行，行号与表格软件中一致（从 1 开始）；读取失败的行被跳过
+	Rows(sheet string) iter.Seq2[int, []string]
+	Close() error
+}
+
+// OpenWorkbook 按文件内容（而非扩展名）选择解析方式，兼容被改名的 xls/xlsx
+func OpenWorkbook(path string) (Workbook, error) {
+	switch {
+	case hasFileMagic(path, zipMagic):
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &excelizeWorkbook{f: f}, nil
+	case hasFileMagic(path, cfbMagic):
+		return openXLSWorkbook(path)
+	default:
+		return nil, fmt.Errorf("unsupported spreadsheet format: %s", filepath.Base(path))
+	}
+}
+
+type excelizeWorkbook struct {
+	f *excelize.File
+}
+
+func (w *excelizeWorkbook) SheetNames() []string { return w.f.GetSheetList() }
+
+func (w *excelizeWorkbook) Rows(sheet string) iter.Seq2[int, []string] {
+	return func(yield func(int, []string) bool) {
+		rows, err := w.f.Rows(sheet)
+		if err != nil {
+			return
+		}
+		defer func() { _ = rows.Close() }()
+
+		rowNum := 0
+		for rows.Next() {
+			rowNum++
+			cells, err := rows.Columns()
+			if err != nil {
+				continue
+			}
+			if !yield(rowNum, cells) {
+				return
+			}
+		}
+	}
+}
+
+func (w *excelizeWorkbook) Close() error { return w.f.Close() }
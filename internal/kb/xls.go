@@ -0,0 +1,485 @@
+package kb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// BIFF8 记录类型（[MS-XLS] 2.3）
+const (
+	biffFormula    = 0x0006
+	biffEOF        = 0x000A
+	biffDateMode   = 0x0022
+	biffFilePass   = 0x002F
+	biffContinue   = 0x003C
+	biffBoundSheet = 0x0085
+	biffMulRK      = 0x00BD
+	biffXF         = 0x00E0
+	biffSST        = 0x00FC
+	biffLabelSST   = 0x00FD
+	biffRString    = 0x00D6
+	biffNumber     = 0x0203
+	biffLabel      = 0x0204
+	biffBoolErr    = 0x0205
+	biffString     = 0x0207
+	biffRK         = 0x027E
+	biffFormat     = 0x041E
+	biffBOF        = 0x0809
+)
+
+// xlsSheet 解析后的工作表，单元格按 行 -> 列 存放（均从 0 开始）
+type xlsSheet struct {
+	name  string
+	cells map[int]map[int]string
+}
+
+// xlsWorkbook 旧版 Excel 97-2003（BIFF8）工作簿，整体读入内存
+type xlsWorkbook struct {
+	sheets []*xlsSheet
+}
+
+func (w *xlsWorkbook) SheetNames() []string {
+	names := make([]string, len(w.sheets))
+	for i, s := range w.sheets {
+		names[i] = s.name
+	}
+	return names
+}
+
+func (w *xlsWorkbook) Rows(sheet string) iter.Seq2[int, []string] {
+	return func(yield func(int, []string) bool) {
+		for _, s := range w.sheets {
+			if s.name != sheet {
+				continue
+			}
+			rows := make([]int, 0, len(s.cells))
+			for r := range s.cells {
+				rows = append(rows, r)
+			}
+			sort.Ints(rows)
+			for _, r := range rows {
+				row := s.cells[r]
+				width := 0
+				for c := range row {
+					width = max(width, c+1)
+				}
+				cells := make([]string, width)
+				for c, v := range row {
+					cells[c] = v
+				}
+				if !yield(r+1, cells) {
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+func (w *xlsWorkbook) Close() error { return nil }
+
+func openXLSWorkbook(path string) (*xlsWorkbook, error) {
+	streams, err := readCFBStreams(path, "Workbook", "Book")
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := streams["Workbook"]
+	if !ok {
+		if _, ok := streams["Book"]; ok {
+			return nil, fmt.Errorf("excel 5.0/95 workbooks are not supported; save as .xlsx and sync again")
+		}
+		return nil, fmt.Errorf("not an excel workbook (no Workbook stream)")
+	}
+	return parseBIFF8(stream)
+}
+
+type biffRecord struct {
+	offset int
+	typ    uint16
+	data   []byte
+}
+
+// parseBIFF8 顺序解析 Workbook 流：全局子流中读取工作表、共享字符串与数字格式，
+// 再按 BOUNDSHEET 记录的偏移把各工作表子流中的单元格归到对应工作表
+func parseBIFF8(stream []byte) (*xlsWorkbook, error) {
+	var records []biffRecord
+	for pos := 0; pos+4 <= len(stream); {
+		typ := binary.LittleEndian.Uint16(stream[pos:])
+		size := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+		end := min(pos+4+size, len(stream))
+		records = append(records, biffRecord{offset: pos, typ: typ, data: stream[pos+4 : end]})
+		pos = end
+	}
+
+	var (
+		wb        = &xlsWorkbook{}
+		byOffset  = make(map[int]*xlsSheet)
+		sst       []string
+		formats   = make(map[int]string)
+		xfFormats []int
+		date1904  bool
+		cur       *xlsSheet
+		// 公式结果为字符串时，值在紧随其后的 STRING 记录中
+		pendingRow, pendingCol = -1, -1
+	)
+
+	// isDate 单元格 XF 引用的数字格式是否为日期
+	isDate := func(xf int) bool {
+		if xf >= len(xfFormats) {
+			return false
+		}
+		return isDateFormat(xfFormats[xf], formats[xfFormats[xf]])
+	}
+
+	for i, rec := range records {
+		d := rec.data
+		switch rec.typ {
+		case biffBOF:
+			cur = byOffset[rec.offset]
+		case biffEOF:
+			cur = nil
+		case biffFilePass:
+			return nil, fmt.Errorf("xls: %w", errPasswordProtected)
+		case biffDateMode:
+			date1904 = len(d) >= 2 && binary.LittleEndian.Uint16(d) == 1
+		case biffBoundSheet:
+			// lbPlyPos(4) hsState(1) dt(1) stName；只处理普通工作表（dt=0）
+			if len(d) < 8 || d[5] != 0 {
+				continue
+			}
+			name, _ := biffShortString(d[6:])
+			s := &xlsSheet{name: name, cells: make(map[int]map[int]string)}
+			wb.sheets = append(wb.sheets, s)
+			byOffset[int(binary.LittleEndian.Uint32(d))] = s
+		case biffFormat:
+			if len(d) >= 2 {
+				if f, err := biffString16(d[2:]); err == nil {
+					formats[int(binary.LittleEndian.Uint16(d))] = f
+				}
+			}
+		case biffXF:
+			if len(d) >= 4 {
+				xfFormats = append(xfFormats, int(binary.LittleEndian.Uint16(d[2:])))
+			}
+		case biffSST:
+			segs := [][]byte{d}
+			for j := i + 1; j < len(records) && records[j].typ == biffContinue; j++ {
+				segs = append(segs, records[j].data)
+			}
+			var err error
+			if sst, err = parseSST(segs); err != nil {
+				return nil, fmt.Errorf("xls shared strings: %w", err)
+			}
+		case biffString:
+			// STRING 记录没有行列信息，属于紧邻其前的字符串结果公式
+			if cur != nil && pendingRow >= 0 {
+				if s, err := biffString16(d); err == nil {
+					cur.set(pendingRow, pendingCol, s)
+				}
+			}
+			pendingRow = -1
+			continue
+		}
+
+		if cur == nil || len(d) < 6 {
+			continue
+		}
+		row, col := int(binary.LittleEndian.Uint16(d)), int(binary.LittleEndian.Uint16(d[2:]))
+		xf := int(binary.LittleEndian.Uint16(d[4:]))
+
+		switch rec.typ {
+		case biffLabelSST:
+			if len(d) >= 10 {
+				if idx := int(binary.LittleEndian.Uint32(d[6:])); idx < len(sst) {
+					cur.set(row, col, sst[idx])
+				}
+			}
+		case biffLabel, biffRString:
+			if s, err := biffString16(d[6:]); err == nil {
+				cur.set(row, col, s)
+			}
+		case biffNumber:
+			if len(d) >= 14 {
+				v := math.Float64frombits(binary.LittleEndian.Uint64(d[6:]))
+				cur.set(row, col, formatXLSNumber(v, isDate(xf), date1904))
+			}
+		case biffRK:
+			if len(d) >= 10 {
+				cur.set(row, col, formatXLSNumber(decodeRK(binary.LittleEndian.Uint32(d[6:])), isDate(xf), date1904))
+			}
+		case biffMulRK:
+			// rw(2) colFirst(2) [ixfe(2) RK(4)]... colLast(2)
+			for p, c := 4, col; p+6 <= len(d)-2; p, c = p+6, c+1 {
+				cxf := int(binary.LittleEndian.Uint16(d[p:]))
+				cur.set(row, c, formatXLSNumber(decodeRK(binary.LittleEndian.Uint32(d[p+2:])), isDate(cxf), date1904))
+			}
+		case biffBoolErr:
+			if len(d) >= 8 {
+				cur.set(row, col, formatXLSBoolErr(d[6], d[7] != 0))
+			}
+		case biffFormula:
+			if len(d) < 14 {
+				continue
+			}
+			res := d[6:14]
+			pendingRow = -1
+			if res[6] == 0xFF && res[7] == 0xFF {
+				switch res[0] {
+				case 0: // 字符串结果
+					pendingRow, pendingCol = row, col
+				case 1:
+					cur.set(row, col, formatXLSBoolErr(res[2], false))
+				case 2:
+					cur.set(row, col, formatXLSBoolErr(res[2], true))
+				}
+				continue
+			}
+			v := math.Float64frombits(binary.LittleEndian.Uint64(res))
+			cur.set(row, col, formatXLSNumber(v, isDate(xf), date1904))
+		}
+	}
+
+	return wb, nil
+}
+
+func (s *xlsSheet) set(row, col int, v string) {
+	if v == "" {
+		return
+	}
+	r, ok := s.cells[row]
+	if !ok {
+		r = make(map[int]string)
+		s.cells[row] = r
+	}
+	r[col] = v
+}
+
+// decodeRK 解码 RK 压缩数值：bit0 表示除以 100，bit1 表示 30 位整数
+func decodeRK(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+var xlsErrorCodes = map[byte]string{
+	0x00: "#NULL!", 0x07: "#DIV/0!", 0x0F: "#VALUE!", 0x17: "#REF!",
+	0x1D: "#NAME?", 0x24: "#NUM!", 0x2A: "#N/A",
+}
+
+func formatXLSBoolErr(v byte, isErr bool) string {
+	if isErr {
+		return xlsErrorCodes[v]
+	}
+	if v != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// formatXLSNumber 数字按最短形式输出；日期格式的单元格转换为日期文本
+func formatXLSNumber(v float64, isDate, date1904 bool) string {
+	if isDate && v >= 0 {
+		base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		if date1904 {
+			base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		t := base.Add(time.Duration(math.Round(v*86400)) * time.Second)
+		switch {
+		case v < 1:
+			return t.Format("15:04:05")
+		case t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0:
+			return t.Format("2006-01-02")
+		default:
+			return t.Format("2006-01-02 15:04:05")
+		}
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// isDateFormat 判断数字格式是否为日期/时间：内置格式 14-22、45-47，或自定义格式中含日期占位符
+func isDateFormat(id int, format string) bool {
+	if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) {
+		return true
+	}
+	if format == "" {
+		return false
+	}
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(format) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("ymdhs", r):
+			return true
+		}
+	}
+	return false
+}
+
+// biffShortString ShortXLUnicodeString：cch(1) fHighByte(1) 字符
+func biffShortString(b []byte) (string, error) {
+	if len(b) < 2 {
+		return "", errors.New("short string truncated")
+	}
+	return biffChars(b[2:], int(b[0]), b[1]&0x01 != 0)
+}
+
+// biffString16 XLUnicodeString：cch(2) fHighByte(1) 字符
+func biffString16(b []byte) (string, error) {
+	if len(b) < 3 {
+		return "", errors.New("string truncated")
+	}
+	return biffChars(b[3:], int(binary.LittleEndian.Uint16(b)), b[2]&0x01 != 0)
+}
+
+func biffChars(b []byte, n int, high bool) (string, error) {
+	if !high {
+		if len(b) < n {
+			return "", errors.New("string truncated")
+		}
+		// 压缩存储：每字节即 UTF-16 低位（Latin-1）
+		r := make([]rune, n)
+		for i := 0; i < n; i++ {
+			r[i] = rune(b[i])
+		}
+		return string(r), nil
+	}
+	if len(b) < n*2 {
+		return "", errors.New("string truncated")
+	}
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// sstReader 跨 CONTINUE 记录读取 SST：字符被拆分到下一条记录时，该记录首字节为新的 fHighByte
+type sstReader struct {
+	segs [][]byte
+	seg  int
+	pos  int
+}
+
+func (r *sstReader) ensure() error {
+	for r.seg < len(r.segs) && r.pos >= len(r.segs[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	if r.seg >= len(r.segs) {
+		return errors.New("unexpected end of shared strings")
+	}
+	return nil
+}
+
+func (r *sstReader) bytes(n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if err := r.ensure(); err != nil {
+			return nil, err
+		}
+		take := min(n-len(out), len(r.segs[r.seg])-r.pos)
+		out = append(out, r.segs[r.seg][r.pos:r.pos+take]...)
+		r.pos += take
+	}
+	return out, nil
+}
+
+func (r *sstReader) skip(n int) error {
+	_, err := r.bytes(n)
+	return err
+}
+
+func (r *sstReader) chars(n int, high bool) (string, error) {
+	u := make([]uint16, 0, n)
+	for len(u) < n {
+		if r.seg < len(r.segs) && r.pos >= len(r.segs[r.seg]) {
+			// 字符跨记录：下一条 CONTINUE 的首字节重新给出压缩标志
+			r.seg++
+			r.pos = 0
+			if r.seg >= len(r.segs) || len(r.segs[r.seg]) == 0 {
+				return "", errors.New("unexpected end of shared strings")
+			}
+			high = r.segs[r.seg][0]&0x01 != 0
+			r.pos = 1
+		}
+		if err := r.ensure(); err != nil {
+			return "", err
+		}
+		seg := r.segs[r.seg]
+		if high {
+			if r.pos+2 > len(seg) {
+				return "", errors.New("shared string truncated")
+			}
+			u = append(u, binary.LittleEndian.Uint16(seg[r.pos:]))
+			r.pos += 2
+		} else {
+			u = append(u, uint16(seg[r.pos]))
+			r.pos++
+		}
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// parseSST 解析共享字符串表（XLUnicodeRichExtendedString 数组），忽略富文本与扩展信息
+func parseSST(segs [][]byte) ([]string, error) {
+	r := &sstReader{segs: segs}
+	head, err := r.bytes(8)
+	if err != nil {
+		return nil, err
+	}
+	unique := int(binary.LittleEndian.Uint32(head[4:]))
+	out := make([]string, 0, min(unique, 1<<20))
+	for i := 0; i < unique; i++ {
+		h, err := r.bytes(3)
+		if err != nil {
+			return out, nil // 截断的 SST 尽量保留已读部分
+		}
+		cch, flags := int(binary.LittleEndian.Uint16(h)), h[2]
+		runs, ext := 0, 0
+		if flags&0x08 != 0 {
+			b, err := r.bytes(2)
+			if err != nil {
+				return out, nil
+			}
+			runs = int(binary.LittleEndian.Uint16(b))
+		}
+		if flags&0x04 != 0 {
+			b, err := r.bytes(4)
+			if err != nil {
+				return out, nil
+			}
+			ext = int(binary.LittleEndian.Uint32(b))
+		}
+		s, err := r.chars(cch, flags&0x01 != 0)
+		if err != nil {
+			return out, nil
+		}
+		out = append(out, s)
+		if err := r.skip(runs*4 + ext); err != nil && i < unique-1 {
+			return out, nil
+		}
+	}
+	return out, nil
+}
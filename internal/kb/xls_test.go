@@ -0,0 +1,158 @@
+package kb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// biffBuilder 按 [MS-XLS] 的记录格式拼装 Workbook 流
+type biffBuilder struct{ b []byte }
+
+func (w *biffBuilder) record(typ uint16, parts ...[]byte) int {
+	data := slices.Concat(parts...)
+	at := len(w.b)
+	w.b = binary.LittleEndian.AppendUint16(w.b, typ)
+	w.b = binary.LittleEndian.AppendUint16(w.b, uint16(len(data)))
+	w.b = append(w.b, data...)
+	return at
+}
+
+func u16(v ...int) []byte {
+	var b []byte
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint16(b, uint16(x))
+	}
+	return b
+}
+
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+// utf16le 字符串的 UTF-16LE 字节（fHighByte=1 时的存储形式）
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+// biffCell 单元格记录的公共头：行、列、XF
+func biffCell(row, col, xf int) []byte { return u16(row, col, xf) }
+
+// buildTestWorkbook 一个工作表 "成绩"（另有一个被忽略的图表页），覆盖 SST 跨 CONTINUE、
+// 各类数值记录、日期格式与字符串结果的公式
+func buildTestWorkbook(filePass bool) []byte {
+	w := &biffBuilder{}
+	bof := u16(0x0600, 0x0005, 0, 0, 0, 0, 0, 0)
+	w.record(biffBOF, bof)
+	if filePass {
+		w.record(biffFilePass, u16(1))
+	}
+	w.record(biffFormat, u16(164), u16(10), []byte{0}, []byte("yyyy/mm/dd"))
+	w.record(biffXF, u16(0, 0))   // XF0：常规
+	w.record(biffXF, u16(0, 164)) // XF1：自定义日期格式
+	w.record(biffXF, u16(0, 14))  // XF2：内置日期格式
+	sheetAt := w.record(biffBoundSheet, u32(0), []byte{0, 0, 2, 1}, utf16le("成绩"))
+	w.record(biffBoundSheet, u32(0), []byte{0, 2, 5, 0}, []byte("Chart"))
+
+	// SST：3 个字符串；"Alice Smith" 在 "Alice" 之后被拆到 CONTINUE，续接部分改为双字节存储；
+	// 第三个字符串带 1 个富文本格式段
+	w.record(biffSST, u32(3), u32(3),
+		u16(2), []byte{1}, utf16le("姓名"),
+		u16(11), []byte{0}, []byte("Alice"))
+	w.record(biffContinue, []byte{1}, utf16le(" Smith"),
+		u16(2), []byte{0x09}, u16(1), utf16le("分数"), u16(0, 0))
+	w.record(biffEOF)
+
+	binary.LittleEndian.PutUint32(w.b[sheetAt+4:], uint32(len(w.b)))
+	w.record(biffBOF, u16(0x0600, 0x0010, 0, 0, 0, 0, 0, 0))
+	w.record(biffLabelSST, biffCell(0, 0, 0), u32(0))
+	w.record(biffLabelSST, biffCell(0, 1, 0), u32(2))
+	w.record(biffLabelSST, biffCell(1, 0, 0), u32(1))
+	w.record(biffRK, biffCell(1, 1, 0), u32(90<<2|0x02))
+	w.record(biffNumber, biffCell(2, 1, 1), binary.LittleEndian.AppendUint64(nil, math.Float64bits(45292)))
+	w.record(biffMulRK, u16(3, 0), u16(0), u32(1<<2|0x02), u16(2), u32(45293<<2|0x02), u16(1))
+	w.record(biffFormula, biffCell(4, 0, 0), []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}, u16(0), u32(0))
+	w.record(biffString, u16(2), []byte{1}, utf16le("合计"))
+	w.record(biffBoolErr, biffCell(4, 1, 0), []byte{1, 0})
+	w.record(biffBoolErr, biffCell(4, 2, 0), []byte{0x07, 1})
+	w.record(biffEOF)
+	return w.b
+}
+
+func TestXLSNumberDecoding(t *testing.T) {
+	// RK：整数 123（bit1），以及 1.23（整数 123 且 bit0 除以 100）
+	if got := decodeRK(123<<2 | 0x02); got != 123 {
+		t.Errorf("expected 123, got %v", got)
+	}
+	if got := decodeRK(123<<2 | 0x03); got != 1.23 {
+		t.Errorf("expected 1.23, got %v", got)
+	}
+
+	// 内置日期格式 14 与自定义格式
+	if got := formatXLSNumber(45292, isDateFormat(14, ""), false); got != "2024-01-01" {
+		t.Errorf("expected 2024-01-01, got %s", got)
+	}
+	if !isDateFormat(200, "yyyy/mm/dd hh:mm") || isDateFormat(200, `0.00"d"`) {
+		t.Errorf("unexpected custom date format detection")
+	}
+}
+
+func TestParseBIFF8(t *testing.T) {
+	wb, err := parseBIFF8(buildTestWorkbook(false))
+	if err != nil {
+		t.Fatalf("parseBIFF8 failed: %v", err)
+	}
+	if names := wb.SheetNames(); !slices.Equal(names, []string{"成绩"}) {
+		t.Fatalf("expected only the worksheet, got %v", names)
+	}
+	var got []string
+	for row, cells := range wb.Rows("成绩") {
+		got = append(got, strings.Join(append([]string{strconv.Itoa(row)}, cells...), ","))
+	}
+	want := []string{
+		"1,姓名,分数",
+		"2,Alice Smith,90",
+		"3,,2024-01-01",
+		"4,1,2024-01-02",
+		"5,合计,TRUE,#DIV/0!",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected rows:\n got %q\nwant %q", got, want)
+	}
+
+	if _, err := parseBIFF8(buildTestWorkbook(true)); !errors.Is(err, errPasswordProtected) {
+		t.Errorf("expected errPasswordProtected for FILEPASS, got %v", err)
+	}
+}
+
+func TestOpenXLSWorkbook(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "scores.xls")
+	writeCFB(t, p, map[string][]byte{"Workbook": buildTestWorkbook(false)})
+	wb, err := OpenWorkbook(p)
+	if err != nil {
+		t.Fatalf("OpenWorkbook failed: %v", err)
+	}
+	defer wb.Close()
+	rows := 0
+	for range wb.Rows("成绩") {
+		rows++
+	}
+	if rows != 5 {
+		t.Errorf("expected 5 rows, got %d", rows)
+	}
+
+	old := filepath.Join(dir, "excel95.xls")
+	writeCFB(t, old, map[string][]byte{"Book": {0}})
+	if _, err := OpenWorkbook(old); err == nil || !strings.Contains(err.Error(), "5.0/95") {
+		t.Errorf("expected unsupported Excel 95 error, got %v", err)
+	}
+}
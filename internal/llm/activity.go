@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 正在进行的交互请求（对话、检索）数与最近一次开始/结束的时间，后台任务据此让出引擎
+var (
+	interactiveActive atomic.Int64
+	interactiveLast   atomic.Int64 // UnixNano
+)
+
+// BeginInteractive 标记一个交互请求开始，返回的函数在请求结束时调用（可重复调用）
+func BeginInteractive() func() {
+	interactiveActive.Add(1)
+	interactiveLast.Store(time.Now().UnixNano())
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			interactiveLast.Store(time.Now().UnixNano())
+			interactiveActive.Add(-1)
+		})
+	}
+}
+
+// InteractiveIdle 没有进行中的交互请求，且最近一次交互已过去至少 d
+func InteractiveIdle(d time.Duration) bool {
+	if interactiveActive.Load() > 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, interactiveLast.Load())) >= d
+}
@@ -0,0 +1,26 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInteractiveIdle(t *testing.T) {
+	end := BeginInteractive()
+	if InteractiveIdle(0) {
+		t.Errorf("expected busy while an interactive request is active")
+	}
+	end()
+	end() // 重复调用不应让计数变为负数
+	if !InteractiveIdle(0) {
+		t.Errorf("expected idle after the request ended")
+	}
+	if InteractiveIdle(time.Hour) {
+		t.Errorf("expected busy within the idle delay")
+	}
+	other := BeginInteractive()
+	defer other()
+	if InteractiveIdle(0) {
+		t.Errorf("expected busy after the first request's end was called twice")
+	}
+}
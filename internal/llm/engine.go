@@ -29,5 +29,10 @@ type EngineWithOptions interface {
 	ChatStreamWithOptions(history []ChatMessage, opts ChatOptions, onToken func(token string) bool) error
 }
 
+// TokenCounter 可选能力：按模型分词器统计 token 数（知识库分片按 token 计长度）
+type TokenCounter interface {
+	CountTokens(text string) (int, error)
+}
+
 // Global instance
 var CurrentEngine Engine
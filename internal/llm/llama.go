@@ -17,6 +17,8 @@ type LlamaEngine struct {
 	modelPath string
 	model     *binding.Llama
 	mu        sync.Mutex
+	// modelMu 只保护模型的加载与释放；分词只读词表，持读锁即可，不必等待 mu 上正在进行的生成
+	modelMu sync.RWMutex
 }
 
 type oaMsg struct {
@@ -180,8 +182,11 @@ func (l *LlamaEngine) ChatStreamWithOptions(history []ChatMessage, opts ChatOpti
 }
 
 func (l *LlamaEngine) Close() {
+	l.modelMu.Lock()
+	defer l.modelMu.Unlock()
 	if l.model != nil {
 		l.model.Close()
+		l.model = nil
 	}
 }
 
@@ -195,6 +200,9 @@ func (l *LlamaEngine) SwitchModel(modelPath string) error {
 		return fmt.Errorf("model not found at %s", modelPath)
 	}
 
+	l.modelMu.Lock()
+	defer l.modelMu.Unlock()
+
 	// 关闭当前模型
 	if l.model != nil {
 		l.model.Close()
@@ -254,6 +262,19 @@ func (l *LlamaEngine) GetEmbedding(text string) ([]float32, error) {
 	return l.model.GetEmbedding(text)
 }
 
+// CountTokens 使用当前模型的分词器统计 token 数。
+// 不获取 mu：入库切分时会大量调用，不能与对话生成互相排队
+func (l *LlamaEngine) CountTokens(text string) (int, error) {
+	l.modelMu.RLock()
+	defer l.modelMu.RUnlock()
+
+	if l.model == nil {
+		return 0, fmt.Errorf("model not initialized")
+	}
+
+	return l.model.CountTokens(text)
+}
+
 func NewEngine() Engine {
 	return &LlamaEngine{}
 }
@@ -18,8 +18,35 @@ import (
 
 type ChatRequest struct {
 	Message string `json:"message" binding:"required"`
+	// CollectionIDs 本次检索的知识库集合；不传时使用对话上保存的设置（均为空表示全部集合）
+	CollectionIDs []uint `json:"collection_ids"`
+	// Mode 为 "sql" 时对检索范围内的表格数据生成 SQL 查询后回答（统计、筛选类问题）
+	Mode string `json:"mode"`
+	// From/After/Before 按发件人、发送时间过滤检索到的邮件分片，格式同 /api/kb/debug/search 的同名参数
+	From   string `json:"from"`
+	After  string `json:"after"`
+	Before string `json:"before"`
 }
 
+// kbFilter 组合本次请求的检索范围（见 kbScope）与邮件过滤条件
+func (r ChatRequest) kbFilter(conversationID uint) (db.ChunkFilter, error) {
+	filter := db.ChunkFilter{
+		CollectionIDs: kbScope(conversationID, r.CollectionIDs),
+		Sender:        strings.TrimSpace(r.From),
+	}
+	var err error
+	if filter.After, err = parseFilterTime("after", r.After); err != nil {
+		return filter, err
+	}
+	if filter.Before, err = parseFilterTime("before", r.Before); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// ChatModeSQL text-to-SQL 问答模式
+const ChatModeSQL = "sql"
+
 type ChatResponse struct {
 	Response string `json:"response"`
 }
@@ -34,6 +61,18 @@ type OAIChatCompletionRequest struct {
 	Stop        json.RawMessage   `json:"stop"`
 }
 
+// kbScope 确定本次检索的知识库集合：请求显式指定优先，其次使用对话上保存的设置
+func kbScope(conversationID uint, requested []uint) []uint {
+	if len(requested) > 0 {
+		return requested
+	}
+	c, err := db.GetConversation(conversationID)
+	if err != nil || c == nil {
+		return nil
+	}
+	return c.CollectionIDs
+}
+
 func (s *Server) ListModels(c *gin.Context) {
 	// 获取可用模型列表
 	var models []string
@@ -159,6 +198,11 @@ func (s *Server) ChatStream(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	filter, err := req.kbFilter(defaultConv.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := db.SaveMessage(defaultConv.ID, "user", req.Message); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -172,12 +216,7 @@ func (s *Server) ChatStream(c *gin.Context) {
 	}
 
 	var response string
-	history := BuildHistoryWithKB(s.kbase, dbMessages, 10, req.Message)
-	response, err = StreamPlainTokens(c, func(yield func(string) bool) error {
-		return s.withEngineLocked(func() error {
-			return s.engine.ChatStream(history, yield)
-		})
-	}, StreamOptions{})
+	response, err = StreamPlainTokens(c, s.chatTokens(req, dbMessages, filter), StreamOptions{})
 
 	if err != nil {
 		return
@@ -199,6 +238,11 @@ func (s *Server) ChatWithConversation(c *gin.Context) {
 	}
 
 	convID := uint(id)
+	filter, err := req.kbFilter(convID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := db.SaveMessage(convID, "user", req.Message); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -222,12 +266,16 @@ func (s *Server) ChatWithConversation(c *gin.Context) {
 	}
 
 	var response string
-	err = s.withEngineLocked(func() error {
-		history = augmentHistoryWithKB(s.kbase, history, req.Message)
-		var e error
-		response, e = s.engine.Chat(history)
-		return e
-	})
+	if req.Mode == ChatModeSQL {
+		response, err = collectTokens(s.sqlTokens(history, req.Message, filter))
+	} else {
+		err = s.withEngineLocked(func() error {
+			history = augmentHistoryWithKB(s.kbase, history, req.Message, filter)
+			var e error
+			response, e = s.engine.Chat(history)
+			return e
+		})
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -258,6 +306,11 @@ func (s *Server) ChatStreamWithConversation(c *gin.Context) {
 	}
 
 	convID := uint(id)
+	filter, err := req.kbFilter(convID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := db.SaveMessage(convID, "user", req.Message); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -271,12 +324,7 @@ func (s *Server) ChatStreamWithConversation(c *gin.Context) {
 	}
 
 	var response string
-	history := BuildHistoryWithKB(s.kbase, dbMessages, 10, req.Message)
-	response, err = StreamPlainTokens(c, func(yield func(string) bool) error {
-		return s.withEngineLocked(func() error {
-			return s.engine.ChatStream(history, yield)
-		})
-	}, StreamOptions{})
+	response, err = StreamPlainTokens(c, s.chatTokens(req, dbMessages, filter), StreamOptions{})
 
 	if err != nil {
 		return
@@ -289,6 +337,19 @@ func (s *Server) ChatStreamWithConversation(c *gin.Context) {
 	})
 }
 
+// chatTokens 流式回答的生成函数：SQL 模式先查询表格数据，否则使用知识库检索增强
+func (s *Server) chatTokens(req ChatRequest, dbMessages []db.Message, filter db.ChunkFilter) TokenProducer {
+	if req.Mode == ChatModeSQL {
+		return s.sqlTokens(BuildHistory(dbMessages, 10), req.Message, filter)
+	}
+	history := augmentHistoryWithKB(s.kbase, BuildHistory(dbMessages, 10), req.Message, filter)
+	return func(yield func(string) bool) error {
+		return s.withEngineLocked(func() error {
+			return s.engine.ChatStream(history, yield)
+		})
+	}
+}
+
 func (s *Server) RetryStream(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil || id == 0 {
@@ -314,7 +375,7 @@ func (s *Server) RetryStream(c *gin.Context) {
 	}
 
 	var response string
-	history := BuildRetryHistoryWithKB(s.kbase, dbMessages, 5)
+	history := BuildRetryHistoryWithKB(s.kbase, dbMessages, 5, kbScope(convID, nil)...)
 	fmt.Printf("[Retry] History length: %d\n", len(history))
 	for i, msg := range history {
 		fmt.Printf("[Retry] Msg %d (%s): %s\n", i, msg.Role, truncateRunes(msg.Content, 50))
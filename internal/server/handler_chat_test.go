@@ -0,0 +1,47 @@
+//go:build cgo
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"knowledge/internal/db"
+	"knowledge/internal/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatRequestEmailFilters(t *testing.T) {
+	openTestDB(t)
+	f, err := db.SaveKBFile(1, "/mail/inbox.mbox", 1, "h")
+	assert.NoError(t, err)
+	sent := func(s string) *time.Time {
+		ts, _ := time.Parse(time.RFC3339, s)
+		return &ts
+	}
+	for _, ch := range []db.KnowledgeBaseChunk{
+		{FileID: f.ID, Content: "budget review from alice", ChunkMeta: db.ChunkMeta{Sender: "Alice <alice@example.com>", SentAt: sent("2024-03-01T10:00:00Z")}},
+		{FileID: f.ID, Content: "budget review from bob", ChunkMeta: db.ChunkMeta{Sender: "Bob <bob@example.com>", SentAt: sent("2024-03-01T10:00:00Z")}},
+		{FileID: f.ID, Content: "budget review from alice, later", ChunkMeta: db.ChunkMeta{Sender: "Alice <alice@example.com>", SentAt: sent("2024-05-01T10:00:00Z")}},
+	} {
+		assert.NoError(t, db.DB.Create(&ch).Error)
+	}
+
+	req := ChatRequest{Message: "budget", CollectionIDs: []uint{1}, From: "alice", Before: "2024-04-01"}
+	filter, err := req.kbFilter(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1}, filter.CollectionIDs)
+	assert.Equal(t, "alice", filter.Sender)
+	assert.True(t, filter.After.IsZero())
+
+	// 过滤条件作用于检索候选：只有 4 月之前 alice 的邮件进入上下文
+	history := augmentHistoryWithKB(nil, []llm.ChatMessage{{Role: "user", Content: "budget"}}, "budget", filter)
+	prompt := history[0].Content
+	assert.Contains(t, prompt, "budget review from alice\n")
+	assert.NotContains(t, prompt, "from bob")
+	assert.NotContains(t, prompt, "later")
+
+	_, err = ChatRequest{Message: "budget", After: "March"}.kbFilter(0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"knowledge/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SaveCollectionRequest 创建/修改集合的参数。集合的 embedding 模型只读：
+// 由生成向量时使用的模型记录，切换模型后由后台重新生成向量任务更新
+type SaveCollectionRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Folders      []string `json:"folders"`
+	ChunkSize    int      `json:"chunk_size"` // 0 表示按文件类型使用默认值
+	ChunkOverlap int      `json:"chunk_overlap"`
+}
+
+// validate 校验分片参数，规则与按类型的分片设置一致
+func (r SaveCollectionRequest) validate() error {
+	if r.ChunkSize == 0 && r.ChunkOverlap == 0 {
+		return nil
+	}
+	if r.ChunkSize < 32 || r.ChunkOverlap < 0 || r.ChunkOverlap >= r.ChunkSize {
+		return errors.New("invalid chunk settings: chunk_size must be 0 or >= 32 and 0 <= chunk_overlap < chunk_size")
+	}
+	return nil
+}
+
+type UpdateConversationCollectionsRequest struct {
+	CollectionIDs []uint `json:"collection_ids"`
+}
+
+func (s *Server) ListCollections(c *gin.Context) {
+	cs, err := db.ListCollections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cs)
+}
+
+func (s *Server) CreateCollection(c *gin.Context) {
+	var req SaveCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	col := &db.KnowledgeBaseCollection{}
+	applyCollectionRequest(col, req)
+	if err := db.SaveCollection(col); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.restartKBWatch()
+	c.JSON(http.StatusOK, col)
+}
+
+func (s *Server) UpdateCollection(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid collection id"})
+		return
+	}
+	var req SaveCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	col, err := db.GetCollection(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		return
+	}
+	if col.Name == db.DefaultCollectionName && req.Name != col.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "default collection cannot be renamed"})
+		return
+	}
+	applyCollectionRequest(col, req)
+	if err := db.SaveCollection(col); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 默认集合的第一个目录与旧的单目录设置保持一致
+	if col.Name == db.DefaultCollectionName {
+		folder := ""
+		if len(col.Folders) > 0 {
+			folder = col.Folders[0]
+		}
+		_ = db.SetSetting(db.KBFolderKey, folder)
+	}
+	s.restartKBWatch()
+	c.JSON(http.StatusOK, col)
+}
+
+func (s *Server) DeleteCollection(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid collection id"})
+		return
+	}
+	if err := db.DeleteCollection(uint(id)); err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.restartKBWatch()
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// UpdateConversationCollections 设置对话检索的知识库集合；对话不存在时返回 404，集合不存在时返回 400
+func (s *Server) UpdateConversationCollections(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation id"})
+		return
+	}
+	var req UpdateConversationCollectionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	collections, err := db.ListCollections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, cid := range req.CollectionIDs {
+		if !slices.ContainsFunc(collections, func(col db.KnowledgeBaseCollection) bool { return col.ID == cid }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("collection %d not found", cid)})
+			return
+		}
+	}
+	if err := db.UpdateConversationCollections(uint(id), req.CollectionIDs); err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func applyCollectionRequest(col *db.KnowledgeBaseCollection, req SaveCollectionRequest) {
+	col.Name = req.Name
+	col.Folders = req.Folders
+	col.ChunkSize = req.ChunkSize
+	col.ChunkOverlap = req.ChunkOverlap
+}
+
+// collectionErrorStatus 集合操作错误对应的 HTTP 状态码
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrDefaultCollection):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// restartKBWatch 集合目录变化后重新挂载目录监听
+func (s *Server) restartKBWatch() {
+	if s.kbase == nil {
+		return
+	}
+	if err := s.kbase.StartWatching(); err != nil {
+		fmt.Printf("[KB] Failed to watch folders: %v\n", err)
+	}
+}
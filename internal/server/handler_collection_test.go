@@ -0,0 +1,57 @@
+//go:build cgo
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"knowledge/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDB 在临时目录中初始化数据库（go-sqlite3 需要 cgo）
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db.InitDB(filepath.Join(t.TempDir(), "knowledge.db"))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		db.DB = nil
+	})
+}
+
+func TestUpdateConversationCollections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	openTestDB(t)
+	conv, err := db.CreateConversation("测试")
+	assert.NoError(t, err)
+	col := db.KnowledgeBaseCollection{Name: "手册"}
+	assert.NoError(t, db.SaveCollection(&col))
+
+	s := &Server{}
+	r := gin.New()
+	r.PUT("/conversations/:id/collections", s.UpdateConversationCollections)
+	put := func(id uint, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/conversations/%d/collections", id), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, put(conv.ID, fmt.Sprintf(`{"collection_ids":[%d]}`, col.ID)))
+	got, err := db.GetConversation(conv.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{col.ID}, got.CollectionIDs)
+
+	assert.Equal(t, http.StatusNotFound, put(conv.ID+100, `{"collection_ids":[]}`))
+	assert.Equal(t, http.StatusBadRequest, put(conv.ID, fmt.Sprintf(`{"collection_ids":[%d]}`, col.ID+100)))
+}
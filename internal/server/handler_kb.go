@@ -1,21 +1,26 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"html"
+	"mime"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"knowledge/internal/db"
+	"knowledge/internal/kb"
 	"knowledge/internal/llm"
 
 	"github.com/gin-gonic/gin"
-	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 type UpdateSettingRequest struct {
@@ -37,36 +42,140 @@ func (s *Server) UpdateKBFolder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 兼容旧的单目录设置：同步到默认集合
+	if err := db.SetDefaultCollectionFolder(req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 目录变更后重新挂载监听
+	s.restartKBWatch()
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// DownloadKBFile 返回知识库文件：引用链接按 id 定位唯一的文件记录，预览等只知道文件名的场景按 file 查找
 func (s *Server) DownloadKBFile(c *gin.Context) {
-	fileName := c.Query("file")
-	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File parameter is required"})
+	var filePath string
+	if idParam := c.Query("id"); idParam != "" {
+		id, err := strconv.ParseUint(idParam, 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+			return
+		}
+		f, err := db.GetKBFile(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		filePath = f.Path
+	} else {
+		fileName := c.Query("file")
+		if fileName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File parameter is required"})
+			return
+		}
+
+		// Resolve path across collection folders
+		var err error
+		filePath, err = resolveKBFilePath(fileName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Knowledge base folder not configured"})
+			return
+		}
+	}
+
+	// Check if file exists
+	if !kb.FileExists(filePath) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
 
-	// Sanitize filename
+	// 压缩包内的文件直接返回解压后的内容
+	if kb.IsArchiveEntry(filePath) {
+		data, err := kb.ReadArchiveEntry(filePath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive entry: " + err.Error()})
+			return
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(filePath))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		c.Data(http.StatusOK, contentType, data)
+		return
+	}
+
+	// 以 inline 方式返回，浏览器内置的 PDF 阅读器可识别链接中的 #page=N 跳到对应页
+	c.File(filePath)
+}
+
+// resolveKBFilePath 按文件名定位知识库文件：优先从已索引的记录中查找（覆盖所有集合目录），
+// 找不到时回退到默认目录。只使用文件名部分，防止路径遍历。
+func resolveKBFilePath(fileName string) (string, error) {
 	cleanName := filepath.Base(fileName)
+	if f, err := db.FindKBFileByName(cleanName); err == nil {
+		return f.Path, nil
+	}
 
-	// Get KB folder
 	folder, err := db.GetKBFolder()
 	if err != nil || folder == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Knowledge base folder not configured"})
-		return
+		return "", fmt.Errorf("knowledge base folder not set")
 	}
+	return filepath.Join(folder, cleanName), nil
+}
 
-	// Join path
-	filePath := filepath.Join(folder, cleanName)
+// ListKBFormats 返回已注册抽取器支持的文件扩展名
+func (s *Server) ListKBFormats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"extensions": kb.SupportedExtensions()})
+}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+// GetKBChunkSettings 返回各文件类型的分片参数（按 token 计）
+func (s *Server) GetKBChunkSettings(c *gin.Context) {
+	types, err := kb.ChunkTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"types": types})
+}
 
-	c.File(filePath)
+// UpdateKBChunkSettings 按文件类型设置分片参数；chunk_size 为 0 表示恢复默认值。
+// 新参数对之后重新处理的文件生效
+func (s *Server) UpdateKBChunkSettings(c *gin.Context) {
+	var req map[string]db.ChunkSetting
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	types, err := kb.ChunkTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	settings, err := db.GetKBChunkSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for name, setting := range req {
+		if !slices.ContainsFunc(types, func(t kb.ChunkType) bool { return t.Name == name }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown file type: %s", name)})
+			return
+		}
+		if setting.ChunkSize == 0 {
+			delete(settings, name)
+			continue
+		}
+		if setting.ChunkSize < 32 || setting.ChunkOverlap < 0 || setting.ChunkOverlap >= setting.ChunkSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid chunk settings for %s: chunk_size must be >= 32 and 0 <= chunk_overlap < chunk_size", name)})
+			return
+		}
+		settings[name] = setting
+	}
+	if err := db.SetKBChunkSettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.GetKBChunkSettings(c)
 }
 
 // GetKBFileContent 获取文件经过解析后的文本内容（用于预览）
@@ -77,21 +186,15 @@ func (s *Server) GetKBFileContent(c *gin.Context) {
 		return
 	}
 
-	folder, err := db.GetKBFolder()
-	if err != nil || folder == "" {
+	// 只按文件名定位（防止路径遍历），在各集合已索引的文件中查找
+	filePath, err := resolveKBFilePath(fileName)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Knowledge base folder not set"})
 		return
 	}
 
-	// 简单防止路径遍历，只允许访问 KB 根目录下的文件
-	// 如果支持子目录，需要更复杂的逻辑，但目前 KB 主要是扁平的或由 ScanFolder 决定
-	// 这里假设前端传来的只是文件名或相对路径
-	// 安全起见，我们先只取 Base
-	cleanFileName := filepath.Base(fileName)
-	filePath := filepath.Join(folder, cleanFileName)
-
 	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if !kb.FileExists(filePath) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
@@ -115,15 +218,13 @@ func (s *Server) PreviewKBExcel(c *gin.Context) {
 		return
 	}
 
-	folder, err := db.GetKBFolder()
-	if err != nil || folder == "" {
+	filePath, err := resolveKBFilePath(fileName)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Knowledge base folder not set"})
 		return
 	}
-
-	cleanFileName := filepath.Base(fileName)
-	filePath := filepath.Join(folder, cleanFileName)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	cleanFileName := filepath.Base(filePath)
+	if !kb.FileExists(filePath) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
@@ -134,12 +235,21 @@ func (s *Server) PreviewKBExcel(c *gin.Context) {
 		return
 	}
 
-	f, err := excelize.OpenFile(filePath)
+	// 压缩包内的表格先解压到临时目录
+	localPath, cleanup, err := kb.LocalFile(filePath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open excel: " + err.Error()})
 		return
 	}
-	defer func() { _ = f.Close() }()
+	defer cleanup()
+
+	// xlsx 与旧版 xls（BIFF8）共用同一读取接口
+	wb, err := kb.OpenWorkbook(localPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open excel: " + err.Error()})
+		return
+	}
+	defer func() { _ = wb.Close() }()
 
 	c.Header("Content-Type", "text/html; charset=utf-8")
 
@@ -165,32 +275,23 @@ func (s *Server) PreviewKBExcel(c *gin.Context) {
 	</style></head><body>`)
 	_, _ = c.Writer.WriteString("<div class=\"top\"><div class=\"fn\">" + html.EscapeString(cleanFileName) + "</div><div class=\"hint\">Excel 预览（完整数据）</div></div>")
 
-	sheets := f.GetSheetList()
+	sheets := wb.SheetNames()
 	if len(sheets) == 0 {
 		_, _ = c.Writer.WriteString("<div class=\"sheet\"><div class=\"empty\">无工作表</div></div></body></html>")
 		return
 	}
 
 	for _, sheet := range sheets {
-		rows, err := f.Rows(sheet)
-		if err != nil {
-			continue
-		}
-
 		_, _ = c.Writer.WriteString("<div class=\"sheet\"><h2>" + html.EscapeString(sheet) + "</h2>")
 		_, _ = c.Writer.WriteString("<div class=\"table-wrap\"><table>")
 
-		rowNum := 0
+		rowCount := 0
 		var header []string
-		for rows.Next() {
-			rowNum++
-			cells, err := rows.Columns()
-			if err != nil {
-				continue
-			}
+		for _, cells := range wb.Rows(sheet) {
+			rowCount++
 
 			// 第一行作为表头（若为空则自动补列名）
-			if rowNum == 1 {
+			if rowCount == 1 {
 				header = make([]string, len(cells))
 				for i := range cells {
 					h := strings.TrimSpace(cells[i])
@@ -223,9 +324,7 @@ func (s *Server) PreviewKBExcel(c *gin.Context) {
 			}
 			_, _ = c.Writer.WriteString("</tr>")
 		}
-		_ = rows.Close()
-
-		if rowNum <= 1 {
+		if rowCount <= 1 {
 			_, _ = c.Writer.WriteString("<tbody><tr><td class=\"empty\">无数据</td></tr></tbody>")
 		} else {
 			_, _ = c.Writer.WriteString("</tbody>")
@@ -274,7 +373,15 @@ return posixPath`
 }
 
 func (s *Server) ListKBFiles(c *gin.Context) {
-	files, err := db.ListKBFiles()
+	var (
+		files []db.KnowledgeBaseFile
+		err   error
+	)
+	if cid, _ := strconv.ParseUint(c.Query("collection_id"), 10, 64); cid > 0 {
+		files, err = db.ListKBFilesInCollection(uint(cid))
+	} else {
+		files, err = db.ListKBFiles()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -282,8 +389,26 @@ func (s *Server) ListKBFiles(c *gin.Context) {
 	c.JSON(http.StatusOK, files)
 }
 
+// RetryFailedKBFiles 重新处理失败的文件，可用 collection_id 限定集合；处理在后台进行
+func (s *Server) RetryFailedKBFiles(c *gin.Context) {
+	var collectionIDs []uint
+	if cid, _ := strconv.ParseUint(c.Query("collection_id"), 10, 64); cid > 0 {
+		collectionIDs = append(collectionIDs, uint(cid))
+	}
+	n, err := s.kbase.RetryFailedFiles(collectionIDs...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "count": n})
+}
+
 func (s *Server) SyncKB(c *gin.Context) {
-	if err := s.kbase.ScanFolder(); err != nil {
+	var collectionIDs []uint
+	if cid, _ := strconv.ParseUint(c.Query("collection_id"), 10, 64); cid > 0 {
+		collectionIDs = append(collectionIDs, uint(cid))
+	}
+	if err := s.kbase.ScanFolder(collectionIDs...); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -296,6 +421,38 @@ func (s *Server) SyncKB(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Knowledge base sync started"})
 }
 
+// parseChunkFilter 解析检索过滤参数：collections、from（发件人）、after/before（发送时间，
+// 支持 2006-01-02 或 RFC 3339，after 含当天、before 不含当天）
+func parseChunkFilter(c *gin.Context) (db.ChunkFilter, error) {
+	filter := db.ChunkFilter{
+		CollectionIDs: parseCollectionIDs(c.Query("collections")),
+		Sender:        strings.TrimSpace(c.Query("from")),
+	}
+	var err error
+	if filter.After, err = parseFilterTime("after", c.Query("after")); err != nil {
+		return filter, err
+	}
+	if filter.Before, err = parseFilterTime("before", c.Query("before")); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseFilterTime 解析 after/before 过滤时间（2006-01-02 按本地时区，或 RFC 3339）；空值返回零值
+func parseFilterTime(key, v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, v); err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s: %q (want YYYY-MM-DD or RFC 3339)", key, v)
+		}
+	}
+	return t, nil
+}
+
 func (s *Server) DebugKBSearch(c *gin.Context) {
 	q := strings.TrimSpace(c.Query("q"))
 	if q == "" {
@@ -314,45 +471,61 @@ func (s *Server) DebugKBSearch(c *gin.Context) {
 	if llm.CurrentEngine != nil {
 		currentModel = llm.CurrentEngine.GetModelPath()
 	}
-	kbModel, _ := db.GetKBEmbeddingModel()
+	filter, err := parseChunkFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	collectionIDs := filter.CollectionIDs
 
 	// 候选集来自文本检索（能确保命中包含编号/关键字的 chunk）
-	candidates, err := db.SearchKBChunks(q, 800)
+	candidates, err := db.SearchKBChunksFiltered(q, 800, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	vecCollections, _, mismatched := vectorSearchCollections(collectionIDs, currentModel)
+	kbModel := strings.Join(mismatched, ",")
+
 	queryVec, vecErr := func() ([]float32, error) {
 		if llm.CurrentEngine == nil {
 			return nil, fmt.Errorf("LLM engine not initialized")
 		}
-		if kbModel != "" && currentModel != "" && kbModel != currentModel {
+		if len(vecCollections) == 0 {
 			return nil, fmt.Errorf("embedding model mismatch (kb=%s, current=%s)", kbModel, currentModel)
 		}
 		return llm.CurrentEngine.GetEmbedding(q)
 	}()
 
 	type item struct {
-		ID         uint    `json:"id"`
-		FileID     uint    `json:"file_id"`
-		Similarity float32 `json:"similarity"`
-		HasVector  bool    `json:"has_vector"`
-		Snippet    string  `json:"snippet"`
+		ID         uint         `json:"id"`
+		FileID     uint         `json:"file_id"`
+		Similarity float32      `json:"similarity"`
+		HasVector  bool         `json:"has_vector"`
+		Model      string       `json:"embedding_model,omitempty"`
+		Snippet    string       `json:"snippet"`
+		Meta       db.ChunkMeta `json:"meta"`
+		Source     string       `json:"source,omitempty"` // 下载链接，PDF 带 #page= 跳到对应页
+	}
+	newItem := func(ch db.KnowledgeBaseChunk, sim float32) item {
+		return item{
+			ID:         ch.ID,
+			FileID:     ch.FileID,
+			Similarity: sim,
+			HasVector:  len(ch.Vector) > 0,
+			Model:      ch.EmbeddingModel,
+			Snippet:    truncateRunes(ch.Content, 120),
+			Meta:       ch.ChunkMeta,
+			Source:     kbSourceLink(ch.FileID, ch.PageStart),
+		}
 	}
 
 	res := make([]item, 0, limit)
 	if vecErr != nil || len(queryVec) == 0 {
 		// 无向量时仅返回文本命中情况
 		for i := 0; i < len(candidates) && i < limit; i++ {
-			ch := candidates[i]
-			res = append(res, item{
-				ID:         ch.ID,
-				FileID:     ch.FileID,
-				Similarity: 0,
-				HasVector:  len(ch.Vector) > 0,
-				Snippet:    truncateRunes(ch.Content, 120),
-			})
+			res = append(res, newItem(candidates[i], 0))
 		}
 		c.JSON(http.StatusOK, gin.H{
 			"q":                  q,
@@ -369,13 +542,14 @@ func (s *Server) DebugKBSearch(c *gin.Context) {
 		ch  db.KnowledgeBaseChunk
 		sim float32
 	}
+	vecFiles := fileIDsInCollections(vecCollections)
 	scoredList := make([]scored, 0, len(candidates))
 	for _, ch := range candidates {
-		if len(ch.Vector) == 0 {
+		if !vecFiles[ch.FileID] {
 			continue
 		}
-		v := bytesToFloat32Slice(ch.Vector)
-		if len(v) != len(queryVec) {
+		v, ok := chunkVector(ch, currentModel)
+		if !ok || len(v) != len(queryVec) {
 			continue
 		}
 		scoredList = append(scoredList, scored{ch: ch, sim: cosineSimilarity(queryVec, v)})
@@ -384,14 +558,7 @@ func (s *Server) DebugKBSearch(c *gin.Context) {
 	sort.Slice(scoredList, func(i, j int) bool { return scoredList[i].sim > scoredList[j].sim })
 
 	for i := 0; i < len(scoredList) && i < limit; i++ {
-		ch := scoredList[i].ch
-		res = append(res, item{
-			ID:         ch.ID,
-			FileID:     ch.FileID,
-			Similarity: scoredList[i].sim,
-			HasVector:  true,
-			Snippet:    truncateRunes(ch.Content, 120),
-		})
+		res = append(res, newItem(scoredList[i].ch, scoredList[i].sim))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -445,12 +612,22 @@ func (s *Server) UploadKBFile(c *gin.Context) {
 		return
 	}
 
-	// 2. Get KB folder
-	folder, err := db.GetKBFolder()
-	if err != nil || folder == "" {
+	// 2. Get target collection folder (default collection if not specified)
+	var collection *db.KnowledgeBaseCollection
+	if cid, _ := strconv.ParseUint(c.PostForm("collection_id"), 10, 64); cid > 0 {
+		collection, err = db.GetCollection(uint(cid))
+	} else {
+		collection, err = db.GetDefaultCollection()
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection not found"})
+		return
+	}
+	if len(collection.Folders) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Knowledge base folder not set"})
 		return
 	}
+	folder := collection.Folders[0]
 
 	// Ensure folder exists
 	if _, err := os.Stat(folder); os.IsNotExist(err) {
@@ -468,7 +645,7 @@ func (s *Server) UploadKBFile(c *gin.Context) {
 	}
 
 	// 4. Add to KnowledgeBase
-	if err := s.kbase.AddFile(dst); err != nil {
+	if err := s.kbase.AddFile(collection.ID, dst); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process file: " + err.Error()})
 		return
 	}
@@ -531,3 +708,145 @@ func (s *Server) UpdateSystemPrompt(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
+
+// GetOCRSettings 获取 OCR 配置、可选的语言包及当前生效的 OCR 命令（不可用时为空）
+func (s *Server) GetOCRSettings(c *gin.Context) {
+	settings, err := db.GetKBOCRSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disabled": settings.Disabled, "languages": settings.Languages, "available_languages": kb.OCRLanguages(), "active": kb.OCREngine()})
+}
+
+// UpdateOCRSettings 更新 OCR 配置；只能开关 OCR 和选择已安装的 tesseract 语言包，命令由启动参数 -ocr-cmd 指定
+func (s *Server) UpdateOCRSettings(c *gin.Context) {
+	var req db.OCRSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Languages = strings.TrimSpace(req.Languages)
+	if err := kb.ValidateOCRLanguages(req.Languages); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.SetKBOCRSettings(req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GetKBScanSettings 获取扫描规则：gitignore 风格的排除规则、按类型的大小上限、隐藏目录与符号链接处理
+func (s *Server) GetKBScanSettings(c *gin.Context) {
+	settings, err := db.GetKBScanSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateKBScanSettings 更新扫描规则；大小上限以 MB 为单位，键为文件类型（如 pdf、excel）或 "*"，下次同步时生效
+func (s *Server) UpdateKBScanSettings(c *gin.Context) {
+	var req db.ScanSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for typ, mb := range req.MaxFileSizeMB {
+		if mb < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid size limit for " + typ})
+			return
+		}
+	}
+	if err := db.SetKBScanSettings(req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GetEmbeddingCacheStats 持久化 embedding 缓存的条目数、占用字节数与条目上限
+func (s *Server) GetEmbeddingCacheStats(c *gin.Context) {
+	entries, size, err := db.EmbeddingCacheStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "bytes": size, "max_entries": kb.EmbeddingCacheMaxEntries})
+}
+
+// ListKBJobs 列出知识库处理任务，可按 status（queued/running/done/failed/canceled）过滤
+func (s *Server) ListKBJobs(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", db.JobQueued, db.JobRunning, db.JobDone, db.JobFailed, db.JobCanceled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	jobs, err := db.ListKBJobs(status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// ListKBReembedJobs 最近的重新生成向量任务（embedding 模型变化后按集合在后台迁移向量）
+func (s *Server) ListKBReembedJobs(c *gin.Context) {
+	jobs, err := db.ListKBReembedJobs(50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// RetryKBJob 重新排队失败或已取消的任务
+func (s *Server) RetryKBJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+	if err := s.kbase.RetryJob(uint(id)); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// CancelKBJob 取消排队中或正在执行的任务
+func (s *Server) CancelKBJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+	if err := s.kbase.CancelJob(uint(id)); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// jobErrorStatus 任务不存在时返回 404，状态不允许该操作时返回 409
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, kb.ErrJobState):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,56 @@
+//go:build cgo
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"knowledge/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadKBFileByID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	openTestDB(t)
+	dir := t.TempDir()
+	var ids []uint
+	for _, sub := range []string{"a", "b"} {
+		p := filepath.Join(dir, sub, "manual.txt")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(t, os.WriteFile(p, []byte("manual "+sub), 0o644))
+		f, err := db.SaveKBFile(1, p, 8, sub)
+		assert.NoError(t, err)
+		ids = append(ids, f.ID)
+	}
+
+	s := &Server{}
+	r := gin.New()
+	r.GET("/api/kb/download", s.DownloadKBFile)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// 同名文件按 ID 区分，引用链接打开的是对应的那一个
+	link := kbSourceLink(ids[1], 3)
+	assert.Equal(t, fmt.Sprintf("/api/kb/download?id=%d#page=3", ids[1]), link)
+	w := get(fmt.Sprintf("/api/kb/download?id=%d", ids[1]))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "manual b", w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("/api/kb/download?id=999").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/kb/download?id=x").Code)
+
+	// 只知道文件名时按文件名查找（通配符按字面匹配），找不到时回退到默认目录
+	assert.NoError(t, db.SetSetting(db.KBFolderKey, dir))
+	assert.Equal(t, "manual a", get("/api/kb/download?file=manual.txt").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/api/kb/download?file=manual_txt").Code)
+}
@@ -28,20 +28,21 @@ func BuildHistory(dbMessages []db.Message, tail int) []llm.ChatMessage {
 
 // BuildHistoryWithKB 从数据库消息构建带知识库上下文的聊天历史
 // 该函数会截取最后tail条消息，转换为llm.ChatMessage格式，并添加知识库上下文
-func BuildHistoryWithKB(kbase *kb.KnowledgeBase, dbMessages []db.Message, tail int, seed string) []llm.ChatMessage {
+// collectionIDs 指定检索的知识库集合，不传表示全部集合
+func BuildHistoryWithKB(kbase *kb.KnowledgeBase, dbMessages []db.Message, tail int, seed string, collectionIDs ...uint) []llm.ChatMessage {
 	history := BuildHistory(dbMessages, tail)
-	return augmentHistoryWithKB(kbase, history, seed)
+	return augmentHistoryWithKB(kbase, history, seed, db.ChunkFilter{CollectionIDs: collectionIDs})
 }
 
 // BuildRetryHistoryWithKB 为重试操作构建带知识库上下文的聊天历史
 // 该函数会截取最后tail条消息，转换为llm.ChatMessage格式，
 // 如果最后一条是用户消息，则添加知识库上下文
-func BuildRetryHistoryWithKB(kbase *kb.KnowledgeBase, dbMessages []db.Message, tail int) []llm.ChatMessage {
+func BuildRetryHistoryWithKB(kbase *kb.KnowledgeBase, dbMessages []db.Message, tail int, collectionIDs ...uint) []llm.ChatMessage {
 	history := BuildHistory(dbMessages, tail)
 	
 	// 如果历史记录不为空且最后一条是用户消息，则添加知识库上下文
 	if len(history) > 0 && history[len(history)-1].Role == "user" {
-		return augmentHistoryWithKB(kbase, history, history[len(history)-1].Content)
+		return augmentHistoryWithKB(kbase, history, history[len(history)-1].Content, db.ChunkFilter{CollectionIDs: collectionIDs})
 	}
 	
 	return history
@@ -38,6 +38,7 @@ func SetupRouter(staticFS embed.FS, engine llm.Engine, kbase *kb.KnowledgeBase)
 		api.POST("/conversations/batch-delete", s.BatchDeleteConversations)
 		api.POST("/conversations", s.CreateConversation)
 		api.GET("/conversations/:id/messages", s.GetConversationMessages)
+		api.PUT("/conversations/:id/collections", s.UpdateConversationCollections)
 
 		// /history is an alias for getting default conversation messages
 		api.GET("/history", func(c *gin.Context) {
@@ -53,14 +54,14 @@ func SetupRouter(staticFS embed.FS, engine llm.Engine, kbase *kb.KnowledgeBase)
 		api.GET("/models", s.ListModels)
 		api.POST("/models/select", s.SelectModel)
 
-		api.POST("/chat", s.Chat)
-		api.POST("/chat/stream", s.ChatStream)
+		api.POST("/chat", interactive, s.Chat)
+		api.POST("/chat/stream", interactive, s.ChatStream)
 
-		api.POST("/conversations/:id/chat", s.ChatWithConversation)
-		api.POST("/conversations/:id/chat/stream", s.ChatStreamWithConversation)
+		api.POST("/conversations/:id/chat", interactive, s.ChatWithConversation)
+		api.POST("/conversations/:id/chat/stream", interactive, s.ChatStreamWithConversation)
 
 		api.PATCH("/conversations/:id/messages/:mid", s.UpdateMessage)
-		api.POST("/conversations/:id/retry/stream", s.RetryStream)
+		api.POST("/conversations/:id/retry/stream", interactive, s.RetryStream)
 
 		// 知识库设置相关接口
 		api.GET("/settings/kb-folder", s.GetKBFolder)
@@ -68,14 +69,31 @@ func SetupRouter(staticFS embed.FS, engine llm.Engine, kbase *kb.KnowledgeBase)
 		api.POST("/settings/select-folder", s.SelectKBFolder)
 		api.GET("/settings/system-prompt", s.GetSystemPrompt)
 		api.POST("/settings/system-prompt", s.UpdateSystemPrompt)
-
+		api.GET("/settings/ocr", s.GetOCRSettings)
+		api.POST("/settings/ocr", s.UpdateOCRSettings)
+		api.GET("/settings/kb-scan", s.GetKBScanSettings)
+		api.POST("/settings/kb-scan", s.UpdateKBScanSettings)
+
+		api.GET("/kb/collections", s.ListCollections)
+		api.POST("/kb/collections", s.CreateCollection)
+		api.PUT("/kb/collections/:id", s.UpdateCollection)
+		api.DELETE("/kb/collections/:id", s.DeleteCollection)
 		api.GET("/kb/files", s.ListKBFiles)
+		api.GET("/kb/formats", s.ListKBFormats)
+		api.GET("/kb/chunk-settings", s.GetKBChunkSettings)
+		api.PUT("/kb/chunk-settings", s.UpdateKBChunkSettings)
 		api.GET("/kb/download", s.DownloadKBFile)
 		api.GET("/kb/content", s.GetKBFileContent)
 		api.GET("/kb/excel/preview", s.PreviewKBExcel)
-		api.GET("/kb/debug/search", s.DebugKBSearch)
+		api.GET("/kb/debug/search", interactive, s.DebugKBSearch)
+		api.GET("/kb/embedding-cache", s.GetEmbeddingCacheStats)
+		api.GET("/kb/jobs", s.ListKBJobs)
+		api.POST("/kb/jobs/:id/retry", s.RetryKBJob)
+		api.POST("/kb/jobs/:id/cancel", s.CancelKBJob)
+		api.GET("/kb/reembed-jobs", s.ListKBReembedJobs)
 		api.DELETE("/kb/files/:id", s.DeleteKBFile)
 		api.POST("/kb/files/batch-delete", s.BatchDeleteKBFiles)
+		api.POST("/kb/files/retry-failed", s.RetryFailedKBFiles)
 		api.POST("/kb/sync", s.SyncKB)
 		api.POST("/kb/sync/pause", s.PauseKBSync)
 		api.POST("/kb/sync/resume", s.ResumeKBSync)
@@ -87,7 +105,7 @@ func SetupRouter(staticFS embed.FS, engine llm.Engine, kbase *kb.KnowledgeBase)
 
 	v1 := r.Group("/v1")
 	{
-		v1.POST("/chat/completions", s.OAIChatCompletion)
+		v1.POST("/chat/completions", interactive, s.OAIChatCompletion)
 	}
 
 	return r
@@ -4,6 +4,8 @@ import (
 	"knowledge/internal/kb"
 	"knowledge/internal/llm"
 	"sync"
+
+	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
@@ -19,6 +21,12 @@ func NewServer(engine llm.Engine, kbase *kb.KnowledgeBase) *Server {
 	}
 }
 
+// interactive 标记交互请求（对话、检索）进行中，后台补齐向量等任务在此期间让出引擎
+func interactive(c *gin.Context) {
+	defer llm.BeginInteractive()()
+	c.Next()
+}
+
 func (s *Server) withEngineLocked(fn func() error) error {
 	s.engineMu.Lock()
 	defer s.engineMu.Unlock()
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"knowledge/internal/db"
+	"knowledge/internal/llm"
+)
+
+// text-to-SQL：表格文件物化的 SQLite 表上由模型生成只读 SELECT，执行后基于结果回答
+const (
+	sqlMaxRows    = 200              // 查询结果最多读取的行数
+	sqlPromptRows = 50               // 放入回答提示词的行数
+	sqlSampleRows = 3                // 表结构说明中附带的示例行
+	sqlTimeout    = 10 * time.Second // 单条查询的执行超时
+	sqlMaxTables  = 20               // 表结构说明中最多列出的表
+)
+
+// errNoSQL 模型判断问题无法用表格回答（或检索范围内没有表格），回退到普通知识库问答
+var errNoSQL = errors.New("question cannot be answered with SQL")
+
+var (
+	sqlFence        = regexp.MustCompile("(?is)```(?:sql|sqlite)?\\s*(.*?)```")
+	sqlStart        = regexp.MustCompile(`(?is)\b(select|with)\b.*`)
+	sqlLineComment  = regexp.MustCompile(`--[^\n]*`)
+	sqlBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	sqlString       = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlIdent        = regexp.MustCompile(`"(?:[^"]|"")*"|\x60[^\x60]*\x60|\[[^\]]*\]|[\p{L}_][\p{L}\p{N}_$]*`)
+	sqlLeading      = regexp.MustCompile(`(?i)^(select|with)\b`)
+	// SQLite 允许把字符串字面量当作表名（FROM 'messages'），这些位置的字面量需要按表名检查
+	sqlTableKeyword = regexp.MustCompile(`(?i)\b(from|join)\s*$`)
+	sqlTableListSep = regexp.MustCompile(`[,.(]\s*$`)
+	// 写操作、事务、PRAGMA、ATTACH 以及系统表/表值函数
+	sqlForbidden = regexp.MustCompile(`(?i)\b(insert|update|delete|replace\s+into|drop|alter|create|attach|detach|pragma|vacuum|reindex|analyze|begin|commit|rollback|savepoint|release|load_extension)\b|\b(sqlite|pragma)_\w+`)
+)
+
+// sqlGeneration 生成 SQL 的结果：query 为校验通过并执行成功的语句
+type sqlGeneration struct {
+	query     string
+	columns   []string
+	rows      [][]string
+	truncated bool
+}
+
+// generateSQL 让模型为问题写一条 SELECT 并执行；执行失败时把错误反馈给模型修正一次。
+// 调用方需持有引擎锁
+func (s *Server) generateSQL(question string, scope []uint) (*sqlGeneration, error) {
+	tables, err := db.ListKBTables(scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, errNoSQL
+	}
+	if len(tables) > sqlMaxTables {
+		tables = tables[:sqlMaxTables]
+	}
+	allowed := make([]string, len(tables))
+	for i, t := range tables {
+		allowed[i] = t.Name
+	}
+	existing, err := db.ListTableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := []llm.ChatMessage{{Role: "user", Content: sqlPrompt(tables, question)}}
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, err := s.chatDeterministic(msgs)
+		if err != nil {
+			return nil, err
+		}
+		query := extractSQL(reply)
+		if query == "" {
+			return nil, errNoSQL
+		}
+		gen, err := runSQL(query, allowed, existing)
+		if err == nil {
+			fmt.Printf("[SQL] %s -> %d rows\n", gen.query, len(gen.rows))
+			return gen, nil
+		}
+		fmt.Printf("[SQL] Query failed (attempt %d): %s: %v\n", attempt+1, query, err)
+		lastErr = fmt.Errorf("%w\n\n```sql\n%s\n```", err, query)
+		msgs = append(msgs,
+			llm.ChatMessage{Role: "assistant", Content: reply},
+			llm.ChatMessage{Role: "user", Content: "这条 SQL 执行失败：" + err.Error() + "\n请修正后重新输出一条 SQL。"},
+		)
+	}
+	return nil, lastErr
+}
+
+// chatDeterministic 低温度生成，用于 SQL 等需要稳定输出的场景
+func (s *Server) chatDeterministic(msgs []llm.ChatMessage) (string, error) {
+	if e, ok := s.engine.(llm.EngineWithOptions); ok {
+		return e.ChatWithOptions(msgs, llm.ChatOptions{
+			MaxTokens:     512,
+			Temperature:   0.1,
+			TopP:          0.9,
+			TopK:          40,
+			RepeatPenalty: 1.1,
+		})
+	}
+	return s.engine.Chat(msgs)
+}
+
+// runSQL 校验并在只读连接上执行
+func runSQL(query string, allowed, existing []string) (*sqlGeneration, error) {
+	query, err := validateSQL(query, allowed, existing)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+	cols, rows, truncated, err := db.QueryReadOnly(ctx, query, sqlMaxRows)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlGeneration{query: query, columns: cols, rows: rows, truncated: truncated}, nil
+}
+
+// sqlPrompt 生成 SQL 的提示词：表结构（含示例行）与问题
+func sqlPrompt(tables []db.KBTable, question string) string {
+	fileIDs := make([]uint, len(tables))
+	for i, t := range tables {
+		fileIDs[i] = t.FileID
+	}
+	files, _ := db.GetKBFilesByIDs(fileIDs)
+
+	var sb strings.Builder
+	sb.WriteString("你是 SQLite 专家。下面是由用户表格文件导入的数据表，请为问题编写一条 SQLite SELECT 查询。\n" +
+		"要求：只输出一条 SELECT（可用 WITH），放在 ```sql 代码块中，不要解释；列名与表名用双引号括起；" +
+		"DATE 类型的列以 'YYYY-MM-DD' 文本存储，可直接比较或使用 strftime；文本匹配不确定时使用 LIKE。\n" +
+		"如果这些表无法回答该问题，只输出 NONE。\n\n")
+	for _, t := range tables {
+		fmt.Fprintf(&sb, "表 %s（文件 %s，工作表 %s，共 %d 行）\n", db.QuoteIdent(t.Name), filepath.Base(files[t.FileID].Path), t.Sheet, t.RowCount)
+		cols := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			cols[i] = db.QuoteIdent(c.Name) + " " + c.Type
+		}
+		fmt.Fprintf(&sb, "列: %s\n", strings.Join(cols, ", "))
+		ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+		names, rows, _, err := db.QueryReadOnly(ctx, "SELECT * FROM "+db.QuoteIdent(t.Name), sqlSampleRows)
+		cancel()
+		if err == nil && len(rows) > 0 {
+			sb.WriteString("示例:\n")
+			sb.WriteString(formatResultTable(names, rows))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("问题：")
+	sb.WriteString(question)
+	return sb.String()
+}
+
+// extractSQL 从模型回复中取出 SQL：优先取代码块，否则取从 SELECT/WITH 开始的内容；回复 NONE 时返回空串
+func extractSQL(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if m := sqlFence.FindStringSubmatch(reply); m != nil {
+		reply = m[1]
+	}
+	m := sqlStart.FindString(reply)
+	return strings.TrimSpace(m)
+}
+
+// validateSQL 只允许单条 SELECT/WITH 查询，不得包含写操作与 PRAGMA 等语句，
+// 且只能引用 allowed 中的表（existing 为数据库中全部表名）。返回去掉注释与结尾分号后的语句
+func validateSQL(query string, allowed, existing []string) (string, error) {
+	query = sqlBlockComment.ReplaceAllString(query, " ")
+	query = sqlLineComment.ReplaceAllString(query, " ")
+	query = strings.TrimSpace(query)
+	query = strings.TrimSpace(strings.TrimRight(query, "; \t\n"))
+	if query == "" {
+		return "", fmt.Errorf("empty query")
+	}
+	// 关键字与表名检查忽略字符串字面量，避免 WHERE 备注 = 'update' 之类被误判
+	bare := sqlString.ReplaceAllString(query, "''")
+	if strings.Contains(bare, ";") {
+		return "", fmt.Errorf("only a single statement is allowed")
+	}
+	if !sqlLeading.MatchString(bare) {
+		return "", fmt.Errorf("only SELECT queries are allowed")
+	}
+	if m := sqlForbidden.FindString(bare); m != "" {
+		return "", fmt.Errorf("forbidden keyword in query: %s", m)
+	}
+
+	ok := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		ok[strings.ToLower(name)] = true
+	}
+	forbidden := make(map[string]bool)
+	for _, name := range existing {
+		if !ok[strings.ToLower(name)] {
+			forbidden[strings.ToLower(name)] = true
+		}
+	}
+	for _, tok := range sqlIdent.FindAllString(bare, -1) {
+		if forbidden[strings.ToLower(unquoteIdent(tok))] {
+			return "", fmt.Errorf("table %s is not accessible", tok)
+		}
+	}
+	// 紧跟 FROM/JOIN 的字面量只能是表名，一律拒绝；逗号、点号、括号之后的字面量（也可能是 IN 列表中的值）
+	// 只在内容恰好是受限表名或系统表时拒绝
+	for _, loc := range sqlString.FindAllStringIndex(query, -1) {
+		before := query[:loc[0]]
+		name := strings.ToLower(strings.ReplaceAll(query[loc[0]+1:loc[1]-1], "''", "'"))
+		if sqlTableKeyword.MatchString(before) ||
+			(sqlTableListSep.MatchString(before) && (forbidden[name] || sqlForbidden.MatchString(name))) {
+			return "", fmt.Errorf("string literal cannot be used as a table name: %s", query[loc[0]:loc[1]])
+		}
+	}
+	return query, nil
+}
+
+func unquoteIdent(s string) string {
+	if len(s) >= 2 {
+		switch s[0] {
+		case '"':
+			return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+		case '`', '[':
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+// formatResultTable 把查询结果格式化为 Markdown 表格
+func formatResultTable(columns []string, rows [][]string) string {
+	cell := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+	}
+	var sb strings.Builder
+	sb.WriteString("|")
+	for _, c := range columns {
+		sb.WriteString(" " + cell(c) + " |")
+	}
+	sb.WriteString("\n|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		sb.WriteString("|")
+		for _, v := range row {
+			sb.WriteString(" " + cell(v) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// sqlAnswerPrompt 基于查询结果回答的提示词，替换历史中的最后一条用户消息
+func sqlAnswerPrompt(gen *sqlGeneration, question string) string {
+	var sb strings.Builder
+	sb.WriteString("你是一个本地知识库助手。下面是针对问题在用户表格数据上执行的 SQL 及其结果，请仅基于查询结果回答问题；" +
+		"结果为空时说明没有符合条件的数据，不要猜测。\n\n")
+	fmt.Fprintf(&sb, "SQL:\n%s\n\n", gen.query)
+	switch {
+	case len(gen.rows) == 0:
+		sb.WriteString("查询结果：空\n\n")
+	default:
+		rows := gen.rows
+		if len(rows) > sqlPromptRows {
+			rows = rows[:sqlPromptRows]
+		}
+		sb.WriteString("查询结果：\n")
+		sb.WriteString(formatResultTable(gen.columns, rows))
+		if len(rows) < len(gen.rows) || gen.truncated {
+			fmt.Fprintf(&sb, "（结果较多，仅显示前 %d 行）\n", len(rows))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("问题：\n")
+	sb.WriteString(question)
+	return sb.String()
+}
+
+// collectTokens 非流式接口复用流式生成逻辑
+func collectTokens(produce TokenProducer) (string, error) {
+	var sb strings.Builder
+	err := produce(func(token string) bool {
+		sb.WriteString(token)
+		return true
+	})
+	return sb.String(), err
+}
+
+// sqlTokens text-to-SQL 模式的回答：先输出生成的 SQL 代码块，再流式输出基于查询结果的回答；
+// 检索范围内没有表格或模型判断无法用 SQL 回答时回退到普通知识库问答
+func (s *Server) sqlTokens(history []llm.ChatMessage, question string, filter db.ChunkFilter) TokenProducer {
+	return func(yield func(string) bool) error {
+		return s.withEngineLocked(func() error {
+			gen, err := s.generateSQL(question, filter.CollectionIDs)
+			if errors.Is(err, errNoSQL) {
+				history = augmentHistoryWithKB(s.kbase, history, question, filter)
+				return s.engine.ChatStream(history, yield)
+			}
+			if err != nil {
+				yield("SQL 查询失败：" + err.Error())
+				return nil
+			}
+			if !yield("```sql\n" + gen.query + "\n```\n\n") {
+				return nil
+			}
+			if len(history) > 0 && history[len(history)-1].Role == "user" {
+				history[len(history)-1].Content = sqlAnswerPrompt(gen, question)
+			}
+			return s.engine.ChatStream(history, yield)
+		})
+	}
+}
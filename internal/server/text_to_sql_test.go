@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractSQL(t *testing.T) {
+	reply := "好的：\n```sql\nSELECT AVG(\"成绩\") FROM \"kb_table_1_1\" WHERE \"班级\" = 3;\n```"
+	assert.Equal(t, "SELECT AVG(\"成绩\") FROM \"kb_table_1_1\" WHERE \"班级\" = 3;", extractSQL(reply))
+	assert.Equal(t, "select count(*) from kb_table_1_1", extractSQL("select count(*) from kb_table_1_1"))
+	assert.Equal(t, "", extractSQL("NONE"))
+}
+
+func TestValidateSQL(t *testing.T) {
+	allowed := []string{"kb_table_1_1", "kb_table_2_1"}
+	existing := []string{"messages", "settings", "kb_tables", "kb_table_1_1", "kb_table_2_1", "kb_table_9_1"}
+
+	q, err := validateSQL("SELECT COUNT(*) FROM \"kb_table_1_1\" WHERE \"金额\" > 1000 AND \"备注\" = 'update; drop' -- 注释\n;", allowed, existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM \"kb_table_1_1\" WHERE \"金额\" > 1000 AND \"备注\" = 'update; drop'", q)
+
+	_, err = validateSQL("WITH t AS (SELECT * FROM kb_table_1_1) SELECT * FROM t JOIN kb_table_2_1 USING (id)", allowed, existing)
+	assert.NoError(t, err)
+
+	// IN 列表中的字面量不是表名
+	_, err = validateSQL("SELECT * FROM kb_table_1_1 WHERE \"类型\" IN ('a', 'b')", allowed, existing)
+	assert.NoError(t, err)
+
+	for _, bad := range []string{
+		"DELETE FROM kb_table_1_1",
+		"SELECT 1; DROP TABLE kb_table_1_1",
+		"WITH t AS (SELECT 1) DELETE FROM kb_table_1_1",
+		"SELECT * FROM messages",
+		"SELECT * FROM 'messages'",
+		"SELECT * FROM kb_table_1_1 JOIN 'settings' ON 1",
+		"SELECT * FROM kb_table_1_1, 'kb_table_9_1'",
+		"SELECT * FROM main.'messages'",
+		"SELECT * FROM 'sqlite_master'",
+		"SELECT * FROM \"kb_table_9_1\"",
+		"SELECT * FROM sqlite_master",
+		"SELECT * FROM pragma_table_info('messages')",
+		"PRAGMA query_only = OFF",
+		"ATTACH DATABASE 'x.db' AS x",
+	} {
+		_, err := validateSQL(bad, allowed, existing)
+		assert.Error(t, err, bad)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"net/url"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -97,7 +99,29 @@ func (c *vecLRUCache) Set(id uint, v []float32) {
 	}
 }
 
-var kbVecCache = newVecLRUCache(2048, 10*time.Minute)
+var (
+	kbVecCache      = newVecLRUCache(2048, 10*time.Minute)
+	kbVecCacheModel string
+	kbVecCacheMu    sync.Mutex
+)
+
+// vecCacheForModel 分片向量缓存只保存同一模型的向量：模型变化后换用新的缓存
+func vecCacheForModel(model string) *vecLRUCache {
+	kbVecCacheMu.Lock()
+	defer kbVecCacheMu.Unlock()
+	if model != kbVecCacheModel {
+		kbVecCache, kbVecCacheModel = newVecLRUCache(2048, 10*time.Minute), model
+	}
+	return kbVecCache
+}
+
+// chunkVector 分片中由 model 生成的向量；旧版本未记录模型的向量照常使用（由调用方比较维度）
+func chunkVector(ch db.KnowledgeBaseChunk, model string) ([]float32, bool) {
+	if len(ch.Vector) == 0 || (ch.EmbeddingModel != "" && ch.EmbeddingModel != model) {
+		return nil, false
+	}
+	return bytesToFloat32Slice(ch.Vector), true
+}
 
 type scoredChunk struct {
 	chunk db.KnowledgeBaseChunk
@@ -218,13 +242,84 @@ func heuristicTitleFromUser(s string) string {
 	return truncateRunes(s, 20)
 }
 
-func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, lastUserMsg string) []llm.ChatMessage {
+// parseCollectionIDs 解析逗号分隔的集合 ID 列表（如 "1,3"），忽略非法值
+func parseCollectionIDs(s string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// vectorSearchCollections 在检索范围内挑出 embedding 模型与当前模型一致的集合（可做向量检索），
+// 其余集合（重新生成向量完成、切换之前仍是旧模型）返回其 ID 及 "名称(模型, 迁移进度)" 列表用于日志。scope 为空表示全部集合。
+// 只加载了当前模型，无法为查询生成旧模型的向量，因此迁移期间这些集合只能做关键词检索
+func vectorSearchCollections(scope []uint, currentModel string) (ok, mismatchedIDs []uint, mismatched []string) {
+	collections, err := db.ListCollections()
+	if err != nil {
+		return nil, nil, nil
+	}
+	currentModel = strings.TrimSpace(currentModel)
+	for _, c := range collections {
+		if len(scope) > 0 && !slices.Contains(scope, c.ID) {
+			continue
+		}
+		model := strings.TrimSpace(c.EmbeddingModel)
+		if model == "" || currentModel == "" || model == currentModel {
+			ok = append(ok, c.ID)
+			continue
+		}
+		mismatchedIDs = append(mismatchedIDs, c.ID)
+		if job, _ := db.ActiveKBReembedJob(c.ID); job != nil && job.ToModel == currentModel {
+			mismatched = append(mismatched, fmt.Sprintf("%s(%s, re-embedding %d/%d)", c.Name, model, job.Done, job.Total))
+		} else {
+			mismatched = append(mismatched, fmt.Sprintf("%s(%s)", c.Name, model))
+		}
+	}
+	return ok, mismatchedIDs, mismatched
+}
+
+// mergeChunks 把 extra 中未出现过的分片追加到 chunks 之后
+func mergeChunks(chunks, extra []db.KnowledgeBaseChunk) []db.KnowledgeBaseChunk {
+	for _, ch := range extra {
+		if !slices.ContainsFunc(chunks, func(c db.KnowledgeBaseChunk) bool { return c.ID == ch.ID }) {
+			chunks = append(chunks, ch)
+		}
+	}
+	return chunks
+}
+
+// fileIDsInCollections 返回集合下文件 ID 的集合，用于过滤候选分片
+func fileIDsInCollections(collectionIDs []uint) map[uint]bool {
+	m := make(map[uint]bool)
+	ids, err := db.ListKBFileIDsInCollections(collectionIDs)
+	if err != nil {
+		return m
+	}
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m
+}
+
+// kbIDPattern 问题中的编号/ID：学号类（CHN2023-01-15，不区分大小写）、工单号类（INC-1024、JIRA-388）、
+// 资产号类（CI0012345）及 UUID；JSON/YAML 记录的编号字段会汇总到记录首行，按编号即可命中
+var kbIDPattern = regexp.MustCompile(`\b(?:(?i:[A-Z]{2,}\d{4}-\d{2}-\d+)|[A-Z][A-Z0-9]+-\d{2,}|[A-Z]{2,}\d{5,}|(?i:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}))\b`)
+
+// augmentHistoryWithKB 用知识库检索结果改写最后一条用户消息；filter.CollectionIDs 为空表示检索全部集合，
+// 发件人、时间条件作用于所有候选分片的查询
+func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, lastUserMsg string, filter db.ChunkFilter) []llm.ChatMessage {
 	if db.DB == nil {
 		return history
 	}
+	collectionIDs := filter.CollectionIDs
 	// 优化：精简 Prompt 结构，减少 token 占用
 	prompt := "你是一个本地知识库助手。请仅基于提供的上下文回答问题；如果上下文没有答案，直接回答“未找到相关数据”，不要猜测。\n" +
-		"当问题包含编号/ID（例如学号、订单号、CHN...）时，请先在上下文中定位包含该编号的记录，再从记录中提取字段（如“成绩”）原样回答。\n\n"
+		"当问题包含编号/ID（例如学号、订单号、CHN...）时，请先在上下文中定位包含该编号的记录，再从记录中提取字段（如“成绩”）原样回答。\n" +
+		"上下文带有位置标记（如 [幻灯片 12]、[manual.pdf p.37]）时，引用内容请注明出处位置；参考内容附有来源链接时，可在出处后附上该链接。\n\n"
 
 	// 1. 尝试直接读取附件内容
 	// 匹配前端生成的: [已上传文件: [filename](/api/kb/download?file=...)]
@@ -250,25 +345,8 @@ func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, la
 			}
 		}
 
-		// 优先从 DB 中查找文件路径，比单纯拼接更可靠
-		var fullPath string
-		files, err := db.ListKBFiles()
-		if err == nil {
-			for _, f := range files {
-				if filepath.Base(f.Path) == filename {
-					fullPath = f.Path
-					break
-				}
-			}
-		}
-
-		// 如果 DB 没找到，尝试回退到拼接路径
-		if fullPath == "" {
-			folder, err := db.GetKBFolder()
-			if err == nil && folder != "" {
-				fullPath = filepath.Join(folder, filename)
-			}
-		}
+		// 优先从 DB 中查找文件路径（覆盖所有集合目录），找不到再回退到默认目录拼接
+		fullPath, _ := resolveKBFilePath(filename)
 
 		if fullPath != "" {
 			content, err := kbase.GetFileContent(fullPath)
@@ -292,17 +370,21 @@ func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, la
 	var err error
 
 	// 编号/ID 优先策略：如果问题里出现明显的 ID，则优先用该 ID 做文本候选集，避免被其它词干扰
-	idRe := regexp.MustCompile(`(?i)\b[A-Z]{2,}\d{4}-\d{2}-\d+\b`)
-	idMatch := idRe.FindString(lastUserMsg)
+	idMatch := kbIDPattern.FindString(lastUserMsg)
+	queryForText := lastUserMsg
+	if idMatch != "" {
+		queryForText = idMatch
+	}
 
 	// 首先尝试使用向量搜索（两段式：文本候选集 -> 向量精排）
 	if llm.CurrentEngine != nil {
-		// embedding 一致性检查：若模型已切换，则跳过向量检索，避免“维度/分布不一致”导致检索失真
+		// embedding 一致性检查：模型已切换的集合不参与向量检索，避免“维度/分布不一致”导致检索失真
 		curModel := strings.TrimSpace(llm.CurrentEngine.GetModelPath())
-		kbModel, _ := db.GetKBEmbeddingModel()
-		kbModel = strings.TrimSpace(kbModel)
-		if kbModel != "" && curModel != "" && kbModel != curModel {
-			fmt.Printf("[KB] Embedding model mismatch: kb=%s current=%s; skip vector search\n", kbModel, curModel)
+		vecCollections, mismatchedIDs, mismatched := vectorSearchCollections(collectionIDs, curModel)
+		if len(mismatched) > 0 {
+			fmt.Printf("[KB] Embedding model mismatch: kb=%s current=%s; using text search for them until re-embedding completes\n", strings.Join(mismatched, ","), curModel)
+		}
+		if len(vecCollections) == 0 {
 			goto TextFallback
 		}
 
@@ -319,7 +401,9 @@ func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, la
 				queryForCandidates = idMatch
 				candidateLimit = 2000
 			}
-			candidates, e2 := db.SearchKBChunks(queryForCandidates, candidateLimit)
+			vecFilter := filter
+			vecFilter.CollectionIDs = vecCollections
+			candidates, e2 := db.SearchKBChunksFiltered(queryForCandidates, candidateLimit, vecFilter)
 			if e2 == nil && len(candidates) > 0 {
 				const topK = 5
 				h := scoredMinHeap{}
@@ -328,26 +412,27 @@ func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, la
 				// 大文件可能在导入阶段跳过了向量：为避免一次请求对大量候选逐个做 embedding，
 				// 这里设置一个预算，只对少量“无向量候选”按需生成临时 embedding 参与精排。
 				onDemandBudget := 60
+				vecCache := vecCacheForModel(curModel)
 				for _, chunk := range candidates {
 					if chunk.ID == 0 {
 						continue
 					}
 
 					var chunkEmbedding []float32
-					if v, ok := kbVecCache.Get(chunk.ID); ok {
+					if v, ok := vecCache.Get(chunk.ID); ok {
 						chunkEmbedding = v
 					} else {
-						if len(chunk.Vector) > 0 {
-							chunkEmbedding = bytesToFloat32Slice(chunk.Vector)
-							kbVecCache.Set(chunk.ID, chunkEmbedding)
+						if v, ok := chunkVector(chunk, curModel); ok {
+							chunkEmbedding = v
+							vecCache.Set(chunk.ID, chunkEmbedding)
 						} else if idMatch == "" && onDemandBudget > 0 {
-							// 非编号类问题：允许对少量无向量候选按需生成临时向量
+							// 非编号类问题：允许对少量无向量（或向量来自其他模型）的候选按需生成临时向量
 							content := truncateRunes(chunk.Content, 2000)
 							if content != "" && llm.CurrentEngine != nil {
-								emb, e3 := llm.CurrentEngine.GetEmbedding(content)
+								emb, e3 := kb.CachedEmbedding(content)
 								if e3 == nil && len(emb) > 0 {
 									chunkEmbedding = emb
-									kbVecCache.Set(chunk.ID, chunkEmbedding)
+									vecCache.Set(chunk.ID, chunkEmbedding)
 									onDemandBudget--
 								}
 							}
@@ -380,16 +465,24 @@ func augmentHistoryWithKB(kbase *kb.KnowledgeBase, history []llm.ChatMessage, la
 				}
 			}
 		}
+
+		// 模型不一致的集合（如正在重新生成向量）不参与向量检索，始终用关键词检索其分片并合并到结果中，
+		// 否则只要其它集合有向量命中，这些集合的内容就检索不到
+		if len(chunks) > 0 && len(mismatchedIDs) > 0 {
+			textFilter := filter
+			textFilter.CollectionIDs = mismatchedIDs
+			hits, e := db.SearchKBChunksFiltered(queryForText, 5, textFilter)
+			if e != nil {
+				fmt.Printf("[KB] Text search for mismatched collections failed: %v\n", e)
+			}
+			chunks = mergeChunks(chunks, hits)
+		}
 	}
 
 TextFallback:
 	// 如果向量搜索失败或没有结果，回退到传统的文本搜索
 	if len(chunks) == 0 {
-		queryForText := lastUserMsg
-		if idMatch != "" {
-			queryForText = idMatch
-		}
-		chunks, err = db.SearchKBChunks(queryForText, 5)
+		chunks, err = db.SearchKBChunksFiltered(queryForText, 5, filter)
 	}
 
 	if err == nil && len(chunks) > 0 {
@@ -421,9 +514,14 @@ TextFallback:
 		}
 		fmt.Printf("[KB] Total context length (chars): %d\n", totalLen)
 
+		files := kbChunkFiles(validChunks)
 		for i, chunk := range validChunks {
-			// 优化：简化上下文标记，减少 token
-			prompt += fmt.Sprintf("[参考%d]\n%s\n\n", i+1, chunk.Content)
+			// 优化：简化上下文标记，减少 token；分页文档附上可跳转到对应页的链接
+			source := ""
+			if path := files[chunk.FileID].Path; chunk.PageStart > 0 && path != "" {
+				source = fmt.Sprintf(" 来源: [%s p.%d](%s)", filepath.Base(path), chunk.PageStart, kbSourceLink(chunk.FileID, chunk.PageStart))
+			}
+			prompt += fmt.Sprintf("[参考%d]%s\n%s\n\n", i+1, source, chunk.Content)
 		}
 	}
 
@@ -539,3 +637,31 @@ func tryGenerateSmartTitle(conversationID uint, engine llm.Engine) {
 		_ = db.UpdateConversationTitle(conversationID, ht)
 	}
 }
+
+// kbChunkFiles 查询分片所属的文件记录
+func kbChunkFiles(chunks []db.KnowledgeBaseChunk) map[uint]db.KnowledgeBaseFile {
+	ids := make([]uint, 0, len(chunks))
+	for _, ch := range chunks {
+		if !slices.Contains(ids, ch.FileID) {
+			ids = append(ids, ch.FileID)
+		}
+	}
+	files, err := db.GetKBFilesByIDs(ids)
+	if err != nil {
+		fmt.Printf("[KB] Failed to load chunk files: %v\n", err)
+	}
+	return files
+}
+
+// kbSourceLink 生成知识库文件的下载链接；按文件 ID 定位（不同目录下可能有同名文件），
+// page > 0 时带 #page= 以便浏览器直接打开对应页
+func kbSourceLink(fileID uint, page int) string {
+	if fileID == 0 {
+		return ""
+	}
+	link := "/api/kb/download?id=" + strconv.FormatUint(uint64(fileID), 10)
+	if page > 0 {
+		link += "#page=" + strconv.Itoa(page)
+	}
+	return link
+}
@@ -0,0 +1,56 @@
+//go:build cgo
+
+package server
+
+import (
+	"testing"
+
+	"knowledge/internal/db"
+	"knowledge/internal/kb"
+	"knowledge/internal/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// embedEngine 只提供模型名与固定查询向量的引擎
+type embedEngine struct {
+	llm.Engine
+	model string
+}
+
+func (e embedEngine) GetModelPath() string                   { return e.model }
+func (e embedEngine) GetEmbedding(string) ([]float32, error) { return []float32{1, 0}, nil }
+
+func TestAugmentHistoryKeywordSearchesReembeddingCollections(t *testing.T) {
+	openTestDB(t)
+	prev := llm.CurrentEngine
+	llm.CurrentEngine = embedEngine{model: "new.gguf"}
+	t.Cleanup(func() { llm.CurrentEngine = prev })
+
+	// 一个已是当前模型的集合，一个正在从旧模型重新生成向量的集合
+	addChunk := func(model, content string) uint {
+		c := db.KnowledgeBaseCollection{Name: content, EmbeddingModel: model}
+		assert.NoError(t, db.DB.Create(&c).Error)
+		f := db.KnowledgeBaseFile{CollectionID: c.ID, Path: "/docs/" + content + ".md"}
+		assert.NoError(t, db.DB.Create(&f).Error)
+		v := kb.Float32SliceToBytes([]float32{1, 0})
+		ch := db.KnowledgeBaseChunk{FileID: f.ID, Content: "budget report " + content, Vector: v, EmbeddingModel: model, EmbeddingDim: 2}
+		assert.NoError(t, db.DB.Create(&ch).Error)
+		return c.ID
+	}
+	current := addChunk("new.gguf", "current")
+	migrating := addChunk("old.gguf", "migrating")
+	_, err := db.StartKBReembedJob(migrating, "old.gguf", "new.gguf")
+	assert.NoError(t, err)
+
+	ok, mismatchedIDs, mismatched := vectorSearchCollections([]uint{current, migrating}, "new.gguf")
+	assert.Equal(t, []uint{current}, ok)
+	assert.Equal(t, []uint{migrating}, mismatchedIDs)
+	assert.Contains(t, mismatched[0], "re-embedding")
+
+	// 向量检索命中当前集合的同时，重新生成向量中的集合仍通过关键词检索进入上下文
+	history := augmentHistoryWithKB(nil, []llm.ChatMessage{{Role: "user", Content: "budget"}}, "budget", db.ChunkFilter{CollectionIDs: []uint{current, migrating}})
+	prompt := history[0].Content
+	assert.Contains(t, prompt, "budget report current")
+	assert.Contains(t, prompt, "budget report migrating")
+}
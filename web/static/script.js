@@ -30,6 +30,7 @@ document.addEventListener('DOMContentLoaded', () => {
     const kbFileUpload = document.getElementById('kb-file-upload');
     const chatFileInput = document.getElementById('chat-file-input');
     const attachBtn = document.getElementById('attach-btn');
+    const sqlModeToggle = document.getElementById('sql-mode-toggle');
     const filePreviewContainer = document.getElementById('file-preview-container');
 
     // 预览模态框元素
@@ -45,6 +46,8 @@ document.addEventListener('DOMContentLoaded', () => {
     const deleteSelectedChatsBtn = document.getElementById('delete-selected-chats-btn');
     const cancelManageBtn = document.getElementById('cancel-manage-btn');
     const deleteSelectedFilesBtn = document.getElementById('delete-selected-files-btn');
+    const retryFailedFilesBtn = document.getElementById('retry-failed-files-btn');
+    const backfillStatus = document.getElementById('backfill-status');
     
     const LOADING_HTML = '<div class="loading-dots"><div class="loading-dot"></div><div class="loading-dot"></div><div class="loading-dot"></div></div>';
 
@@ -904,7 +907,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 headers: {
                     'Content-Type': 'application/json'
                 },
-                body: JSON.stringify({ message: message })
+                body: JSON.stringify({ message: message, mode: sqlModeToggle.checked ? 'sql' : '' })
             });
 
             if (!response.ok) {
@@ -1211,6 +1214,33 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     }
 
+    // 后台向量任务的进度：模型切换后按集合重新生成向量（完成前该集合的查询无法与旧向量比较，只做关键词检索），以及空闲时补齐缺少向量的分片
+    function updateBackfillStatus(progress) {
+        const parts = [];
+        const tips = [];
+        ((progress && progress.reembed) || []).forEach(r => {
+            if (r.status !== 'queued' && r.status !== 'running') return;
+            parts.push(`重建向量 ${r.collection}：${r.done}/${r.total}（完成前仅关键词检索）`);
+            tips.push(`${r.collection}: ${r.from_model} → ${r.to_model}，完成前该集合不参与语义检索，只按关键词匹配`);
+        });
+        const bf = progress && progress.backfill;
+        if (bf && bf.remaining) {
+            const state = bf.status === 'running' ? '补齐向量中' : '等待空闲补齐向量';
+            parts.push(`${state}：剩余 ${bf.remaining} 个分片`);
+        }
+        if (bf) tips.push(...[bf.current_file, bf.error].filter(Boolean));
+        backfillStatus.textContent = parts.join('；');
+        backfillStatus.title = tips.join('\n');
+    }
+
+    // 扫描对账结果摘要：新增/变更/改名/删除
+    function formatSyncStats(progress) {
+        const st = progress && progress.stats;
+        if (!st) return '';
+        const skipped = progress.skipped_count ? `，跳过 ${progress.skipped_count}` : '';
+        return `（新增 ${st.added}，变更 ${st.changed}，改名 ${st.renamed}，删除 ${st.removed}${skipped}）`;
+    }
+
     syncKBBtn.addEventListener('click', async () => {
         if (syncKBBtn.disabled) return; // 防止重复点击
         
@@ -1249,7 +1279,7 @@ document.addEventListener('DOMContentLoaded', () => {
                         const finalProgress = await getSyncProgress();
                         updateProgressBar(finalProgress);
                         
-                        syncStatus.textContent = '同步完成';
+                        syncStatus.textContent = '同步完成' + formatSyncStats(finalProgress);
                         syncKBBtn.disabled = false;
                         resetKBBtn.disabled = false;
                         pauseSyncKBBtn.disabled = true;
@@ -1398,6 +1428,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
         const ext = getFileExtension(fileName);
         const imageExts = ['png', 'jpg', 'jpeg', 'gif', 'webp', 'svg'];
+        const markdownPreviewExts = ['md', 'markdown', 'html', 'htm', 'xhtml', 'mhtml', 'mht', 'pptx', 'odt', 'rtf', 'epub'];
 
         // 1. 如果是图片，直接显示
         if (imageExts.includes(ext)) {
@@ -1435,8 +1466,8 @@ document.addEventListener('DOMContentLoaded', () => {
             const data = await res.json();
             
             if (data.content) {
-                if (ext === 'md') {
-                    // Markdown 渲染
+                if (markdownPreviewExts.includes(ext)) {
+                    // Markdown 渲染（网页抽取后为类 Markdown 文本）
                     previewBody.innerHTML = renderMarkdown(data.content);
                 } else {
                     // 代码或纯文本显示
@@ -1472,6 +1503,22 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    // 根据后端已注册的抽取器更新上传控件可选的文件类型
+    async function loadKBFormats() {
+        try {
+            const res = await fetch('/api/kb/formats');
+            const data = await res.json();
+            if (Array.isArray(data.extensions) && data.extensions.length > 0) {
+                const accept = data.extensions.join(',');
+                kbFileUpload.setAttribute('accept', accept);
+                chatFileInput.setAttribute('accept', accept);
+            }
+        } catch (e) {
+            console.error('Failed to load KB formats', e);
+        }
+    }
+    loadKBFormats();
+
     async function loadKBFiles() {
         try {
             const res = await fetch('/api/kb/files');
@@ -1484,6 +1531,7 @@ document.addEventListener('DOMContentLoaded', () => {
             kbFileList.innerHTML = '';
             selectedFileIds.clear();
             updateFileBatchBtn();
+            retryFailedFilesBtn.style.display = files.some(f => f.Status === 'error') ? 'block' : 'none';
             
             let allProcessed = true;
             if (files.length === 0) {
@@ -1502,6 +1550,8 @@ document.addEventListener('DOMContentLoaded', () => {
                 console.error('Failed to get sync progress:', err);
             }
 
+            updateBackfillStatus(syncProgress);
+
             files.forEach(f => {
                 const item = document.createElement('div');
                 item.className = 'file-item';
@@ -1556,6 +1606,7 @@ document.addEventListener('DOMContentLoaded', () => {
                     <span class="file-status ${statusClass}">${statusText}${progressText}</span>
                     <button class="file-delete-btn" style="background: none; border: none; cursor: pointer; color: #999; font-size: 1.2em; padding: 0 5px;">&times;</button>
                 `;
+                right.querySelector('.file-status').title = fileDiagnostics(f);
                 
                 const deleteBtn = right.querySelector('.file-delete-btn');
                 deleteBtn.addEventListener('click', async (e) => {
@@ -1587,6 +1638,28 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     }
 
+    // fileDiagnostics 文件状态的悬停提示：失败阶段与原因、分片数、耗时与抽取警告
+    function fileDiagnostics(f) {
+        const lines = [];
+        if (f.Error) lines.push(`失败阶段: ${f.FailedStage || '-'}`, `原因: ${f.Error}`);
+        if (f.ChunkCount) lines.push(`分片: ${f.ChunkCount}，已向量化: ${f.VectorCount}`);
+        if (f.ExtractMs || f.EmbedMs) lines.push(`耗时: 抽取 ${f.ExtractMs} ms，向量 ${f.EmbedMs} ms`);
+        if (f.Warnings && f.Warnings.length) lines.push('警告:', ...f.Warnings.map(w => `- ${w}`));
+        return lines.join('\n');
+    }
+
+    retryFailedFilesBtn.addEventListener('click', async () => {
+        try {
+            const res = await fetch('/api/kb/files/retry-failed', { method: 'POST' });
+            const data = await res.json();
+            if (!res.ok) throw new Error(data.error || 'Unknown error');
+            await loadKBFiles();
+        } catch (err) {
+            console.error(err);
+            alert('重试失败: ' + err.message);
+        }
+    });
+
     function updateFileBatchBtn() {
         if (selectedFileIds.size > 0) {
             deleteSelectedFilesBtn.style.display = 'block';